@@ -44,7 +44,112 @@ apiExplorer.readApiKey = function() {
     return $('#api-key-select').val() || $('#api-key-input').val() || "";
 };
 apiExplorer.readAccessToken = function() {
-    return $('#access-token-input').val() || "";
+    return $('#access-token-input').val() || this._accessToken || "";
+};
+// OAuth 2 access tokens obtained through DapperDox are held in session storage, keyed by
+// specification and security scheme, so that they last for the browser session.
+apiExplorer._oauth2Key = function(specPath, scheme) {
+    return "dapperdox.oauth2:" + specPath + ":" + scheme;
+};
+apiExplorer.storeAccessToken = function(specPath, scheme, token) {
+    if( token.expires_in ) {
+        token.expires_at = Date.now() + token.expires_in * 1000;
+    }
+    sessionStorage.setItem(this._oauth2Key(specPath, scheme), JSON.stringify(token));
+};
+apiExplorer.getStoredAccessToken = function(specPath, scheme) {
+    var key   = this._oauth2Key(specPath, scheme);
+    var token = JSON.parse(sessionStorage.getItem(key) || "null");
+
+    if( token && token.expires_at && token.expires_at < Date.now() ) {
+        sessionStorage.removeItem(key);
+        return null;
+    }
+    return token;
+};
+apiExplorer.forgetAccessToken = function(specPath, scheme) {
+    sessionStorage.removeItem(this._oauth2Key(specPath, scheme));
+};
+apiExplorer.setAccessToken = function(token) {
+    this._accessToken = token;
+};
+
+// Start the authorization code flow, returning to this page with an access token.
+apiExplorer.authorise = function(specPath, scheme, scopes) {
+    window.location = specPath + "/oauth2/" + encodeURIComponent(scheme) + "/authorize?" +
+        $.param({ scope: scopes.join(" "), "return": window.location.pathname + window.location.search });
+};
+
+// Obtain an access token through the client credentials flow, which DapperDox performs so
+// that the client secret is not given to the browser.
+apiExplorer.requestClientToken = function(specPath, scheme, scopes, csrfToken, done) {
+    $.ajax({
+        type:     "POST",
+        url:      specPath + "/oauth2/" + encodeURIComponent(scheme) + "/token",
+        data:     { scope: scopes.join(" ") },
+        headers:  { "X-CSRF-Token": csrfToken },
+        dataType: "json",
+        success:  function( token ) { apiExplorer.storeAccessToken(specPath, scheme, token); done(null); },
+        error:    function( xhr ) {
+            var message = xhr.statusText;
+            if( xhr.responseJSON && xhr.responseJSON.error ) {
+                message = xhr.responseJSON.error_description || xhr.responseJSON.error;
+            }
+            done(message);
+        }
+    });
+};
+
+// Wire up the OAuth 2 forms of the page, using the first access token held for its schemes.
+apiExplorer.initOAuth2 = function(csrfToken) {
+    $('.oauth2-authorise').each(function() {
+        var block    = $(this);
+        var specPath = block.data('spec-path');
+        var scheme   = String(block.data('scheme'));
+        var status   = block.find('.oauth2-status');
+
+        var show = function() {
+            var token = apiExplorer.getStoredAccessToken(specPath, scheme);
+            status.empty();
+            if( token == null ) return;
+
+            if( !apiExplorer._accessToken ) {
+                apiExplorer.setAccessToken(token.access_token);
+            }
+            status.text("The API explorer holds an access token for " + scheme +
+                (token.scope ? ", with the scopes " + token.scope : "") + ". ");
+            $('<a href="#">Forget it</a>').appendTo(status).click(function(e) {
+                e.preventDefault();
+                if( apiExplorer._accessToken == token.access_token ) {
+                    apiExplorer.setAccessToken("");
+                }
+                apiExplorer.forgetAccessToken(specPath, scheme);
+                show();
+            });
+        };
+
+        block.find('.oauth2-flow').submit(function(e) {
+            e.preventDefault();
+            var form   = $(this);
+            var scopes = form.find('input[name=scope]:checked').map(function() { return this.value; }).get();
+
+            if( form.data('grant') == "code" ) {
+                apiExplorer.authorise(specPath, scheme, scopes);
+                return;
+            }
+            apiExplorer.requestClientToken(specPath, scheme, scopes, csrfToken, function(err) {
+                if( err ) {
+                    status.text("No access token was obtained: " + err);
+                    return;
+                }
+                var token = apiExplorer.getStoredAccessToken(specPath, scheme);
+                apiExplorer.setAccessToken(token.access_token);
+                show();
+            });
+        });
+
+        show();
+    });
 };
 apiExplorer.readBasicUsername = function() {
     return $('#basic-username-input').val() || "";
@@ -179,9 +284,41 @@ var _process = function(text, status, xhr, fullhost) {
     $('#response_code').text( xhr.status + ' ' + xhr.statusText );
     $('#response_headers').html( hljs.highlight( 'http', xhr.getAllResponseHeaders() ).value );
 
+    _show_validation( xhr );
+
     $('#exploreButton').removeAttr('disabled');
 }
 
+// --------------------------------------------------------------------------------------
+// A validating proxy lists the ways in which the request and response differ from the
+// specification in the X-DapperDox-Validation header.
+
+var _show_validation = function( xhr ) {
+    var header = xhr.getResponseHeader('X-DapperDox-Validation');
+
+    $('#validation_block').hide();
+    if( header == null ) {
+        return;
+    }
+
+    var findings = [];
+    try {
+        findings = JSON.parse( header );
+    }
+    catch(err) {
+        findings = [ header ];
+    }
+
+    var list = $('#response_validation').empty();
+    if( findings.length == 0 ) {
+        list.append( $('<li>').text( 'The request and response match the specification.' ) );
+    }
+    for( var i = 0; i < findings.length; i++ ) {
+        list.append( $('<li>').text( findings[i] ) );
+    }
+    $('#validation_block').show();
+}
+
 // --------------------------------------------------------------------------------------
 
 var _set_headers = function(request, headers ) {
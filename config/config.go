@@ -18,6 +18,9 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package config
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
 	"reflect"
 	"strings"
 
@@ -41,8 +44,30 @@ type config struct {
 	ForceSpecList      bool        `env:"FORCE_SPECIFICATION_LIST" flag:"force-specification-list" flagDesc:"Force the homepage to be the summary list of available specifications. The default when serving a single OpenAPI specification is to make the homepage the API summary."`
 	ShowAssets         bool        `env:"AUTHOR_SHOW_ASSETS" flag:"author-show-assets" flagDesc:"Display at the foot of each page the overlay asset paths, in priority order, that DapperDox will check before rendering."`
 	ProxyPath          []string    `env:"PROXY_PATH" flag:"proxy-path" flagDesc:"Give a path to proxy though to another service. May be multiply defined. Format is local-path=scheme://host/dst-path."`
+	ProxyCredential    []string    `env:"PROXY_CREDENTIAL" flag:"proxy-credential" flagDesc:"Add a credential to requests through a proxy-path, which is never sent to the browser. May be multiply defined. Format is local-path=header:name=source, local-path=query:name=source or local-path=bearer=source, where the source is env:VARIABLE or file:path."`
+	ProxyValidate      bool        `env:"PROXY_VALIDATE" flag:"proxy-validate" flagDesc:"Check requests through proxy-path, and the responses to them, against the specifications, returning what is found in the X-DapperDox-Validation response header."`
 	TLSCertificate     string      `env:"TLS_CERTIFICATE" flag:"tls-certificate" flagDesc:"The fully qualified path to the TLS certificate file. For HTTP over TLS (HTTPS) both a certificate and a key must be provided."`
 	TLSKey             string      `env:"TLS_KEY" flag:"tls-key" flagDesc:"The fully qualified path to the TLS private key file. For HTTP over TLS (HTTPS) both a certificate and a key must be provided."`
+	SpecVersion        []string    `env:"SPEC_VERSION" flag:"spec-version" flagDesc:"Serve a specification file as one version of a specification. May be multiply defined, to give each version of the specification. Format is id:version=filename, where the filename is within the spec-dir, or is a URL."`
+	SpecCurrentVersion []string    `env:"SPEC_CURRENT_VERSION" flag:"spec-current-version" flagDesc:"The current version of a specification given by spec-version. May be multiply defined. Format is id=version. Defaults to the newest version."`
+	SpecRefresh        []string    `env:"SPEC_REFRESH" flag:"spec-refresh" flagDesc:"How often to refresh remotely hosted specifications, such as 5m. May be multiply defined. Format is either a duration for every remote specification, or url=duration for just the one."`
+	ValidateOutput     string      `env:"VALIDATE_OUTPUT" flag:"validate-output" flagDesc:"Output format of the validate command, either text or json."`
+	DiffOutput         string      `env:"DIFF_OUTPUT" flag:"diff-output" flagDesc:"Output format of the diff command, either text or json."`
+	DiffSeverity       []string    `env:"DIFF_SEVERITY" flag:"diff-severity" flagDesc:"Override the severity of a kind of change reported by the diff command. May be multiply defined. Format is rule=severity, where severity is error, warning, info or ignore."`
+	DiffFailOn         string      `env:"DIFF_FAIL_ON" flag:"diff-fail-on" flagDesc:"The lowest severity of change for which the diff command exits with a non-zero status, either error, warning or info."`
+	Watch              bool        `env:"WATCH" flag:"watch" flagDesc:"Watch the spec-dir, assets-dir and theme-dir for changes, rebuilding the documentation without a restart."`
+	LiveReload         bool        `env:"LIVE_RELOAD" flag:"live-reload" flagDesc:"When watching for changes, reload pages open in the browser once the documentation has been rebuilt."`
+	Mock               bool        `env:"MOCK" flag:"mock" flagDesc:"Serve a mock of each specified API, answering requests with the documented responses and examples."`
+	MockPrefix         string      `env:"MOCK_PREFIX" flag:"mock-prefix" flagDesc:"The path under which the mock APIs are served, each at mock-prefix/specification-id. Defaults to /mock."`
+	OAuth2Client       []string    `env:"OAUTH2_CLIENT" flag:"oauth2-client" flagDesc:"The client ID with which the API explorer obtains access tokens for an OAuth2 security scheme, using its authorization code or client credentials flow. May be multiply defined. Format is id:scheme=client-id."`
+	OAuth2ClientSecret []string    `env:"OAUTH2_CLIENT_SECRET" flag:"oauth2-client-secret" flagDesc:"The secret of an oauth2-client, which is never sent to the browser. May be multiply defined. Format is id:scheme=source, where the source is env:VARIABLE or file:path."`
+}
+
+// OAuth2Client is a client of an OAuth2 security scheme, given by oauth2-client and
+// oauth2-client-secret.
+type OAuth2Client struct {
+	ID     string
+	Secret string // The source of the client secret, if it has one
 }
 
 var cfg *config
@@ -60,6 +85,10 @@ func Get() (*config, error) {
 		LogLevel:         "info",
 		SiteURL:          "http://localhost:3123/",
 		ShowAssets:       false,
+		ValidateOutput:   "text",
+		DiffOutput:       "text",
+		DiffFailOn:       "error",
+		MockPrefix:       "/mock",
 	}
 
 	err := gofigure.Gofigure(cfg)
@@ -67,6 +96,12 @@ func Get() (*config, error) {
 		return nil, err
 	}
 
+	for _, c := range append(cfg.OAuth2Client, cfg.OAuth2ClientSecret...) {
+		if _, _, _, ok := splitSchemeSetting(c); !ok {
+			return nil, fmt.Errorf("invalid OAuth2 client setting %q - expected id:scheme=value", c)
+		}
+	}
+
 	if len(cfg.SpecFilename) == 0 {
 		cfg.SpecFilename = append(cfg.SpecFilename, "/swagger.json")
 	}
@@ -100,3 +135,64 @@ func (c *config) print() {
 		logger.Printf(nil, "\t%s%s: %s\n", strings.Repeat(" ", ml-len(t.Field(i).Name)), t.Field(i).Name, f.Interface())
 	}
 }
+
+// OAuth2Clients returns the clients configured for the OAuth2 security schemes of a
+// specification, keyed by scheme name.
+func (c *config) OAuth2Clients(specID string) map[string]OAuth2Client {
+	clients := make(map[string]OAuth2Client)
+
+	for _, setting := range c.OAuth2Client {
+		if id, scheme, value, ok := splitSchemeSetting(setting); ok && id == specID {
+			client := clients[scheme]
+			client.ID = value
+			clients[scheme] = client
+		}
+	}
+	for _, setting := range c.OAuth2ClientSecret {
+		if id, scheme, value, ok := splitSchemeSetting(setting); ok && id == specID {
+			if client, ok := clients[scheme]; ok {
+				client.Secret = value
+				clients[scheme] = client
+			}
+		}
+	}
+	return clients
+}
+
+// splitSchemeSetting splits a setting of the form id:scheme=value.
+func splitSchemeSetting(setting string) (id, scheme, value string, ok bool) {
+	slice := strings.SplitN(setting, "=", 2)
+	if len(slice) != 2 {
+		return "", "", "", false
+	}
+	name := strings.SplitN(slice[0], ":", 2)
+	if len(name) != 2 || name[0] == "" || name[1] == "" || slice[1] == "" {
+		return "", "", "", false
+	}
+	return name[0], name[1], slice[1], true
+}
+
+// ReadSecret reads a secret from its source, either env:VARIABLE or file:path.
+func ReadSecret(source string) (string, error) {
+	switch {
+	case strings.HasPrefix(source, "env:"):
+		name := strings.TrimPrefix(source, "env:")
+		value := os.Getenv(name)
+		if value == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(source, "file:"):
+		name := strings.TrimPrefix(source, "file:")
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		value := strings.TrimSpace(string(b))
+		if value == "" {
+			return "", fmt.Errorf("file %s is empty", name)
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("source %q is neither env:VARIABLE nor file:path", source)
+}
@@ -0,0 +1,204 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+package diff
+
+// This package implements the diff command, which compares two specification files through
+// the same loaders as the server, and reports the changes between them. It is intended for
+// detecting breaking changes in release pipelines.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/UKHomeOffice/dapperdox/config"
+	"github.com/UKHomeOffice/dapperdox/logger"
+	"github.com/UKHomeOffice/dapperdox/spec"
+)
+
+// Exit codes of the diff command
+const (
+	ExitOK      = 0 // No change at or above the fail-on severity
+	ExitChanges = 1 // At least one change at or above the fail-on severity
+	ExitFailed  = 2 // The specifications could not be compared
+)
+
+// Severities of a change, from the most to the least severe. A change of severity ignore is
+// not reported.
+var severities = map[string]int{
+	"error":   3,
+	"warning": 2,
+	"info":    1,
+	"ignore":  0,
+}
+
+// Change is a single change reported by the diff command
+type Change struct {
+	spec.Change
+	Severity string `json:"severity"`
+}
+
+// Report lists the changes reported by the diff command
+type Report struct {
+	Old     string   `json:"old"`
+	New     string   `json:"new"`
+	Failed  bool     `json:"failed"` // Whether any change is at or above the fail-on severity
+	Changes []Change `json:"changes"`
+}
+
+// ---------------------------------------------------------------------------
+// Run compares the old and new specifications, writes the report to w in the configured
+// output format, and returns the exit code for the command.
+func Run(w io.Writer, oldLocation, newLocation string) int {
+
+	cfg, err := config.Get()
+	if err != nil {
+		logger.Errorf(nil, "error configuring app: %s", err)
+		return ExitFailed
+	}
+
+	rules, err := severityRules(cfg.DiffSeverity)
+	if err != nil {
+		logger.Errorf(nil, "Error: %s", err)
+		return ExitFailed
+	}
+	failOn, ok := severities[cfg.DiffFailOn]
+	if !ok || failOn == 0 {
+		logger.Errorf(nil, "Error: invalid diff-fail-on severity %s", cfg.DiffFailOn)
+		return ExitFailed
+	}
+
+	report, err := Diff(oldLocation, newLocation, rules, failOn)
+	if err != nil {
+		logger.Errorf(nil, "Error: %s", err)
+		return ExitFailed
+	}
+
+	switch cfg.DiffOutput {
+	case "json":
+		err = writeJSON(w, report)
+	default:
+		err = writeText(w, report)
+	}
+	if err != nil {
+		logger.Errorf(nil, "Error writing diff report: %s", err)
+		return ExitFailed
+	}
+
+	if report.Failed {
+		return ExitChanges
+	}
+	return ExitOK
+}
+
+// ---------------------------------------------------------------------------
+// Diff loads both specifications and compares their current versions. Each change takes the
+// severity given by the rules for its kind, defaulting to error for a breaking change and
+// info otherwise. The report fails if any change is of at least the failOn severity.
+func Diff(oldLocation, newLocation string, rules map[string]string, failOn int) (*Report, error) {
+
+	oldSpec, err := load(oldLocation)
+	if err != nil {
+		return nil, err
+	}
+	newSpec, err := load(newLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Old: oldLocation, New: newLocation, Changes: make([]Change, 0)}
+
+	for _, change := range spec.CompareAPIs(oldSpec.APIs, newSpec.APIs) {
+		severity, ok := rules[change.Rule]
+		if !ok {
+			severity = "info"
+			if change.Breaking {
+				severity = "error"
+			}
+		}
+		if severities[severity] == 0 {
+			continue
+		}
+		if severities[severity] >= failOn {
+			report.Failed = true
+		}
+		report.Changes = append(report.Changes, Change{Change: change, Severity: severity})
+	}
+
+	return report, nil
+}
+
+// ---------------------------------------------------------------------------
+func load(location string) (*spec.APISpecification, error) {
+	specification, err := spec.LoadSpecification(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load specification %s: %s", location, err)
+	}
+	if spec.HasErrors(specification.Diagnostics) {
+		// Parts of the specification were skipped, so the comparison would not be reliable
+		return nil, fmt.Errorf("specification %s has errors, see the validate command", location)
+	}
+	return specification, nil
+}
+
+// ---------------------------------------------------------------------------
+// severityRules parses the rule=severity overrides of the diff-severity configuration.
+func severityRules(overrides []string) (map[string]string, error) {
+	rules := make(map[string]string)
+
+	for _, override := range overrides {
+		slice := strings.Split(override, "=")
+		if len(slice) != 2 {
+			return nil, fmt.Errorf("invalid diff-severity %s - not a rule=severity pair", override)
+		}
+		if _, ok := severities[slice[1]]; !ok {
+			return nil, fmt.Errorf("invalid diff-severity %s - unknown severity %s", override, slice[1])
+		}
+		rules[slice[0]] = slice[1]
+	}
+	return rules, nil
+}
+
+// ---------------------------------------------------------------------------
+func writeJSON(w io.Writer, report *Report) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// ---------------------------------------------------------------------------
+func writeText(w io.Writer, report *Report) error {
+	for _, c := range report.Changes {
+		location := c.Operation
+		if c.Location != "" {
+			location += " " + c.Location
+		}
+		if _, err := fmt.Fprintf(w, "%-7s %-24s %s: %s\n", c.Severity, c.Rule, location, c.Message); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d change(s) found\n", len(report.Changes))
+	return err
+}
+
+// ---------------------------------------------------------------------------
+// end
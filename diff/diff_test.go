@@ -0,0 +1,168 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/UKHomeOffice/dapperdox/config"
+)
+
+const oldSpec = `
+openapi: 3.0.0
+info:
+  title: Pets
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      responses:
+        '200':
+          description: The pets
+  /pets/{id}:
+    delete:
+      operationId: deletePet
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        '204':
+          description: Deleted
+`
+
+// newSpec removes an operation, which is breaking, and adds an optional parameter, which is not
+const newSpec = `
+openapi: 3.0.0
+info:
+  title: Pets
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      parameters:
+        - name: limit
+          in: query
+          schema:
+            type: integer
+      responses:
+        '200':
+          description: The pets
+`
+
+func TestRun(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "diff")
+	if err != nil {
+		t.Fatal(`Failed to create specifications` + err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	oldLocation := filepath.Join(dir, "old.yaml")
+	newLocation := filepath.Join(dir, "new.yaml")
+	if ioutil.WriteFile(oldLocation, []byte(oldSpec), 0644) != nil || ioutil.WriteFile(newLocation, []byte(newSpec), 0644) != nil {
+		t.Fatal(`Failed to create specifications`)
+	}
+
+	config.Get() // Fails the first time under test, on the test flags, but is then configured
+	cfg, _ := config.Get()
+	defer func() {
+		cfg.DiffSeverity, cfg.DiffFailOn, cfg.DiffOutput = nil, "error", "text"
+	}()
+
+	tests := []struct {
+		name     string
+		severity []string
+		failOn   string
+		newSpec  string
+		code     int
+		lines    []string
+	}{
+		{"defaults", nil, "error", newLocation, ExitChanges,
+			[]string{"error   operation-removed        DELETE /pets/{id}: Operation removed", "info    parameter-added", "2 change(s) found"}},
+		{"unchanged", nil, "info", oldLocation, ExitOK,
+			[]string{"0 change(s) found"}},
+		{"downgraded", []string{"operation-removed=warning"}, "error", newLocation, ExitOK,
+			[]string{"warning operation-removed", "info    parameter-added"}},
+		{"fail on warning", []string{"operation-removed=warning"}, "warning", newLocation, ExitChanges,
+			[]string{"warning operation-removed"}},
+		{"ignored", []string{"operation-removed=ignore"}, "error", newLocation, ExitOK,
+			[]string{"info    parameter-added", "1 change(s) found"}},
+		{"fail on info", []string{"operation-removed=ignore"}, "info", newLocation, ExitChanges,
+			[]string{"info    parameter-added", "1 change(s) found"}},
+		{"upgraded", []string{"parameter-added=error", "operation-removed=ignore"}, "error", newLocation, ExitChanges,
+			[]string{"error   parameter-added"}},
+		{"unknown severity", []string{"operation-removed=fatal"}, "error", newLocation, ExitFailed, nil},
+		{"not a pair", []string{"operation-removed"}, "error", newLocation, ExitFailed, nil},
+		{"invalid fail-on", nil, "ignore", newLocation, ExitFailed, nil},
+		{"missing specification", nil, "error", filepath.Join(dir, "missing.yaml"), ExitFailed, nil},
+	}
+	for _, test := range tests {
+		cfg.DiffSeverity, cfg.DiffFailOn, cfg.DiffOutput = test.severity, test.failOn, "text"
+
+		var out bytes.Buffer
+		code := Run(&out, oldLocation, test.newSpec)
+
+		if code != test.code {
+			t.Errorf(`%s exit code fail: %d`, test.name, code)
+		}
+		if test.lines == nil && out.Len() != 0 {
+			t.Errorf(`%s output fail: %s`, test.name, out.String())
+		}
+		for _, line := range test.lines {
+			if !strings.Contains(out.String(), line) {
+				t.Errorf(`%s output fail: missing %q in %s`, test.name, line, out.String())
+			}
+		}
+	}
+}
+
+func TestRunWritesJSON(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "diff")
+	if err != nil {
+		t.Fatal(`Failed to create specifications` + err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	oldLocation := filepath.Join(dir, "old.yaml")
+	newLocation := filepath.Join(dir, "new.yaml")
+	if ioutil.WriteFile(oldLocation, []byte(oldSpec), 0644) != nil || ioutil.WriteFile(newLocation, []byte(newSpec), 0644) != nil {
+		t.Fatal(`Failed to create specifications`)
+	}
+
+	config.Get()
+	cfg, _ := config.Get()
+	cfg.DiffSeverity, cfg.DiffFailOn, cfg.DiffOutput = []string{"parameter-added=warning"}, "error", "json"
+	defer func() {
+		cfg.DiffSeverity, cfg.DiffFailOn, cfg.DiffOutput = nil, "error", "text"
+	}()
+
+	var out bytes.Buffer
+	if code := Run(&out, oldLocation, newLocation); code != ExitChanges {
+		t.Errorf(`Exit code fail: %d`, code)
+	}
+
+	var report Report
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(`Failed to parse report` + err.Error())
+	}
+	if report.Old != oldLocation || report.New != newLocation || !report.Failed || len(report.Changes) != 2 {
+		t.Fatalf(`Report fail: %s`, out.String())
+	}
+	severities := make(map[string]string)
+	for _, c := range report.Changes {
+		severities[c.Rule] = c.Severity
+	}
+	if severities["operation-removed"] != "error" || severities["parameter-added"] != "warning" {
+		t.Errorf(`Severities fail: %v`, severities)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+package changes
+
+import (
+	"net/http"
+
+	"github.com/UKHomeOffice/dapperdox/logger"
+	"github.com/UKHomeOffice/dapperdox/render"
+	"github.com/UKHomeOffice/dapperdox/spec"
+	"github.com/gorilla/pat"
+)
+
+// ---------------------------------------------------------------------------
+// Register creates routes for the changes between versions of each specification
+func Register(r *pat.Router) {
+	logger.Debugln(nil, "registering handlers for specification changes")
+
+	for _, specification := range spec.APISuite {
+		// Routes match by prefix, so the JSON form must be registered first
+		r.Path("/" + specification.ID + "/changes.json").Methods("GET").HandlerFunc(changesJSONHandler(specification))
+		r.Path("/" + specification.ID + "/changes").Methods("GET").HandlerFunc(changesHandler(specification))
+	}
+}
+
+// ---------------------------------------------------------------------------
+// changesHandler is a http.Handler for the page listing the changes between two versions
+func changesHandler(specification *spec.APISpecification) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		versions := specification.Versions()
+
+		report, err := changes(specification, versions, req)
+		if err != nil {
+			logger.Tracef(req, "%s", err)
+			render.HTML(w, http.StatusNotFound, "error", render.DefaultVars(req, specification, render.Vars{"error": err.Error(), "code": 404}))
+			return
+		}
+
+		render.HTML(w, http.StatusOK, "changes", render.DefaultVars(req, specification, render.Vars{"Title": "Changes",
+			"Report": report, "Versions": versions}))
+	}
+}
+
+// ---------------------------------------------------------------------------
+// changesJSONHandler is a http.Handler for the JSON form of the changes between two versions
+func changesJSONHandler(specification *spec.APISpecification) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		report, err := changes(specification, specification.Versions(), req)
+		if err != nil {
+			render.JSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+
+		render.JSON(w, http.StatusOK, report)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// changes compares the versions given by the from and to query parameters. To defaults to
+// the newest version, and from to the version before it.
+func changes(specification *spec.APISpecification, versions []string, req *http.Request) (*spec.ChangeReport, error) {
+	from := req.FormValue("from")
+	to := req.FormValue("to")
+
+	if to == "" && len(versions) > 0 {
+		to = versions[len(versions)-1]
+	}
+	if from == "" {
+		from = to
+		for i, version := range versions {
+			if version == to && i > 0 {
+				from = versions[i-1]
+			}
+		}
+	}
+
+	return specification.Changes(from, to)
+}
+
+// ---------------------------------------------------------------------------
+// end
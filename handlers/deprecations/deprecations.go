@@ -0,0 +1,61 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+package deprecations
+
+import (
+	"net/http"
+
+	"github.com/UKHomeOffice/dapperdox/logger"
+	"github.com/UKHomeOffice/dapperdox/render"
+	"github.com/UKHomeOffice/dapperdox/spec"
+	"github.com/gorilla/pat"
+)
+
+// ---------------------------------------------------------------------------
+// Register creates routes for the deprecations report of each specification
+func Register(r *pat.Router) {
+	logger.Debugln(nil, "registering handlers for specification deprecations")
+
+	for _, specification := range spec.APISuite {
+		// Routes match by prefix, so the JSON form must be registered first
+		r.Path("/" + specification.ID + "/deprecations.json").Methods("GET").HandlerFunc(deprecationsJSONHandler(specification))
+		r.Path("/" + specification.ID + "/deprecations").Methods("GET").HandlerFunc(deprecationsHandler(specification))
+	}
+}
+
+// ---------------------------------------------------------------------------
+// deprecationsHandler is a http.Handler for the page listing the deprecated elements of a
+// specification
+func deprecationsHandler(specification *spec.APISpecification) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		render.HTML(w, http.StatusOK, "deprecations", render.DefaultVars(req, specification, render.Vars{"Title": "Deprecations",
+			"Report": specification.Deprecations()}))
+	}
+}
+
+// ---------------------------------------------------------------------------
+// deprecationsJSONHandler is a http.Handler for the JSON feed of the deprecated elements of a
+// specification
+func deprecationsJSONHandler(specification *spec.APISpecification) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		render.JSON(w, http.StatusOK, specification.Deprecations())
+	}
+}
+
+// ---------------------------------------------------------------------------
+// end
@@ -19,8 +19,8 @@ package guides
 
 import (
 	//"github.com/davecgh/go-spew/spew"
+	"fmt"
 	"net/http"
-	"os"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -33,10 +33,30 @@ import (
 	"github.com/gorilla/pat"
 )
 
+// NavigationError describes a guide that was left out of the guides navigation
+type NavigationError struct {
+	Guide   string `json:"guide"`
+	Message string `json:"message"`
+}
+
+func (e *NavigationError) Error() string {
+	return e.Guide + ": " + e.Message
+}
+
+var navigationErrors []*NavigationError
+
+// ---------------------------------------------------------------------------
+// Errors returns the problems found by the last call to Register
+func Errors() []*NavigationError {
+	return navigationErrors
+}
+
 // ---------------------------------------------------------------------------
 // Register routes for guide pages
 func Register(r *pat.Router) {
 
+	navigationErrors = nil
+
 	logger.Infof(nil, "Registering guides")
 
 	// specification specific guides
@@ -88,7 +108,11 @@ func register(r *pat.Router, base string, specification *spec.APISpecification)
 
 			logger.Tracef(nil, "      = URL  "+route)
 
-			buildNavigation(guidesNavigation, path, path_base, route, ext)
+			if err := buildNavigation(guidesNavigation, path, path_base, route, ext); err != nil {
+				logger.Errorf(nil, "Error: %s", err)
+				navigationErrors = append(navigationErrors, err)
+				continue
+			}
 
 			r.Path(route).Methods("GET").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 				sid := "TOP LEVEL"
@@ -168,7 +192,7 @@ func StripBasepathAndExtension(name string, basepath string) string {
 }
 
 // ---------------------------------------------------------------------------
-func buildNavigation(nav *navigation.NavigationNode, path string, path_base string, route string, ext string) {
+func buildNavigation(nav *navigation.NavigationNode, path string, path_base string, route string, ext string) *NavigationError {
 
 	logger.Tracef(nil, "      - Look for metadata asset %s\n", path)
 
@@ -189,8 +213,7 @@ func buildNavigation(nav *navigation.NavigationNode, path string, path_base stri
 	parts := len(split)
 
 	if parts > 2 {
-		logger.Errorf(nil, "Error: Guide '"+hierarchy+"' contains too many nagivation levels (%d)", parts)
-		os.Exit(1)
+		return &NavigationError{Guide: path, Message: fmt.Sprintf("navigation '%s' contains too many levels (%d), the maximum is 2", hierarchy, parts)}
 	}
 
 	if sortOrder == "" {
@@ -254,6 +277,7 @@ func buildNavigation(nav *navigation.NavigationNode, path string, path_base stri
 			}
 		}
 	}
+	return nil
 }
 
 // ---------------------------------------------------------------------------
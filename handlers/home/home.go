@@ -61,6 +61,8 @@ func Register(r *pat.Router) {
 	} else {
 		r.Path("/").Methods("GET").HandlerFunc(specificationListHandler)
 	}
+
+	r.Path("/diagnostics").Methods("GET").HandlerFunc(diagnosticsHandler(spec.Diagnostics))
 }
 
 // ----------------------------------------------------------------------------------------
@@ -71,20 +73,31 @@ func specificationListHandler(w http.ResponseWriter, req *http.Request) {
 	render.HTML(w, http.StatusOK, "specification_list", render.DefaultVars(req, nil, render.Vars{"Title": "Specifications list", "SpecificationList": true}))
 }
 
+// ----------------------------------------------------------------------------------------
+// diagnosticsHandler is a http.Handler for the page listing the problems found while loading
+// the specifications
+func diagnosticsHandler(diagnostics []spec.Diagnostic) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		logger.Tracef(nil, "Render HTML for specification diagnostics page")
+
+		render.HTML(w, http.StatusOK, "diagnostics", render.DefaultVars(req, nil, render.Vars{"Title": "Specification diagnostics", "Diagnostics": diagnostics}))
+	}
+}
+
 // ----------------------------------------------------------------------------------------
 func specificationSummaryHandler(specification *spec.APISpecification) func(w http.ResponseWriter, req *http.Request) {
 
-	// The default "theme" level reference index page.
-	tmpl := "specification_summary"
+	return func(w http.ResponseWriter, req *http.Request) {
+		// The default "theme" level reference index page.
+		tmpl := "specification_summary"
 
-	customTmpl := specification.ID + "/specification_summary"
+		customTmpl := specification.ID + "/specification_summary"
 
-	logger.Tracef(nil, "+ Test for template '%s'", customTmpl)
+		logger.Tracef(nil, "+ Test for template '%s'", customTmpl)
 
-	if render.TemplateLookup(customTmpl) != nil {
-		tmpl = customTmpl
-	}
-	return func(w http.ResponseWriter, req *http.Request) {
+		if render.TemplateLookup(customTmpl) != nil {
+			tmpl = customTmpl
+		}
 		render.HTML(w, http.StatusOK, tmpl, render.DefaultVars(req, specification, render.Vars{"Title": "Specification summary", "SpecificationSummary": true}))
 	}
 }
@@ -0,0 +1,434 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+package oauth2
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/UKHomeOffice/dapperdox/config"
+	"github.com/UKHomeOffice/dapperdox/logger"
+	"github.com/UKHomeOffice/dapperdox/reload"
+	"github.com/UKHomeOffice/dapperdox/render"
+	"github.com/UKHomeOffice/dapperdox/spec"
+	"github.com/gorilla/pat"
+)
+
+// CallbackPath is the path the authorization server redirects back to, below the site-url.
+// It is the redirect URI to register for each oauth2-client.
+const CallbackPath = "oauth2/callback"
+
+// authorizationTimeout is how long a user has to authorise at the authorization server
+const authorizationTimeout = 10 * time.Minute
+
+// stateCookie ties an authorization to the browser that started it, holding a hash of its
+// state, so that a callback carrying someone else's code is refused (RFC 6749 section 10.12)
+const stateCookie = "dapperdox_oauth2_state"
+
+// client is the OAuth2 client DapperDox acts as, to obtain access tokens for the API explorer
+// through one security scheme of a specification.
+type client struct {
+	specification *spec.APISpecification
+	scheme        string
+	id            string
+	secret        string
+	flows         []spec.OAuth2Flow
+}
+
+// authorization is an authorization code flow in progress, keyed by its state.
+type authorization struct {
+	client   *client
+	flow     spec.OAuth2Flow
+	verifier string // The PKCE code verifier
+	scopes   string
+	returnTo string // The page to return to once authorised
+	expires  time.Time
+}
+
+// token is the part of a token endpoint response given to the API explorer. A refresh token
+// is deliberately not passed on.
+type token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type,omitempty"`
+	ExpiresIn   int64  `json:"expires_in,omitempty"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// tokenError is the error response of a token endpoint.
+type tokenError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+var (
+	authorizations = make(map[string]*authorization)
+	mutex          sync.Mutex
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// ---------------------------------------------------------------------------
+// Register creates routes through which the API explorer obtains access tokens for each
+// OAuth2 security scheme that has an oauth2-client.
+func Register(r *pat.Router) {
+	logger.Debugln(nil, "registering handlers for OAuth2 clients")
+
+	cfg, _ := config.Get() // Don't worry about error. If there was something wrong with the config, we'd know by now.
+
+	registered := false
+	for _, specification := range spec.APISuite {
+		for name, configured := range cfg.OAuth2Clients(specification.ID) {
+			scheme, ok := specification.SecurityDefinitions[name]
+			if !ok || !scheme.IsOAuth2 {
+				logger.Errorf(nil, "OAuth2 client for %s:%s not added: %s is not an OAuth2 security scheme of the specification", specification.ID, name, name)
+				continue
+			}
+
+			c := &client{specification: specification, scheme: name, id: configured.ID, flows: scheme.Flows}
+			if configured.Secret != "" {
+				secret, err := config.ReadSecret(configured.Secret)
+				if err != nil {
+					logger.Errorf(nil, "OAuth2 client for %s:%s not added: %s", specification.ID, name, err)
+					continue
+				}
+				logger.Redact(secret)
+				logger.Redact(url.QueryEscape(secret))
+				c.secret = secret
+			}
+
+			path := "/" + specification.ID + "/oauth2/" + name
+			logger.Printf(nil, "OAuth2 client %s for %s:%s at %s", c.id, specification.ID, name, path)
+
+			r.Path(path + "/authorize").Methods("GET").HandlerFunc(authorizeHandler(c))
+			r.Path(path + "/token").Methods("POST").HandlerFunc(tokenHandler(c))
+			registered = true
+		}
+	}
+
+	if registered {
+		r.Path("/" + CallbackPath).Methods("GET").HandlerFunc(callbackHandler)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// authorizeHandler starts the authorization code flow, with PKCE, redirecting the browser
+// to the authorization server.
+func authorizeHandler(c *client) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		flow, ok := c.flow("authorizationCode", "accessCode")
+		if !ok {
+			c.error(w, req, http.StatusNotFound, "The "+c.scheme+" security scheme has no authorization code flow")
+			return
+		}
+		scopes, err := selectScopes(flow, req.FormValue("scope"))
+		if err != nil {
+			c.error(w, req, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		state := randomString()
+		verifier := randomString()
+		returnTo := req.FormValue("return")
+		if !isLocalPath(returnTo) {
+			returnTo = "/" + c.specification.ID
+		}
+
+		mutex.Lock()
+		now := time.Now()
+		for s, a := range authorizations {
+			if now.After(a.expires) {
+				delete(authorizations, s)
+			}
+		}
+		authorizations[state] = &authorization{
+			client:   c,
+			flow:     flow,
+			verifier: verifier,
+			scopes:   scopes,
+			returnTo: returnTo,
+			expires:  now.Add(authorizationTimeout),
+		}
+		mutex.Unlock()
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     stateCookie,
+			Value:    hash(state),
+			Path:     callbackURL().Path,
+			MaxAge:   int(authorizationTimeout / time.Second),
+			Secure:   callbackURL().Scheme == "https",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode, // Sent on the redirect back from the authorization server
+		})
+
+		query := url.Values{}
+		query.Set("response_type", "code")
+		query.Set("client_id", c.id)
+		query.Set("redirect_uri", redirectURI())
+		query.Set("state", state)
+		query.Set("code_challenge", hash(verifier)) // S256
+		query.Set("code_challenge_method", "S256")
+		if scopes != "" {
+			query.Set("scope", scopes)
+		}
+
+		location := flow.AuthorizationUrl
+		if strings.Contains(location, "?") {
+			location += "&" + query.Encode()
+		} else {
+			location += "?" + query.Encode()
+		}
+		http.Redirect(w, req, location, http.StatusFound)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// callbackHandler completes the authorization code flow, exchanging the code for an access
+// token and returning it to the page the user started from.
+func callbackHandler(w http.ResponseWriter, req *http.Request) {
+	state := req.FormValue("state")
+
+	cookie, err := req.Cookie(stateCookie)
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: callbackURL().Path, MaxAge: -1})
+
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(hash(state))) != 1 {
+		render.HTML(w, http.StatusBadRequest, "error", render.DefaultVars(req, nil, render.Vars{"error": "The authorisation was not started by this browser", "code": 400}))
+		return
+	}
+
+	mutex.Lock()
+	a, ok := authorizations[state]
+	delete(authorizations, state)
+	mutex.Unlock()
+
+	if !ok || time.Now().After(a.expires) {
+		render.HTML(w, http.StatusBadRequest, "error", render.DefaultVars(req, nil, render.Vars{"error": "The authorisation has expired, or was not started by this server", "code": 400}))
+		return
+	}
+	c := a.client
+
+	if e := req.FormValue("error"); e != "" {
+		if d := req.FormValue("error_description"); d != "" {
+			e += ": " + d
+		}
+		c.error(w, req, http.StatusForbidden, "Authorisation was refused: "+e)
+		return
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", req.FormValue("code"))
+	form.Set("redirect_uri", redirectURI())
+	form.Set("code_verifier", a.verifier)
+
+	reacquire := reload.Release(req) // Not holding up a rebuild while the token endpoint responds
+	t, err := c.requestToken(a.flow.TokenUrl, form)
+	reacquire()
+	if err != nil {
+		logger.Warnf(req, "OAuth2 token request for %s:%s failed: %s", c.specification.ID, c.scheme, err)
+		c.error(w, req, http.StatusBadGateway, err.Error())
+		return
+	}
+	if t.Scope == "" {
+		t.Scope = a.scopes
+	}
+
+	render.HTML(w, http.StatusOK, "oauth2_callback", render.DefaultVars(req, c.specification, render.Vars{"Title": "Authorised",
+		"Scheme": c.scheme, "Token": t, "Return": a.returnTo}))
+}
+
+// ---------------------------------------------------------------------------
+// tokenHandler obtains an access token through the client credentials flow, returning it as
+// JSON. The client secret never leaves the server.
+func tokenHandler(c *client) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		flow, ok := c.flow("clientCredentials", "application")
+		if !ok || c.secret == "" {
+			render.JSON(w, http.StatusNotFound, tokenError{Error: "unsupported_grant_type",
+				Description: "The " + c.scheme + " security scheme has no client credentials flow with a client secret"})
+			return
+		}
+		scopes, err := selectScopes(flow, req.FormValue("scope"))
+		if err != nil {
+			render.JSON(w, http.StatusBadRequest, tokenError{Error: "invalid_scope", Description: err.Error()})
+			return
+		}
+
+		form := url.Values{}
+		form.Set("grant_type", "client_credentials")
+		if scopes != "" {
+			form.Set("scope", scopes)
+		}
+
+		reacquire := reload.Release(req)
+		t, err := c.requestToken(flow.TokenUrl, form)
+		reacquire()
+		if err != nil {
+			logger.Warnf(req, "OAuth2 token request for %s:%s failed: %s", c.specification.ID, c.scheme, err)
+			render.JSON(w, http.StatusBadGateway, tokenError{Error: "server_error", Description: err.Error()})
+			return
+		}
+		if t.Scope == "" {
+			t.Scope = scopes
+		}
+
+		render.JSON(w, http.StatusOK, t)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// requestToken posts a token request to the token endpoint, authenticating the client with
+// HTTP Basic authentication when it has a secret.
+func (c *client) requestToken(tokenURL string, form url.Values) (*token, error) {
+	if c.secret == "" {
+		form.Set("client_id", c.id)
+	}
+
+	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.secret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.id), url.QueryEscape(c.secret))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var e tokenError
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			if e.Description != "" {
+				return nil, fmt.Errorf("token endpoint refused the request: %s: %s", e.Error, e.Description)
+			}
+			return nil, fmt.Errorf("token endpoint refused the request: %s", e.Error)
+		}
+		return nil, fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+
+	var t token
+	if err := json.Unmarshal(body, &t); err != nil {
+		return nil, fmt.Errorf("token endpoint response is not JSON: %s", err)
+	}
+	if t.AccessToken == "" {
+		return nil, fmt.Errorf("token endpoint response has no access_token")
+	}
+	return &t, nil
+}
+
+// ---------------------------------------------------------------------------
+// flow returns the first of the scheme's flows with one of the names, as they differ between
+// Swagger 2 and OpenAPI 3.
+func (c *client) flow(names ...string) (spec.OAuth2Flow, bool) {
+	for _, f := range c.flows {
+		for _, name := range names {
+			if f.Flow == name {
+				return f, true
+			}
+		}
+	}
+	return spec.OAuth2Flow{}, false
+}
+
+// error renders the error page for a failed flow.
+func (c *client) error(w http.ResponseWriter, req *http.Request, status int, message string) {
+	render.HTML(w, status, "error", render.DefaultVars(req, c.specification, render.Vars{"error": message, "code": status}))
+}
+
+// ---------------------------------------------------------------------------
+// selectScopes checks the space separated scopes requested are documented for the flow,
+// returning them space separated.
+func selectScopes(flow spec.OAuth2Flow, requested string) (string, error) {
+	scopes := strings.Fields(requested)
+	for _, s := range scopes {
+		if _, ok := flow.Scopes[s]; !ok {
+			return "", fmt.Errorf("Scope %q is not documented for the %s flow", s, flow.Flow)
+		}
+	}
+	return strings.Join(scopes, " "), nil
+}
+
+// isLocalPath reports whether a path is on this server, so that it is safe to return to.
+// Browsers drop tabs and newlines from a URL and treat a backslash as a slash, so a path
+// holding either could become a scheme-relative URL such as //evil.example.
+func isLocalPath(path string) bool {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.Contains(path, "\\") {
+		return false
+	}
+	for _, r := range path {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	u, err := url.Parse(path)
+	return err == nil && u.Scheme == "" && u.Host == "" && u.User == nil
+}
+
+// redirectURI is the callback URL given to the authorization server.
+func redirectURI() string {
+	cfg, _ := config.Get()
+	return strings.TrimSuffix(cfg.SiteURL, "/") + "/" + CallbackPath
+}
+
+// callbackURL is the parsed redirectURI, whose path the state cookie is limited to.
+func callbackURL() *url.URL {
+	u, err := url.Parse(redirectURI())
+	if err != nil {
+		return &url.URL{Path: "/" + CallbackPath}
+	}
+	return u
+}
+
+// hash returns the SHA-256 hash of a value, base64url encoded.
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// randomString returns 32 random bytes, base64url encoded, as used for the state and a PKCE
+// code verifier.
+func randomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ---------------------------------------------------------------------------
+// end
@@ -0,0 +1,334 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/UKHomeOffice/dapperdox/config"
+	"github.com/UKHomeOffice/dapperdox/render"
+	"github.com/UKHomeOffice/dapperdox/spec"
+	unrolled "github.com/unrolled/render"
+)
+
+const secret = "s3cret&key"
+
+// tokenRequest is a request received by the stub authorization server.
+type tokenRequest struct {
+	form     url.Values
+	user     string
+	password string
+	basic    bool
+}
+
+// authorizationServer is a stub token endpoint, which records each request and issues a
+// token along with a refresh token.
+type authorizationServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests []tokenRequest
+}
+
+func newAuthorizationServer() *authorizationServer {
+	s := &authorizationServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		user, password, basic := req.BasicAuth()
+
+		s.mutex.Lock()
+		s.requests = append(s.requests, tokenRequest{form: req.PostForm, user: user, password: password, basic: basic})
+		s.mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "issued-token",
+			"token_type":    "Bearer",
+			"refresh_token": "refresh-token",
+		})
+	}))
+	return s
+}
+
+func (s *authorizationServer) last(t *testing.T) tokenRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.requests) == 0 {
+		t.Fatal(`No token request received`)
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+// setup renders with stub templates, and returns a client of the stub authorization server
+// with authorization code and client credentials flows.
+func setup(t *testing.T, server *authorizationServer) *client {
+	config.Get() // Fails the first time under test, on the test flags, but is then configured
+
+	dir, err := ioutil.TempDir("", "oauth2")
+	if err != nil {
+		t.Fatal(`Failed to create templates` + err.Error())
+	}
+	templates := map[string]string{
+		"oauth2_callback.tmpl": `{{ .Token.AccessToken }} {{ .Token.Scope }} {{ .Return }}`,
+		"error.tmpl":           `{{ .error }}`,
+	}
+	for name, content := range templates {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(`Failed to create templates` + err.Error())
+		}
+	}
+	render.Render = unrolled.New(unrolled.Options{Directory: dir})
+	os.RemoveAll(dir) // Templates are read as they are compiled
+
+	scopes := map[string]string{"read": "Read pets", "write": "Write pets"}
+	return &client{
+		specification: &spec.APISpecification{ID: "petstore"},
+		scheme:        "petstore_auth",
+		id:            "explorer",
+		secret:        secret,
+		flows: []spec.OAuth2Flow{
+			{Flow: "authorizationCode", AuthorizationUrl: "https://auth.example.com/authorize", TokenUrl: server.URL, Scopes: scopes},
+			{Flow: "clientCredentials", TokenUrl: server.URL, Scopes: scopes},
+		},
+	}
+}
+
+// authorize starts the authorization code flow, returning the query of the redirect to the
+// authorization server and the state cookie.
+func authorize(t *testing.T, c *client, query string) (url.Values, *http.Cookie) {
+	w := httptest.NewRecorder()
+	authorizeHandler(c)(w, httptest.NewRequest("GET", "/petstore/oauth2/petstore_auth/authorize?"+query, nil))
+
+	if w.Code != http.StatusFound {
+		t.Fatalf(`Authorize fail: %d %s`, w.Code, w.Body.String())
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(`Failed to parse redirect` + err.Error())
+	}
+	cookies := (&http.Response{Header: w.Header()}).Cookies()
+	if len(cookies) != 1 || cookies[0].Name != stateCookie {
+		t.Fatalf(`State cookie fail: %v`, cookies)
+	}
+	return location.Query(), cookies[0]
+}
+
+// callback returns from the authorization server with a code, and the cookie if given.
+func callback(state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/"+CallbackPath+"?code=granted&state="+url.QueryEscape(state), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	callbackHandler(w, req)
+	return w
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+
+	server := newAuthorizationServer()
+	defer server.Close()
+	c := setup(t, server)
+
+	query, cookie := authorize(t, c, "scope=read+write&return=/petstore/reference/pets")
+
+	if query.Get("client_id") != "explorer" || query.Get("response_type") != "code" ||
+		query.Get("redirect_uri") != "http://localhost:3123/oauth2/callback" || query.Get("scope") != "read write" {
+		t.Errorf(`Authorize query fail: %v`, query)
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Errorf(`Code challenge fail: %v`, query)
+	}
+	if cookie.Value != hash(query.Get("state")) || !cookie.HttpOnly || cookie.Path != "/oauth2/callback" {
+		t.Errorf(`State cookie fail: %v`, cookie)
+	}
+
+	w := callback(query.Get("state"), cookie)
+
+	if w.Code != http.StatusOK || w.Body.String() != "issued-token read write /petstore/reference/pets" {
+		t.Fatalf(`Callback fail: %d %s`, w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "refresh-token") {
+		t.Errorf(`Refresh token passed on: %s`, w.Body.String())
+	}
+
+	r := server.last(t)
+	if r.form.Get("grant_type") != "authorization_code" || r.form.Get("code") != "granted" ||
+		r.form.Get("redirect_uri") != "http://localhost:3123/oauth2/callback" {
+		t.Errorf(`Token request fail: %v`, r.form)
+	}
+	if verifier := r.form.Get("code_verifier"); verifier == "" || hash(verifier) != query.Get("code_challenge") {
+		t.Errorf(`Code verifier %q does not match challenge %q`, verifier, query.Get("code_challenge"))
+	}
+}
+
+func TestStateIsTiedToBrowserAndUsedOnce(t *testing.T) {
+
+	server := newAuthorizationServer()
+	defer server.Close()
+	c := setup(t, server)
+
+	query, cookie := authorize(t, c, "")
+	if w := callback(query.Get("state"), nil); w.Code != http.StatusBadRequest {
+		t.Errorf(`Missing cookie fail: %d`, w.Code)
+	}
+	_, other := authorize(t, c, "")
+	if w := callback(query.Get("state"), other); w.Code != http.StatusBadRequest {
+		t.Errorf(`Other browser's cookie fail: %d`, w.Code)
+	}
+
+	if w := callback(query.Get("state"), cookie); w.Code != http.StatusOK {
+		t.Errorf(`Callback fail: %d %s`, w.Code, w.Body.String())
+	}
+	if w := callback(query.Get("state"), cookie); w.Code != http.StatusBadRequest {
+		t.Errorf(`Replayed state fail: %d`, w.Code)
+	}
+
+	query, cookie = authorize(t, c, "")
+	mutex.Lock()
+	authorizations[query.Get("state")].expires = time.Now().Add(-time.Second)
+	mutex.Unlock()
+
+	if w := callback(query.Get("state"), cookie); w.Code != http.StatusBadRequest {
+		t.Errorf(`Expired state fail: %d`, w.Code)
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if len(server.requests) != 1 {
+		t.Errorf(`Token requests fail: %d`, len(server.requests))
+	}
+}
+
+func TestRejectsUndocumentedScopes(t *testing.T) {
+
+	server := newAuthorizationServer()
+	defer server.Close()
+	c := setup(t, server)
+
+	w := httptest.NewRecorder()
+	authorizeHandler(c)(w, httptest.NewRequest("GET", "/petstore/oauth2/petstore_auth/authorize?scope=read+admin", nil))
+	if w.Code != http.StatusBadRequest || w.Header().Get("Location") != "" {
+		t.Errorf(`Authorize scope fail: %d %q`, w.Code, w.Header().Get("Location"))
+	}
+
+	w = httptest.NewRecorder()
+	tokenHandler(c)(w, httptest.NewRequest("POST", "/petstore/oauth2/petstore_auth/token?scope=admin", nil))
+
+	var e tokenError
+	if w.Code != http.StatusBadRequest || json.Unmarshal(w.Body.Bytes(), &e) != nil || e.Error != "invalid_scope" {
+		t.Errorf(`Token scope fail: %d %s`, w.Code, w.Body.String())
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if len(server.requests) != 0 {
+		t.Errorf(`Token requested for undocumented scope: %d`, len(server.requests))
+	}
+}
+
+func TestClientSecretIsSentOnlyByBasicAuth(t *testing.T) {
+
+	server := newAuthorizationServer()
+	defer server.Close()
+	c := setup(t, server)
+
+	w := httptest.NewRecorder()
+	tokenHandler(c)(w, httptest.NewRequest("POST", "/petstore/oauth2/petstore_auth/token?scope=read", nil))
+
+	var tok token
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &tok) != nil || tok.AccessToken != "issued-token" || tok.Scope != "read" {
+		t.Fatalf(`Token fail: %d %s`, w.Code, w.Body.String())
+	}
+
+	r := server.last(t)
+	if !r.basic || r.user != "explorer" || r.password != url.QueryEscape(secret) {
+		t.Errorf(`Basic auth fail: %q %q`, r.user, r.password)
+	}
+	if r.form.Get("grant_type") != "client_credentials" || r.form.Get("scope") != "read" {
+		t.Errorf(`Token request fail: %v`, r.form)
+	}
+	for name, values := range r.form {
+		if name == "client_secret" || strings.Contains(strings.Join(values, " "), secret) {
+			t.Errorf(`Secret sent in form: %s`, name)
+		}
+	}
+
+	query, cookie := authorize(t, c, "")
+	if strings.Contains(query.Encode(), "secret") {
+		t.Errorf(`Secret sent to browser: %v`, query)
+	}
+	callback(query.Get("state"), cookie)
+	if r := server.last(t); !r.basic || r.form.Get("client_id") != "" || r.form.Get("client_secret") != "" {
+		t.Errorf(`Callback token request fail: %v`, r.form)
+	}
+
+	for _, body := range []string{w.Body.String(), callback("", nil).Body.String()} {
+		if strings.Contains(body, secret) || strings.Contains(body, url.QueryEscape(secret)) || strings.Contains(body, "refresh-token") {
+			t.Errorf(`Secret in response: %s`, body)
+		}
+	}
+}
+
+func TestPublicClientSendsClientID(t *testing.T) {
+
+	server := newAuthorizationServer()
+	defer server.Close()
+	c := setup(t, server)
+	c.secret = ""
+
+	query, cookie := authorize(t, c, "")
+	if w := callback(query.Get("state"), cookie); w.Code != http.StatusOK {
+		t.Fatalf(`Callback fail: %d %s`, w.Code, w.Body.String())
+	}
+	if r := server.last(t); r.basic || r.form.Get("client_id") != "explorer" {
+		t.Errorf(`Public client fail: %v %v`, r.basic, r.form)
+	}
+
+	w := httptest.NewRecorder()
+	tokenHandler(c)(w, httptest.NewRequest("POST", "/petstore/oauth2/petstore_auth/token", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf(`Client credentials without secret fail: %d`, w.Code)
+	}
+}
+
+func TestIsLocalPath(t *testing.T) {
+
+	tests := []struct {
+		path  string
+		local bool
+	}{
+		{"/petstore", true},
+		{"/petstore/reference/pets?tab=1#list", true},
+		{"", false},
+		{"petstore", false},
+		{"//evil.example", false},
+		{"/\\evil.example", false},
+		{"/\t/evil.example", false},
+		{"/\n/evil.example", false},
+		{"/\r/evil.example", false},
+		{"https://evil.example/", false},
+		{"javascript:alert(1)", false},
+	}
+	for _, test := range tests {
+		if isLocalPath(test.path) != test.local {
+			t.Errorf(`isLocalPath(%q) fail: %v`, test.path, !test.local)
+		}
+	}
+
+	server := newAuthorizationServer()
+	defer server.Close()
+	c := setup(t, server)
+
+	query, cookie := authorize(t, c, "return=/%09/evil.example")
+	if w := callback(query.Get("state"), cookie); !strings.HasSuffix(w.Body.String(), " /petstore") {
+		t.Errorf(`Return fallback fail: %s`, w.Body.String())
+	}
+}
@@ -30,15 +30,12 @@ import (
 type versionedMethod map[string]spec.Method      // key is version
 type versionedResource map[string]*spec.Resource // key is version
 
-var pathVersionMethod map[string]versionedMethod     // Key is path
-var pathVersionResource map[string]versionedResource // Key is path
-
 // Register creates routes for specification resource
 func Register(r *pat.Router) {
 	logger.Infof(nil, "Registering reference documentation")
 
-	pathVersionMethod = make(map[string]versionedMethod)
-	pathVersionResource = make(map[string]versionedResource)
+	pathVersionMethod := make(map[string]versionedMethod)     // Key is path
+	pathVersionResource := make(map[string]versionedResource) // Key is path
 
 	// Loop for all APISpecification's in the APISuite
 	for _, specification := range spec.APISuite {
@@ -62,7 +59,7 @@ func Register(r *pat.Router) {
 				// Add version->method to pathVersionMethod
 				if _, ok := pathVersionMethod[path]; !ok {
 					pathVersionMethod[path] = make(versionedMethod)
-					r.Path(path).Methods("GET").HandlerFunc(MethodHandler(specification, api, path))
+					r.Path(path).Methods("GET").HandlerFunc(MethodHandler(specification, api, pathVersionMethod[path]))
 				}
 				pathVersionMethod[path][version] = method
 			}
@@ -73,7 +70,7 @@ func Register(r *pat.Router) {
 					// Add version->resource to pathVersionResource
 					if _, ok := pathVersionMethod[path]; !ok {
 						pathVersionMethod[path] = make(versionedMethod)
-						r.Path(path).Methods("GET").HandlerFunc(MethodHandler(specification, api, path))
+						r.Path(path).Methods("GET").HandlerFunc(MethodHandler(specification, api, pathVersionMethod[path]))
 					}
 					pathVersionMethod[path][version] = method
 				}
@@ -88,7 +85,7 @@ func Register(r *pat.Router) {
 				logger.Debugf(nil, "      + resource %s", id)
 				if _, ok := pathVersionResource[path]; !ok {
 					pathVersionResource[path] = make(versionedResource)
-					r.Path(path).Methods("GET").HandlerFunc(GlobalResourceHandler(specification, path))
+					r.Path(path).Methods("GET").HandlerFunc(GlobalResourceHandler(specification, pathVersionResource[path]))
 				}
 				pathVersionResource[path][version] = resource
 			}
@@ -117,45 +114,87 @@ func getMethodVersions(api spec.APIGroup, versions versionedMethod) []string {
 	if len(api.Versions) < 2 {
 		return nil
 	}
-	keys := make([]string, len(versions))
-	ix := 0
+	return methodVersionList(versions)
+}
+
+func methodVersionList(versions versionedMethod) []string {
+	keys := make([]string, 0, len(versions))
 	for key := range versions {
-		keys[ix] = key
-		ix++
+		keys = append(keys, key)
 	}
-	return keys
+	return spec.NewestFirst(keys)
 }
 
 // ------------------------------------------------------------------------------------------------------------
 
 func getAPIVersions(api spec.APIGroup) []string {
-	count := len(api.Versions)
-	if count < 2 {
+	if len(api.Versions) < 2 {
 		return nil // There is only one version defined
 	}
-	keys := make([]string, count)
-	ix := 0
+	return apiVersionList(api)
+}
+
+func apiVersionList(api spec.APIGroup) []string {
+	keys := make([]string, 0, len(api.Versions))
 	for key := range api.Versions {
-		keys[ix] = key
-		ix++
+		keys = append(keys, key)
 	}
-	return keys
+	return spec.NewestFirst(keys)
 }
 
 // ------------------------------------------------------------------------------------------------------------
 
-func getResourceVersions(api spec.APIGroup, versions versionedResource) []string {
-	// See how many versions there are accross the whole API. If 1, then version selection is not required.
-	if len(api.Versions) < 2 {
+func getResourceVersions(versions versionedResource) []string {
+	// There is more than one version (there is always a "latest"), so compile list of those
+	// available for resource. If 1, then version selection is not required.
+	if len(versions) < 2 {
 		return nil
 	}
-	keys := make([]string, len(versions))
-	ix := 0
+	return resourceVersionList(versions)
+}
+
+func resourceVersionList(versions versionedResource) []string {
+	keys := make([]string, 0, len(versions))
 	for key := range versions {
-		keys[ix] = key
-		ix++
+		keys = append(keys, key)
 	}
-	return keys
+	return spec.NewestFirst(keys)
+}
+
+// ------------------------------------------------------------------------------------------------------------
+// missingVersion handles a request for a version of a page that does not exist. If the specification
+// has the version, the page just does not appear in it, and so the request is redirected to the nearest
+// version that the page does appear in. Otherwise the version is unknown, and the page is not found.
+func missingVersion(w http.ResponseWriter, req *http.Request, specification *spec.APISpecification, version string, available []string) {
+
+	_, known := specification.APIVersions[version]
+	if _, ok := specification.ResourceList[version]; ok {
+		known = true
+	}
+
+	if nearest := spec.NearestVersion(version, available); known && nearest != "" {
+		query := req.URL.Query()
+		query.Set("v", nearest)
+		logger.Tracef(req, "-- version %s not found, redirecting to version %s", version, nearest)
+		http.Redirect(w, req, req.URL.Path+"?"+query.Encode(), http.StatusFound)
+		return
+	}
+
+	render.HTML(w, http.StatusNotFound, "error", render.DefaultVars(req, specification, render.Vars{"error": "Version " + version + " not found", "code": 404}))
+}
+
+// ------------------------------------------------------------------------------------------------------------
+// currentResourceVersion is the current version of the specification, if the resource has it,
+// or otherwise the newest version of the resource.
+func currentResourceVersion(specification *spec.APISpecification, versions versionedResource) string {
+	if _, ok := versions[specification.CurrentVersion]; ok {
+		return specification.CurrentVersion
+	}
+	keys := resourceVersionList(versions)
+	if len(keys) == 0 {
+		return spec.LatestVersion
+	}
+	return keys[0]
 }
 
 // ------------------------------------------------------------------------------------------------------------
@@ -167,6 +206,10 @@ func APIHandler(specification *spec.APISpecification, api spec.APIGroup) func(w
 		if version == "" {
 			version = api.CurrentVersion
 		}
+		if _, ok := api.Versions[version]; !ok && len(api.Versions) > 0 {
+			missingVersion(w, req, specification, version, apiVersionList(api))
+			return
+		}
 		versions := getAPIVersions(api)
 		methods := getVersionMethod(api, version)
 
@@ -180,21 +223,26 @@ func APIHandler(specification *spec.APISpecification, api spec.APIGroup) func(w
 
 		render.HTML(w, http.StatusOK, tmpl, render.DefaultVars(req, specification, render.Vars{"Title": api.Name,
 			"TitleSuffix": api.Description, "API": api, "ExternalDocs": api.ExternalDocs, "Methods": methods,
-			"Version": version, "Versions": versions, "LatestVersion": api.CurrentVersion}))
+			"Version": version, "Versions": versions, "LatestVersion": api.CurrentVersion,
+			"VersionStatus": specification.VersionStatus(version)}))
 	}
 }
 
 // ------------------------------------------------------------------------------------------------------------
 // MethodHandler is a http.Handler for rendering API method reference docs
-func MethodHandler(specification *spec.APISpecification, api spec.APIGroup, path string) func(w http.ResponseWriter, req *http.Request) {
+func MethodHandler(specification *spec.APISpecification, api spec.APIGroup, versionMethod versionedMethod) func(w http.ResponseWriter, req *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
 
 		version := req.FormValue("v") // Get the resource version
 		if version == "" {
 			version = api.CurrentVersion
 		}
-		versions := getMethodVersions(api, pathVersionMethod[path])
-		method := pathVersionMethod[path][version]
+		method, ok := versionMethod[version]
+		if !ok {
+			missingVersion(w, req, specification, version, methodVersionList(versionMethod))
+			return
+		}
+		versions := getMethodVersions(api, versionMethod)
 
 		tmpl := "method"
 		customTmpl := "reference/" + api.ID + "/" + method.ID
@@ -204,42 +252,30 @@ func MethodHandler(specification *spec.APISpecification, api spec.APIGroup, path
 
 		logger.Tracef(nil, "-- template: %s  Version %s", tmpl, version)
 
-		// TODO default to latest if version not found, or 404 ?
-		method = pathVersionMethod[path][version]
-
 		//logger.Debugf(nil, "Method versions:\n")
 		//spew.Dump(versions)
 
-		render.HTML(w, http.StatusOK, tmpl, render.DefaultVars(req, specification, render.Vars{"Title": method.Name, "API": api, "Method": method, "Version": version, "Versions": versions, "LatestVersion": api.CurrentVersion}))
+		render.HTML(w, http.StatusOK, tmpl, render.DefaultVars(req, specification, render.Vars{"Title": method.Name, "API": api, "Method": method, "Version": version, "Versions": versions, "LatestVersion": api.CurrentVersion,
+			"VersionStatus": specification.VersionStatus(version)}))
 	}
 }
 
 // ------------------------------------------------------------------------------------------------------------
 // ResourceHandler is a http.Handler for rendering API resource reference docs
-func GlobalResourceHandler(specification *spec.APISpecification, path string) func(w http.ResponseWriter, req *http.Request) {
+func GlobalResourceHandler(specification *spec.APISpecification, versionResource versionedResource) func(w http.ResponseWriter, req *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
 
-		version := req.FormValue("v") // Get the resource version - blank is the latest
+		version := req.FormValue("v") // Get the resource version - blank is the current version
 		if version == "" {
-			version = "latest"
+			version = currentResourceVersion(specification, versionResource)
 		}
 
-		// Get list of versions
-		var versions []string
-		ix := 0
-		versionList := pathVersionResource[path]
-
-		if len(versionList) > 1 {
-			// There is more than one version (there is always a "latest"), so
-			// compile list of those available for resource
-			versions = make([]string, len(pathVersionResource[path]))
-			for key := range versionList {
-				versions[ix] = key
-				ix++
-			}
+		resource, ok := versionResource[version]
+		if !ok {
+			missingVersion(w, req, specification, version, resourceVersionList(versionResource))
+			return
 		}
-
-		resource := pathVersionResource[path][version]
+		versions := getResourceVersions(versionResource)
 
 		logger.Debugf(nil, "Render resource "+resource.ID)
 		tmpl := "resource"
@@ -252,7 +288,8 @@ func GlobalResourceHandler(specification *spec.APISpecification, path string) fu
 
 		logger.Tracef(nil, "-- template: %s  Version %s", tmpl, version)
 
-		render.HTML(w, http.StatusOK, tmpl, render.DefaultVars(req, specification, render.Vars{"Title": resource.Title, "Resource": resource, "Version": version, "Versions": versions}))
+		render.HTML(w, http.StatusOK, tmpl, render.DefaultVars(req, specification, render.Vars{"Title": resource.Title, "Resource": resource, "Version": version, "Versions": versions,
+			"VersionStatus": specification.VersionStatus(version)}))
 	}
 }
 
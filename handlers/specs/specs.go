@@ -26,12 +26,10 @@ import (
 
 	"github.com/UKHomeOffice/dapperdox/config"
 	"github.com/UKHomeOffice/dapperdox/logger"
+	"github.com/UKHomeOffice/dapperdox/spec"
 	"github.com/gorilla/pat"
 )
 
-var specMap map[string][]byte
-var specReplacer *strings.Replacer
-
 // Register creates routes for each static resource
 func Register(r *pat.Router) {
 
@@ -47,27 +45,6 @@ func Register(r *pat.Router) {
 		return
 	}
 
-	// Build a replacer to search/replace specification URLs
-	if specReplacer == nil {
-		var replacements []string
-
-		// Configure the replacer with key=value pairs
-		for i := range cfg.SpecRewriteURL {
-
-			slice := strings.Split(cfg.SpecRewriteURL[i], "=")
-
-			switch len(slice) {
-			case 1: // Map between configured URL and site URL
-				replacements = append(replacements, slice[0], cfg.SiteURL)
-			case 2: // Map between configured to=from URL pair
-				replacements = append(replacements, slice...)
-			default:
-				panic("Invalid DocumentWriteUrl - does not contain an = delimited from=to pair")
-			}
-		}
-		specReplacer = strings.NewReplacer(replacements...)
-	}
-
 	base, err := filepath.Abs(filepath.Clean(cfg.SpecDir))
 	if err != nil {
 		logger.Errorf(nil, "Error forming specification path: %s", err)
@@ -77,7 +54,7 @@ func Register(r *pat.Router) {
 
 	base = filepath.ToSlash(base)
 
-	specMap = make(map[string][]byte)
+	specMap := make(map[string][]byte)
 
 	err = filepath.Walk(base, func(path string, _ os.FileInfo, _ error) error {
 
@@ -102,10 +79,15 @@ func Register(r *pat.Router) {
 			specMap[route], _ = ioutil.ReadFile(path)
 
 			// Replace URLs in document
-			specMap[route] = []byte(specReplacer.Replace(string(specMap[route])))
+			specMap[route] = []byte(spec.SpecReplacer().Replace(string(specMap[route])))
 
+			file := path
 			r.Path(route).Methods("GET").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-				serveSpec(w, route)
+				if req.FormValue("bundle") != "" {
+					serveBundle(w, file, base)
+					return
+				}
+				serveSpec(w, route, specMap[route])
 			})
 		}
 		return nil
@@ -113,11 +95,29 @@ func Register(r *pat.Router) {
 	_ = err
 }
 
-func serveSpec(w http.ResponseWriter, resource string) {
+func serveSpec(w http.ResponseWriter, resource string, document []byte) {
 	logger.Tracef(nil, "Serve file "+resource)
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-control", "public, max-age=259200")
 	w.WriteHeader(200)
-	w.Write(specMap[resource])
+	w.Write(document)
 	return
 }
+
+// serveBundle serves a specification that is split across several files as a single document,
+// in the format of the file.
+func serveBundle(w http.ResponseWriter, path string, base string) {
+	logger.Tracef(nil, "Serve bundle of file "+path)
+
+	document, err := spec.BundleFile(filepath.FromSlash(path), filepath.FromSlash(base))
+	if err != nil {
+		logger.Errorf(nil, "Error bundling specification %s: %s", path, err)
+		http.Error(w, "Specification could not be bundled", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-control", "public, max-age=259200")
+	w.WriteHeader(200)
+	w.Write(document)
+}
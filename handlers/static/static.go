@@ -66,8 +66,11 @@ func Register(r *pat.Router) {
 
 			logger.Debugf(nil, "registering handler for static asset: %s", path)
 
+			// The assets are compiled afresh for each build, so the content served is taken now
+			b, err := asset.Asset("assets/static" + path)
+
 			r.Path(path).Methods("GET").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-				if b, err := asset.Asset("assets/static" + path); err == nil {
+				if err == nil {
 					w.Header().Set("Content-Type", mimeType)
 					w.Header().Set("Cache-control", "public, max-age=259200")
 					w.WriteHeader(200)
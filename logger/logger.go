@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -121,6 +122,10 @@ func Levelf(req *http.Request, level Level, format string, args ...interface{})
 		format = "[%s] [%s] " + format
 	}
 
+	if hasSecrets() {
+		Logf("%s", Redacted(fmt.Sprintf(format, args...)))
+		return
+	}
 	Logf(format, args...)
 }
 
@@ -134,9 +139,56 @@ func Levelln(req *http.Request, level Level, message ...interface{}) {
 		message = append([]interface{}{fmt.Sprintf("[%s] [%s]", getRequestID(req), LevelString[level])}, message...)
 	}
 
+	if hasSecrets() {
+		Logln(Redacted(strings.TrimSuffix(fmt.Sprintln(message...), "\n")))
+		return
+	}
 	Logln(message...)
 }
 
+// -----------------------------------------------------------------------------
+
+var (
+	secrets     []string
+	secretsLock sync.RWMutex
+)
+
+// Redact registers a secret, such as an API key, which is never to be logged. It is replaced
+// in every message by [REDACTED].
+func Redact(secret string) {
+	if secret == "" {
+		return
+	}
+	secretsLock.Lock()
+	defer secretsLock.Unlock()
+
+	for _, s := range secrets {
+		if s == secret {
+			return
+		}
+	}
+	secrets = append(secrets, secret)
+}
+
+// Redacted returns the text with each registered secret replaced by [REDACTED].
+func Redacted(text string) string {
+	secretsLock.RLock()
+	defer secretsLock.RUnlock()
+
+	for _, secret := range secrets {
+		text = strings.Replace(text, secret, "[REDACTED]", -1)
+	}
+	return text
+}
+
+func hasSecrets() bool {
+	secretsLock.RLock()
+	defer secretsLock.RUnlock()
+	return len(secrets) > 0
+}
+
+// -----------------------------------------------------------------------------
+
 // Printf implements log.Printf but includes X-Request-Id
 func Printf(req *http.Request, format string, args ...interface{}) {
 	Levelf(req, Info, format, args...)
@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// capture sends the output of Logf and Logln to the returned builder until restored
+func capture() (*strings.Builder, func()) {
+	var out strings.Builder
+	logf, logln := Logf, Logln
+	Logf = func(format string, args ...interface{}) {
+		fmt.Fprintf(&out, format+"\n", args...)
+	}
+	Logln = func(args ...interface{}) {
+		fmt.Fprintln(&out, args...)
+	}
+	return &out, func() { Logf, Logln = logf, logln }
+}
+
+func TestRedactsSecrets(t *testing.T) {
+
+	const secret = "s3cret key&value"
+	Redact(secret)
+	Redact(url.QueryEscape(secret))
+	Redact("")
+
+	out, restore := capture()
+	defer restore()
+
+	req := httptest.NewRequest("GET", "/api/pets", nil)
+
+	Levelf(nil, Error, "Proxy credential %s rejected", secret)
+	Levelf(req, Error, "Proxy request to: http://api.example.com/pets?api_key=%s", url.QueryEscape(secret))
+	Levelf(req, Error, "Proxy request to: "+secret) // A secret in the format
+	Levelln(nil, Error, "Proxy credential", secret, "rejected")
+	Levelln(req, Error, "Authorization: Bearer", secret)
+	Printf(req, "%v", []string{secret})
+	Println(req, secret)
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 7 {
+		t.Fatalf(`Output fail: %s`, out.String())
+	}
+	for _, line := range lines {
+		if strings.Contains(line, secret) || strings.Contains(line, url.QueryEscape(secret)) || strings.Contains(line, "s3cret") {
+			t.Errorf(`Secret logged: %s`, line)
+		}
+		if !strings.Contains(line, "[REDACTED]") {
+			t.Errorf(`Redaction fail: %s`, line)
+		}
+	}
+}
+
+func TestLogsWithoutSecrets(t *testing.T) {
+
+	out, restore := capture()
+	defer restore()
+
+	Levelf(nil, Error, "%d%% of %s", 50, "requests")
+	Levelln(nil, Error, "plain", "message")
+
+	if out.String() != "50% of requests\nplain message\n" {
+		t.Errorf(`Output fail: %q`, out.String())
+	}
+}
@@ -19,24 +19,32 @@ package main
 
 import (
 	"log"
-	"net"
 	"net/http"
 	"os"
-	"sync"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/UKHomeOffice/dapperdox/config"
+	"github.com/UKHomeOffice/dapperdox/diff"
+	"github.com/UKHomeOffice/dapperdox/handlers/changes"
+	"github.com/UKHomeOffice/dapperdox/handlers/deprecations"
 	"github.com/UKHomeOffice/dapperdox/handlers/guides"
 	"github.com/UKHomeOffice/dapperdox/handlers/home"
+	"github.com/UKHomeOffice/dapperdox/handlers/oauth2"
 	"github.com/UKHomeOffice/dapperdox/handlers/reference"
 	"github.com/UKHomeOffice/dapperdox/handlers/specs"
 	"github.com/UKHomeOffice/dapperdox/handlers/static"
 	"github.com/UKHomeOffice/dapperdox/handlers/timeout"
 	"github.com/UKHomeOffice/dapperdox/logger"
+	"github.com/UKHomeOffice/dapperdox/mock"
 	"github.com/UKHomeOffice/dapperdox/network"
 	"github.com/UKHomeOffice/dapperdox/proxy"
+	"github.com/UKHomeOffice/dapperdox/reload"
 	"github.com/UKHomeOffice/dapperdox/render"
+	"github.com/UKHomeOffice/dapperdox/render/asset"
 	"github.com/UKHomeOffice/dapperdox/spec"
+	"github.com/UKHomeOffice/dapperdox/validate"
 	"github.com/gorilla/pat"
 	"github.com/justinas/alice"
 	"github.com/justinas/nosurf"
@@ -48,7 +56,27 @@ var tlsEnabled bool
 // ---------------------------------------------------------------------------
 func main() {
 	tlsEnabled = false
-	log.Printf("DapperDox server version %s starting\n", VERSION)
+
+	// The validate and diff commands take the same configuration as the server, so remove
+	// them, and the specifications to diff, from the arguments before they are parsed.
+	runValidate := len(os.Args) > 1 && os.Args[1] == "validate"
+	runDiff := len(os.Args) > 1 && os.Args[1] == "diff"
+
+	var diffOld, diffNew string
+
+	switch {
+	case runValidate:
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	case runDiff:
+		if len(os.Args) < 4 {
+			log.Printf("usage: %s diff <old specification> <new specification> [options]\n", os.Args[0])
+			os.Exit(diff.ExitFailed)
+		}
+		diffOld, diffNew = os.Args[2], os.Args[3]
+		os.Args = append(os.Args[:1], os.Args[4:]...)
+	default:
+		log.Printf("DapperDox server version %s starting\n", VERSION)
+	}
 
 	os.Setenv("GOFIGURE_ENV_ARRAY", "1") // Enable gofigure array parsing of env vars
 
@@ -65,60 +93,74 @@ func main() {
 		os.Exit(1)
 	}
 
-	router := pat.New()
+	if runValidate {
+		os.Exit(validate.Run(os.Stdout))
+	}
+	if runDiff {
+		os.Exit(diff.Run(os.Stdout, diffOld, diffNew))
+	}
+
+	spec.LoadStatusCodes()
+
+	router := reload.NewRouter(registerRoutes)
+
+	// Remotely hosted specifications that change are reloaded along with everything else
+	stopRefreshing := spec.RefreshRemoteSpecifications(router.Rebuild)
+	defer stopRefreshing()
+
 	chain := alice.New(logger.Handler /*, context.ClearHandler*/, timeoutHandler, withCsrf, injectHeaders).Then(router)
 
-	logger.Infof(nil, "listening on %s", cfg.BindAddr)
-	listener, err := net.Listen("tcp", cfg.BindAddr)
+	if cfg.Watch {
+		stopWatching := router.Watch([]string{cfg.SpecDir, cfg.AssetsDir, cfg.ThemeDir})
+		defer stopWatching()
+
+		if cfg.LiveReload {
+			chain = router.LiveReload(chain)
+		}
+	}
+
+	listener, err := network.GetListener(&tlsEnabled)
 	if err != nil {
-		logger.Errorf(nil, "%s", err)
+		logger.Errorf(nil, "Error listening on %s: %s", cfg.BindAddr, err)
 		os.Exit(1)
 	}
 
-	var wg sync.WaitGroup
-	var sg sync.WaitGroup
-	sg.Add(1)
+	http.Serve(listener, chain)
+}
 
-	go func() {
-		logger.Traceln(nil, "Listen for and serve swagger spec requests for start up")
-		wg.Add(1)
-		sg.Done()
-		http.Serve(listener, chain)
-		logger.Traceln(nil, "Finished service swagger specs for start up")
-		wg.Done()
-	}()
+// ---------------------------------------------------------------------------
+// registerRoutes compiles the assets and guides against the loaded specifications, returning
+// a router for all of the documentation, and a function that renders with what was compiled.
+// It is called again, with the specifications reloaded, each time the documentation is
+// rebuilt, while the previous build is still being served.
+func registerRoutes() (http.Handler, func()) {
+	router := pat.New()
 
-	sg.Wait()
+	// Start afresh, leaving anything compiled by a previous build to what is serving it
+	spec.APISuite = nil
+	asset.Reset()
 
-	// Register the spec routes (Listener and server must be up and running by now)
+	// Register the spec routes, so that local specifications can be downloaded
 	specs.Register(router)
-	spec.LoadStatusCodes()
 
-	err = spec.LoadSpecifications(cfg.BindAddr, true)
-	if err != nil {
+	if err := spec.LoadSpecifications(true); err != nil {
 		logger.Errorf(nil, "Load specification error: %s", err)
-		os.Exit(1)
 	}
 
 	render.Register()
 
 	reference.Register(router)
+	changes.Register(router)
+	deprecations.Register(router)
 	guides.Register(router)
 	static.Register(router) // TODO - Static content should be capable of being CDN hosted
 
 	home.Register(router)
 	proxy.Register(router)
+	mock.Register(router)
+	oauth2.Register(router)
 
-	listener.Close() // Stop serving specs
-	wg.Wait()        // wait for go routine serving specs to terminate
-
-	listener, err = network.GetListener(&tlsEnabled)
-	if err != nil {
-		logger.Errorf(nil, "Error listening on %s: %s", cfg.BindAddr, err)
-		os.Exit(1)
-	}
-
-	http.Serve(listener, chain)
+	return router, render.Serve
 }
 
 // ---------------------------------------------------------------------------
@@ -129,6 +171,11 @@ func withCsrf(h http.Handler) http.Handler {
 		logger.Warnf(req, "failed csrf validation: %s", rsn)
 		render.HTML(w, http.StatusBadRequest, "error", map[string]interface{}{"error": rsn})
 	}))
+
+	// The mock APIs are called by API clients, which have no CSRF token to give
+	if cfg, _ := config.Get(); cfg.Mock {
+		csrfHandler.ExemptRegexp("^" + regexp.QuoteMeta(strings.TrimSuffix(cfg.MockPrefix, "/")) + "/")
+	}
 	return csrfHandler
 }
 
@@ -0,0 +1,349 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+package mock
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/UKHomeOffice/dapperdox/config"
+	"github.com/UKHomeOffice/dapperdox/logger"
+	"github.com/UKHomeOffice/dapperdox/render"
+	"github.com/UKHomeOffice/dapperdox/spec"
+	"github.com/gorilla/pat"
+)
+
+// The mock of a specification answers each request for one of its methods with a response
+// the method documents, once the request has been checked against the method's parameters.
+// By default this is the lowest 2xx response, with the example of its preferred media type.
+// The Prefer header of a request selects another:
+//
+//	Prefer: code=404
+//	Prefer: example=outOfStock
+//
+// where the example is one of the named examples of the response's media type, or for
+// Swagger 2 the media type of one of its examples.
+
+// -----------------------------------------------------------------------------
+
+// Register creates a mock of each specification, at mock-prefix/specification-id, when mocks
+// are configured.
+func Register(r *pat.Router) {
+	cfg, _ := config.Get() // Don't worry about error. If there was something wrong with the config, we'd know by now.
+
+	if !cfg.Mock {
+		return
+	}
+
+	logger.Tracef(nil, "Registering mock APIs:\n")
+
+	prefix := strings.TrimSuffix(cfg.MockPrefix, "/")
+	for _, specification := range spec.APISuite {
+		route := prefix + "/" + specification.ID
+		logger.Tracef(nil, "+ %s\n", route)
+
+		r.PathPrefix(route + "/").HandlerFunc(mockHandler(specification, route))
+	}
+	logger.Tracef(nil, "Registering mock APIs done.\n")
+}
+
+// -----------------------------------------------------------------------------
+
+func mockHandler(specification *spec.APISpecification, route string) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		path := strings.TrimPrefix(req.URL.EscapedPath(), route)
+
+		// The API explorer of a documentation site on another origin may call the mock
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != "" {
+			preflight(w, req, specification, path)
+			return
+		}
+
+		method, pathParams := specification.FindMethod(req.Method, path)
+		if method == nil {
+			allowed := specification.AllowedMethods(path)
+			if len(allowed) == 0 {
+				fail(w, req, http.StatusNotFound, fmt.Sprintf("no method is documented for %s", path))
+				return
+			}
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			fail(w, req, http.StatusMethodNotAllowed, fmt.Sprintf("%s is not documented for %s", req.Method, path))
+			return
+		}
+
+		if problems := method.ValidateRequest(req, pathParams); len(problems) > 0 {
+			fail(w, req, http.StatusBadRequest, problems...)
+			return
+		}
+
+		prefer := preferences(req)
+
+		status, response, err := selectResponse(method, prefer["code"])
+		if err != nil {
+			fail(w, req, http.StatusBadRequest, err.Error())
+			return
+		}
+		if response == nil {
+			fail(w, req, http.StatusNotImplemented, fmt.Sprintf("no response is documented for %s %s", req.Method, path))
+			return
+		}
+
+		contentType, body, err := responseBody(method, response, req.Header.Get("Accept"), prefer["example"])
+		if err == errNotAcceptable {
+			fail(w, req, http.StatusNotAcceptable, fmt.Sprintf("the %d response is not documented as any of %s", status, req.Header.Get("Accept")))
+			return
+		}
+		if err != nil {
+			fail(w, req, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		for _, header := range response.Headers {
+			if header.Example != "" {
+				w.Header().Set(header.Name, header.Example)
+			}
+		}
+		if body != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+
+		logger.Infof(req, "MOCK %s %s (%d)", req.Method, req.URL.Path, status)
+	}
+}
+
+// preflight answers a CORS preflight request for the methods documented for the path.
+func preflight(w http.ResponseWriter, req *http.Request, specification *spec.APISpecification, path string) {
+	allowed := specification.AllowedMethods(path)
+	if len(allowed) == 0 {
+		fail(w, req, http.StatusNotFound, fmt.Sprintf("no method is documented for %s", path))
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(allowed, ", "))
+	if headers := req.Header.Get("Access-Control-Request-Headers"); headers != "" {
+		w.Header().Set("Access-Control-Allow-Headers", headers)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fail answers a request that the mock cannot answer with a documented response, giving the
+// reasons as JSON.
+func fail(w http.ResponseWriter, req *http.Request, status int, problems ...string) {
+	logger.Infof(req, "MOCK %s %s (%d): %s", req.Method, req.URL.Path, status, strings.Join(problems, "; "))
+	render.JSON(w, status, map[string]interface{}{"errors": problems})
+}
+
+// -----------------------------------------------------------------------------
+
+// preferences reads the code and example preferences of the Prefer headers of a request.
+func preferences(req *http.Request) map[string]string {
+	prefer := make(map[string]string)
+	for _, header := range req.Header[http.CanonicalHeaderKey("Prefer")] {
+		for _, preference := range strings.FieldsFunc(header, func(r rune) bool { return r == ',' || r == ';' }) {
+			kv := strings.SplitN(strings.TrimSpace(preference), "=", 2)
+			if len(kv) == 2 {
+				prefer[strings.ToLower(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			}
+		}
+	}
+	return prefer
+}
+
+// selectResponse picks the response to a request, either that of the status code preferred
+// by the request, or the lowest 2xx response, or failing that the lowest documented.
+func selectResponse(method *spec.Method, code string) (int, *spec.Response, error) {
+	if code != "" {
+		status, err := strconv.Atoi(code)
+		if err != nil || status < 100 || status > 599 {
+			return 0, nil, fmt.Errorf("the preferred code %q is not a status code", code)
+		}
+		if response, ok := method.Responses[status]; ok {
+			return status, &response, nil
+		}
+		if method.DefaultResponse != nil {
+			return status, method.DefaultResponse, nil
+		}
+		return 0, nil, fmt.Errorf("no %d response is documented", status)
+	}
+
+	codes := make([]int, 0, len(method.Responses))
+	for status := range method.Responses {
+		codes = append(codes, status)
+	}
+	sort.Ints(codes)
+
+	for _, status := range codes {
+		if status >= 200 && status < 300 {
+			response := method.Responses[status]
+			return status, &response, nil
+		}
+	}
+	if method.DefaultResponse != nil {
+		return http.StatusOK, method.DefaultResponse, nil
+	}
+	if len(codes) > 0 {
+		response := method.Responses[codes[0]]
+		return codes[0], &response, nil
+	}
+	return 0, nil, nil
+}
+
+// -----------------------------------------------------------------------------
+
+var errNotAcceptable = fmt.Errorf("not acceptable")
+
+// responseBody gives the media type and body of a response, in a media type accepted by the
+// request, using the named example if one is given.
+func responseBody(method *spec.Method, response *spec.Response, accept string, example string) (string, string, error) {
+	if len(response.MediaTypes) > 0 {
+		return mediaTypeBody(response, accept, example)
+	}
+
+	if response.Resource == nil && len(response.Examples) == 0 {
+		return "", "", nil // No content
+	}
+
+	// Swagger 2, whose examples are named by media type
+	contentTypes := preferJSON(method.Produces)
+	if len(contentTypes) == 0 {
+		contentTypes = []string{"application/json"}
+	}
+	if example != "" {
+		for _, e := range response.Examples {
+			if e.Name == example {
+				return e.Name, e.Value, nil
+			}
+		}
+		return "", "", fmt.Errorf("no example named %q is documented for the response", example)
+	}
+
+	contentType, ok := negotiate(accept, contentTypes)
+	if !ok {
+		return "", "", errNotAcceptable
+	}
+	for _, e := range response.Examples {
+		if e.Name == contentType {
+			return contentType, e.Value, nil
+		}
+	}
+	if response.Resource == nil {
+		return contentType, "", nil
+	}
+	return contentType, response.Resource.BodyExample(response.IsArray), nil
+}
+
+// mediaTypeBody gives the media type and body of an OpenAPI 3 response.
+func mediaTypeBody(response *spec.Response, accept string, example string) (string, string, error) {
+	var contentTypes []string
+	for _, mt := range response.MediaTypes {
+		contentTypes = append(contentTypes, mt.ContentType)
+	}
+	contentTypes = preferJSON(contentTypes)
+
+	contentType, ok := negotiate(accept, contentTypes)
+	if !ok {
+		return "", "", errNotAcceptable
+	}
+
+	var mt spec.MediaType
+	for _, mt = range response.MediaTypes {
+		if mt.ContentType == contentType {
+			break
+		}
+	}
+
+	if example != "" {
+		for _, e := range mt.Examples {
+			if e.Name == example && e.Value != "" {
+				return contentType, e.Value, nil
+			}
+		}
+		return "", "", fmt.Errorf("no example named %q is documented for %s", example, contentType)
+	}
+
+	if mt.Example != "" {
+		return contentType, mt.Example, nil
+	}
+	for _, e := range mt.Examples {
+		if e.Value != "" {
+			return contentType, e.Value, nil
+		}
+	}
+	if mt.Resource == nil {
+		return contentType, "", nil
+	}
+	return contentType, mt.Resource.BodyExample(mt.IsArray), nil
+}
+
+// preferJSON orders content types with JSON first, as the examples built from schemas are.
+func preferJSON(contentTypes []string) []string {
+	ordered := append([]string(nil), contentTypes...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return strings.Contains(ordered[i], "json") && !strings.Contains(ordered[j], "json")
+	})
+	return ordered
+}
+
+// negotiate picks the first of the content types that the Accept header of a request accepts,
+// taking the media ranges of the header in order of their quality.
+func negotiate(accept string, contentTypes []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return contentTypes[0], true
+	}
+
+	type mediaRange struct {
+		name    string
+		quality float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		r := mediaRange{name: strings.ToLower(strings.TrimSpace(params[0])), quality: 1}
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && kv[0] == "q" {
+				r.quality, _ = strconv.ParseFloat(kv[1], 64)
+			}
+		}
+		if r.quality > 0 {
+			ranges = append(ranges, r)
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].quality > ranges[j].quality })
+
+	for _, r := range ranges {
+		for _, contentType := range contentTypes {
+			name := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+			switch {
+			case r.name == "*/*", r.name == name:
+				return contentType, true
+			case strings.HasSuffix(r.name, "/*") && strings.HasPrefix(name, strings.TrimSuffix(r.name, "*")):
+				return contentType, true
+			}
+		}
+	}
+	return "", false
+}
+
+// -----------------------------------------------------------------------------
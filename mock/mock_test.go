@@ -0,0 +1,186 @@
+package mock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/UKHomeOffice/dapperdox/render"
+	"github.com/UKHomeOffice/dapperdox/spec"
+	"github.com/getkin/kin-openapi/openapi3"
+	unrolled "github.com/unrolled/render"
+)
+
+const shopSpec = `
+openapi: 3.0.0
+info:
+  title: Shop
+  version: 1.0.0
+paths:
+  /orders:
+    get:
+      summary: List orders
+      responses:
+        '200':
+          description: Orders
+          content:
+            application/json:
+              example: [{"id": 1}]
+        '404':
+          description: Not found
+          content:
+            application/json:
+              examples:
+                missing:
+                  value: {"message": "no such order"}
+                gone:
+                  value: {"message": "order deleted"}
+        default:
+          description: An error
+          content:
+            application/json:
+              example: {"message": "failed"}
+`
+
+// serveMock loads a specification and sends a request to its mock.
+func serveMock(t *testing.T, document string, req *http.Request) *httptest.ResponseRecorder {
+	render.Render = unrolled.New()
+
+	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData([]byte(document))
+	if err != nil {
+		t.Fatal(`Failed to parse spec` + err.Error())
+	}
+	specification := &spec.APISpecification{ID: "shop"}
+	if err = specification.LoadOpenAPI3(swagger); err != nil {
+		t.Fatal(`Failed to load spec` + err.Error())
+	}
+
+	w := httptest.NewRecorder()
+	mockHandler(specification, "/mock/shop")(w, req)
+	return w
+}
+
+func TestRejectsInvalidPreferredCodes(t *testing.T) {
+
+	for _, code := range []string{"0", "-1", "99", "600", "1000"} {
+		req := httptest.NewRequest("GET", "/mock/shop/orders", nil)
+		req.Header.Set("Prefer", "code="+code)
+
+		w := serveMock(t, shopSpec, req)
+
+		var body struct{ Errors []string }
+		if w.Code != http.StatusBadRequest || json.Unmarshal(w.Body.Bytes(), &body) != nil || len(body.Errors) != 1 {
+			t.Errorf(`Preferred code %s fail: %d %s`, code, w.Code, w.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/mock/shop/orders", nil)
+	req.Header.Set("Prefer", "code=503")
+
+	w := serveMock(t, shopSpec, req)
+
+	var body struct{ Message string }
+	if w.Code != http.StatusServiceUnavailable || json.Unmarshal(w.Body.Bytes(), &body) != nil || body.Message != "failed" {
+		t.Errorf(`Default response fail: %d %s`, w.Code, w.Body.String())
+	}
+}
+
+func TestSelectsPreferredResponses(t *testing.T) {
+
+	tests := []struct {
+		prefer  string
+		code    int
+		message string
+	}{
+		{"", http.StatusOK, ""},
+		{"code=404", http.StatusNotFound, "order deleted"}, // The first example by name
+		{"code=404, example=gone", http.StatusNotFound, "order deleted"},
+		{"code=404; example=\"missing\"", http.StatusNotFound, "no such order"},
+		{"code=500", http.StatusInternalServerError, "failed"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/mock/shop/orders", nil)
+		if test.prefer != "" {
+			req.Header.Set("Prefer", test.prefer)
+		}
+
+		w := serveMock(t, shopSpec, req)
+
+		if w.Code != test.code || w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf(`Prefer %q fail: %d %s`, test.prefer, w.Code, w.Header().Get("Content-Type"))
+			continue
+		}
+		if test.message == "" {
+			var orders []map[string]int
+			if json.Unmarshal(w.Body.Bytes(), &orders) != nil || len(orders) != 1 || orders[0]["id"] != 1 {
+				t.Errorf(`Prefer %q body fail: %s`, test.prefer, w.Body.String())
+			}
+			continue
+		}
+		var body struct{ Message string }
+		if json.Unmarshal(w.Body.Bytes(), &body) != nil || body.Message != test.message {
+			t.Errorf(`Prefer %q body fail: %s`, test.prefer, w.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/mock/shop/orders", nil)
+	req.Header.Set("Prefer", "code=404, example=unknown")
+
+	if w := serveMock(t, shopSpec, req); w.Code != http.StatusBadRequest {
+		t.Errorf(`Unknown example fail: %d`, w.Code)
+	}
+}
+
+func TestRejectsUndocumentedRequests(t *testing.T) {
+
+	w := serveMock(t, shopSpec, httptest.NewRequest("DELETE", "/mock/shop/orders", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET" {
+		t.Errorf(`Method not allowed fail: %d %q`, w.Code, w.Header().Get("Allow"))
+	}
+
+	w = serveMock(t, shopSpec, httptest.NewRequest("GET", "/mock/shop/customers", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf(`Not found fail: %d`, w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/mock/shop/orders", nil)
+	req.Header.Set("Accept", "application/xml, text/*;q=0.5")
+
+	w = serveMock(t, shopSpec, req)
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf(`Not acceptable fail: %d`, w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/mock/shop/orders", nil)
+	req.Header.Set("Accept", "application/xml;q=0.9, application/*;q=0.1")
+
+	if w = serveMock(t, shopSpec, req); w.Code != http.StatusOK {
+		t.Errorf(`Media range fail: %d`, w.Code)
+	}
+}
+
+func TestAnswersPreflightRequests(t *testing.T) {
+
+	req := httptest.NewRequest("OPTIONS", "/mock/shop/orders", nil)
+	req.Header.Set("Origin", "https://docs.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "Prefer")
+
+	w := serveMock(t, shopSpec, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf(`Preflight fail: %d`, w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Methods") != "GET" ||
+		w.Header().Get("Access-Control-Allow-Headers") != "Prefer" {
+		t.Errorf(`Preflight headers fail: %v`, w.Header())
+	}
+
+	req = httptest.NewRequest("OPTIONS", "/mock/shop/customers", nil)
+	req.Header.Set("Access-Control-Request-Method", "GET")
+
+	if w = serveMock(t, shopSpec, req); w.Code != http.StatusNotFound {
+		t.Errorf(`Preflight not found fail: %d`, w.Code)
+	}
+}
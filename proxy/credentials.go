@@ -0,0 +1,104 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/UKHomeOffice/dapperdox/config"
+	"github.com/UKHomeOffice/dapperdox/logger"
+)
+
+// credential is added to each request through a proxied path, so that the API explorer can
+// call an API without its key being given to the browser. It is configured as one of
+//
+//	local-path=header:X-API-Key=env:API_KEY
+//	local-path=query:api_key=file:/run/secrets/api-key
+//	local-path=bearer=env:ACCESS_TOKEN
+//
+// The value is read from an environment variable, or from a file, when the paths are
+// registered. Each value is redacted from the log.
+type credential struct {
+	in    string // header, query or bearer
+	name  string // The name of the header or query parameter
+	value string
+}
+
+// -----------------------------------------------------------------------------
+
+// getCredentials reads the configured credentials, keyed by the local path they are added to
+// requests for.
+func getCredentials(configured []string) map[string][]credential {
+	credentials := make(map[string][]credential)
+
+	for _, c := range configured {
+		slice := strings.SplitN(c, "=", 3)
+		if len(slice) < 2 {
+			panic("Invalid ProxyCredential specified - does not contain an = delimited path=credential=source")
+		}
+		path := slice[0]
+
+		var cred credential
+		var source string
+		switch {
+		case slice[1] == "bearer" && len(slice) == 3:
+			cred.in = "bearer"
+			source = slice[2]
+		case (strings.HasPrefix(slice[1], "header:") || strings.HasPrefix(slice[1], "query:")) && len(slice) == 3:
+			kind := strings.SplitN(slice[1], ":", 2)
+			cred.in, cred.name = kind[0], kind[1]
+			source = slice[2]
+		default:
+			panic("Invalid ProxyCredential specified for " + path + " - expected header:name=source, query:name=source or bearer=source")
+		}
+
+		value, err := config.ReadSecret(source)
+		if err != nil {
+			logger.Errorf(nil, "Proxy credential for %s not added: %s", path, err)
+			continue
+		}
+
+		// Redacted as it is sent, and as it would appear in a URL
+		logger.Redact(value)
+		logger.Redact(url.QueryEscape(value))
+
+		cred.value = value
+		credentials[path] = append(credentials[path], cred)
+	}
+	return credentials
+}
+
+// -----------------------------------------------------------------------------
+
+// apply adds the credential to a request, replacing any the request gives.
+func (c credential) apply(r *http.Request) {
+	switch c.in {
+	case "header":
+		r.Header.Set(c.name, c.value)
+	case "query":
+		query := r.URL.Query()
+		query.Set(c.name, c.value)
+		r.URL.RawQuery = query.Encode()
+	case "bearer":
+		r.Header.Set("Authorization", "Bearer "+c.value)
+	}
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/UKHomeOffice/dapperdox/config"
+	"github.com/UKHomeOffice/dapperdox/logger"
+	"github.com/gorilla/pat"
+)
+
+// proxied sends a request through a proxied path with the credentials configured, returning
+// the request as the service received it.
+func proxied(t *testing.T, configured []string, req *http.Request) *http.Request {
+	received := make(chan *http.Request, 1)
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+	}))
+	defer service.Close()
+
+	config.Get() // Fails the first time under test, on the test flags, but is then configured
+
+	r := pat.New()
+	register(r, "/api", service.URL, getCredentials(configured)["/api"], nil)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	select {
+	case sent := <-received:
+		return sent
+	default:
+		t.Fatalf(`Request not proxied: %d`, w.Code)
+		return nil
+	}
+}
+
+func TestCredentialsReplaceClientValues(t *testing.T) {
+
+	os.Setenv("DAPPERDOX_TEST_API_KEY", "server key")
+	os.Setenv("DAPPERDOX_TEST_TOKEN", "server-token")
+	defer os.Unsetenv("DAPPERDOX_TEST_API_KEY")
+	defer os.Unsetenv("DAPPERDOX_TEST_TOKEN")
+
+	dir, err := ioutil.TempDir("", "proxy")
+	if err != nil {
+		t.Fatal(`Failed to create secret` + err.Error())
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "query-key"), []byte("server&query\n"), 0600); err != nil {
+		t.Fatal(`Failed to create secret` + err.Error())
+	}
+
+	tests := []struct {
+		credential string
+		client     func(req *http.Request)
+		sent       func(req *http.Request) []string
+		expected   string
+	}{
+		{
+			"/api=header:X-API-Key=env:DAPPERDOX_TEST_API_KEY",
+			func(req *http.Request) { req.Header.Set("X-API-Key", "client key") },
+			func(req *http.Request) []string { return req.Header["X-Api-Key"] },
+			"server key",
+		},
+		{
+			"/api=query:api_key=file:" + filepath.Join(dir, "query-key"),
+			func(req *http.Request) { req.URL.RawQuery = "api_key=client" },
+			func(req *http.Request) []string { return req.URL.Query()["api_key"] },
+			"server&query",
+		},
+		{
+			"/api=bearer=env:DAPPERDOX_TEST_TOKEN",
+			func(req *http.Request) { req.Header.Set("Authorization", "Bearer client-token") },
+			func(req *http.Request) []string { return req.Header["Authorization"] },
+			"Bearer server-token",
+		},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/api/pets", nil)
+		test.client(req)
+
+		sent := proxied(t, []string{test.credential}, req)
+
+		if values := test.sent(sent); len(values) != 1 || values[0] != test.expected {
+			t.Errorf(`%s fail: %q`, test.credential, values)
+		}
+	}
+
+	// Values the client gives that are not credentials are passed on
+	req := httptest.NewRequest("GET", "/api/pets?limit=5", nil)
+	req.Header.Set("X-Request-Id", "abc")
+
+	sent := proxied(t, []string{"/api=query:api_key=env:DAPPERDOX_TEST_API_KEY"}, req)
+
+	if sent.URL.Query().Get("limit") != "5" || sent.URL.Query().Get("api_key") != "server key" || sent.Header.Get("X-Request-Id") != "abc" {
+		t.Errorf(`Pass through fail: %s %v`, sent.URL.RawQuery, sent.Header)
+	}
+}
+
+func TestCredentialsAreOnlyAddedToTheirPath(t *testing.T) {
+
+	os.Setenv("DAPPERDOX_TEST_API_KEY", "server key")
+	defer os.Unsetenv("DAPPERDOX_TEST_API_KEY")
+
+	credentials := getCredentials([]string{
+		"/api=header:X-API-Key=env:DAPPERDOX_TEST_API_KEY",
+		"/other=bearer=env:DAPPERDOX_TEST_API_KEY",
+		"/missing=bearer=env:DAPPERDOX_TEST_UNSET",
+	})
+
+	if len(credentials) != 2 || len(credentials["/api"]) != 1 || len(credentials["/other"]) != 1 {
+		t.Fatalf(`Credentials fail: %v`, credentials)
+	}
+
+	req := httptest.NewRequest("GET", "/api/pets", nil)
+	sent := proxied(t, []string{"/other=bearer=env:DAPPERDOX_TEST_API_KEY"}, req)
+
+	if sent.Header.Get("Authorization") != "" {
+		t.Errorf(`Credential added to another path: %v`, sent.Header)
+	}
+}
+
+func TestProxyErrorsDoNotLogCredentials(t *testing.T) {
+
+	os.Setenv("DAPPERDOX_TEST_API_KEY", "s3cret-key")
+	defer os.Unsetenv("DAPPERDOX_TEST_API_KEY")
+
+	service := httptest.NewServer(http.NotFoundHandler())
+	service.Close() // So that the request cannot be sent
+
+	var out, std bytes.Buffer
+	logf, logln := logger.Logf, logger.Logln
+	logger.Logf = func(format string, args ...interface{}) { fmt.Fprintf(&out, format+"\n", args...) }
+	logger.Logln = func(args ...interface{}) { fmt.Fprintln(&out, args...) }
+	log.SetOutput(&std)
+	defer func() {
+		logger.Logf, logger.Logln = logf, logln
+		log.SetOutput(os.Stderr)
+	}()
+
+	config.Get()
+
+	r := pat.New()
+	register(r, "/api", service.URL, getCredentials([]string{"/api=query:api_key=env:DAPPERDOX_TEST_API_KEY"})["/api"], nil)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/pets", nil))
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf(`Status fail: %d`, w.Code)
+	}
+	if !strings.Contains(out.String(), "Proxy error") || std.Len() != 0 {
+		t.Errorf(`Error not logged by the logger: %s %s`, out.String(), std.String())
+	}
+	if strings.Contains(out.String()+std.String(), "s3cret") {
+		t.Errorf(`Secret logged: %s %s`, out.String(), std.String())
+	}
+}
@@ -18,16 +18,33 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package proxy
 
 import (
-	"github.com/UKHomeOffice/dapperdox/config"
-	"github.com/UKHomeOffice/dapperdox/logger"
-	"github.com/gorilla/pat"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strings"
 	"time"
+
+	"github.com/UKHomeOffice/dapperdox/config"
+	"github.com/UKHomeOffice/dapperdox/logger"
+	"github.com/UKHomeOffice/dapperdox/reload"
+	"github.com/UKHomeOffice/dapperdox/spec"
+	"github.com/gorilla/pat"
 )
 
+// ValidationHeader is the response header that gives the API explorer, as a JSON list, the
+// problems found when validating a proxied request and the response to it
+const ValidationHeader = "X-DapperDox-Validation"
+
+// The largest response body that is validated
+const maxValidatedBody = 10 << 20
+
 type responseCapture struct {
 	http.ResponseWriter
 	statusCode int
@@ -45,11 +62,13 @@ func Register(r *pat.Router) {
 
 	logger.Tracef(nil, "Registering proxied paths:\n")
 
+	credentials := getCredentials(cfg.ProxyCredential)
+
 	for i := range cfg.ProxyPath {
 		slice := strings.Split(cfg.ProxyPath[i], "=")
 		switch len(slice) {
 		case 2:
-			register(r, slice[0], slice[1])
+			register(r, slice[0], slice[1], credentials[slice[0]], spec.APISuite)
 		default:
 			panic("Invalid ProxyPath specified - does not contain an = delimited path=host/path pair")
 		}
@@ -59,11 +78,15 @@ func Register(r *pat.Router) {
 
 // -----------------------------------------------------------------------------
 
-func register(r *pat.Router, routePattern string, target string) {
+func register(r *pat.Router, routePattern string, target string, credentials []credential, suite map[string]*spec.APISpecification) {
+	cfg, _ := config.Get()
 
 	u, _ := url.Parse(target)
 
 	logger.Tracef(nil, "+ %s -> %s\n", routePattern, target)
+	for _, c := range credentials {
+		logger.Tracef(nil, "  adding %s credential %s\n", c.in, c.name)
+	}
 
 	proxy := httputil.NewSingleHostReverseProxy(u)
 	od := proxy.Director
@@ -72,18 +95,39 @@ func register(r *pat.Router, routePattern string, target string) {
 		od(r)
 		r.Host = r.URL.Host // Rewrite Host
 
+		for _, c := range credentials {
+			c.apply(r)
+		}
+
 		scheme := "http://"
 		if r.TLS != nil {
 			scheme = "https://"
 		}
 		logger.Debugf(r, "Proxy request to: %s%s%s", scheme, r.Host, r.URL.Path)
 	}
+	// Errors can give the URL of the request, with any credential in its query, so are logged
+	// by the logger, which redacts it, rather than by the standard logger
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		logger.Errorf(r, "Proxy error: %s", err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	proxy.ErrorLog = log.New(errorLog{}, "", 0)
+	if cfg.ProxyValidate {
+		proxy.ModifyResponse = validateResponse
+	}
 
 	r.PathPrefix(routePattern).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		rc := &responseCapture{w, 0}
 		s := time.Now()
 		logger.Tracef(r, "Proxy request started: %v", s)
 
+		if cfg.ProxyValidate {
+			r = validateRequest(r, credentials, suite)
+		}
+
+		// The documentation is not held while the service responds. The response is only
+		// validated against the method found for the request, which was taken beforehand
+		reload.Release(r)
 		proxy.ServeHTTP(rc, r)
 
 		e := time.Now()
@@ -95,3 +139,84 @@ func register(r *pat.Router, routePattern string, target string) {
 }
 
 // -----------------------------------------------------------------------------
+
+// errorLog writes what the reverse proxy logs through the logger
+type errorLog struct{}
+
+func (errorLog) Write(p []byte) (int, error) {
+	logger.Errorln(nil, strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// -----------------------------------------------------------------------------
+
+type validationKey struct{}
+
+// validation records the method a proxied request calls, and the problems found with the
+// request, until the response arrives. The method is found while the request holds the
+// documentation, and remains valid once it is released, as a rebuild loads new
+// specifications rather than changing those of the build that found it.
+type validation struct {
+	method   *spec.Method
+	problems []string
+}
+
+// validateRequest checks a request against the method of the specifications that it calls,
+// as found by the path it was made to, recording the problems found with the request. The
+// request is checked as it will be sent, with the credentials that are added to it.
+func validateRequest(r *http.Request, credentials []credential, suite map[string]*spec.APISpecification) *http.Request {
+	v := &validation{problems: make([]string, 0)}
+
+	var params map[string]string
+	_, v.method, params = spec.FindOperation(suite, r.Method, r.URL.EscapedPath())
+	if v.method == nil {
+		v.problems = append(v.problems, fmt.Sprintf("no documented operation matches %s %s", r.Method, r.URL.Path))
+	} else {
+		sent := r.Clone(r.Context())
+		for _, c := range credentials {
+			c.apply(sent)
+		}
+		v.problems = append(v.problems, v.method.ValidateRequest(sent, params)...)
+		r.Body = sent.Body // Read by the validation, and restored
+	}
+	return r.WithContext(context.WithValue(r.Context(), validationKey{}, v))
+}
+
+// validateResponse checks a response against the response documented for its status, and
+// gives the API explorer the problems found with it and its request.
+func validateResponse(resp *http.Response) error {
+	v, ok := resp.Request.Context().Value(validationKey{}).(*validation)
+	if !ok {
+		return nil
+	}
+	problems := v.problems
+
+	if v.method != nil {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxValidatedBody+1))
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+
+		encoding := resp.Header.Get("Content-Encoding")
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("response body could not be read: %s", err))
+		case len(body) > maxValidatedBody:
+			problems = append(problems, "response body is too large to validate")
+		case encoding != "" && encoding != "identity":
+			problems = append(problems, fmt.Sprintf("response body is %s encoded, so was not validated", encoding))
+		default:
+			problems = append(problems, v.method.ValidateResponse(resp.StatusCode, resp.Header, body)...)
+		}
+	}
+
+	for _, problem := range problems {
+		logger.Warnf(resp.Request, "Proxy validation: %s %s: %s", resp.Request.Method, resp.Request.URL.Path, problem)
+	}
+	findings, _ := json.Marshal(problems)
+	resp.Header.Set(ValidationHeader, logger.Redacted(string(findings))) // Credentials are not to reach the browser
+	return nil
+}
+
+// -----------------------------------------------------------------------------
@@ -0,0 +1,193 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+package reload
+
+// This package allows the specifications, assets, guides and templates to be rebuilt while
+// DapperDox is running. A rebuild compiles everything afresh into a new router, leaving what
+// is being served alone, so that requests carry on being served by the previous router in
+// the meantime. The new router is then swapped in, along with what it renders with.
+//
+// Each request holds the documentation for reading while it uses it, and the swap holds it for
+// writing, so that a request is served by one build throughout. The swap is quick, and a
+// request that waits on another service, such as a proxied API, gives up its hold while it
+// waits, so that it does not hold up the swap, nor the requests that arrive after it.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/UKHomeOffice/dapperdox/logger"
+)
+
+// LiveReloadPath is polled by the browser to find out when the documentation is rebuilt
+const LiveReloadPath = "/_dapperdox/livereload"
+
+// How long a live reload poll waits for a rebuild before telling the browser to poll again
+const liveReloadTimeout = 25 * time.Second
+
+// Router is a http.Handler that serves requests through the most recently built router
+type Router struct {
+	build func() (http.Handler, func())
+
+	building sync.Mutex // Held through each rebuild, so that one builds at a time
+
+	lock    sync.RWMutex // Held for reading by each request, and for writing to swap in a build
+	current http.Handler
+
+	rebuilt chan struct{} // Closed, and replaced, each time the router is rebuilt
+	mu      sync.Mutex    // Guards rebuilt
+}
+
+// ---------------------------------------------------------------------------
+// NewRouter builds the first router, using the build function that will also be used for
+// each rebuild. A build returns the router, and a function that serves whatever else it built
+// for the router, which is called as the router is swapped in. Until then, a build must not
+// change anything that requests are served with.
+func NewRouter(build func() (http.Handler, func())) *Router {
+	h, serve := build()
+	serve()
+
+	return &Router{
+		build:   build,
+		current: h,
+		rebuilt: make(chan struct{}),
+	}
+}
+
+// hold is a request's hold on the documentation, which it may give up while it waits on
+// another service. A request is served by a single goroutine, so it needs no locking of its own.
+type hold struct {
+	lock *sync.RWMutex
+	held bool
+}
+
+type holdKey struct{}
+
+// ---------------------------------------------------------------------------
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h := &hold{lock: &r.lock, held: true}
+
+	r.lock.RLock()
+	defer h.release()
+
+	r.current.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), holdKey{}, h)))
+}
+
+// ---------------------------------------------------------------------------
+// Release gives up a request's hold on the documentation, for a handler that goes on to wait
+// for another service, so that a slow service does not hold up a rebuild being swapped in, nor
+// the requests that wait for it. The handler must not use the specifications, assets or templates until
+// it calls the function returned, which takes hold again. Requests not served through a
+// Router have no hold to give up.
+func Release(req *http.Request) (reacquire func()) {
+	h, ok := req.Context().Value(holdKey{}).(*hold)
+	if !ok || !h.held {
+		return func() {}
+	}
+	h.release()
+
+	return func() {
+		h.lock.RLock()
+		h.held = true
+	}
+}
+
+func (h *hold) release() {
+	if h.held {
+		h.held = false
+		h.lock.RUnlock()
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Rebuild builds a fresh router and swaps it in. Requests are served by the previous router
+// while the build runs. The swap waits for in-flight requests to give up their hold on the
+// documentation, and requests that arrive during the swap wait for the new router. If the
+// build fails, such as when a template does not parse, the previous router is kept.
+func (r *Router) Rebuild() {
+	r.building.Lock()
+	defer r.building.Unlock()
+
+	logger.Infof(nil, "Rebuilding documentation")
+
+	h, serve, err := r.rebuild()
+	if err != nil {
+		logger.Errorf(nil, "Error rebuilding documentation, continuing with the previous build: %s", err)
+		return
+	}
+
+	r.lock.Lock()
+	serve()
+	r.current = h
+	r.lock.Unlock()
+
+	r.mu.Lock()
+	close(r.rebuilt)
+	r.rebuilt = make(chan struct{})
+	r.mu.Unlock()
+
+	logger.Infof(nil, "Rebuilt documentation")
+}
+
+// ---------------------------------------------------------------------------
+func (r *Router) rebuild() (h http.Handler, serve func(), err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	h, serve = r.build()
+	return h, serve, nil
+}
+
+// ---------------------------------------------------------------------------
+func (r *Router) waitForRebuild() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.rebuilt
+}
+
+// ---------------------------------------------------------------------------
+// LiveReload wraps a handler, serving the live reload poll itself. A poll is a long running
+// request, so it is answered outside of the router (and so outside of the request timeout),
+// where it cannot hold up a rebuild. It answers 200 when the documentation is rebuilt, or
+// 204 if there has been no rebuild before the poll times out.
+func (r *Router) LiveReload(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != LiveReloadPath {
+			h.ServeHTTP(w, req)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-cache")
+
+		select {
+		case <-r.waitForRebuild():
+			w.WriteHeader(http.StatusOK)
+		case <-time.After(liveReloadTimeout):
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
+
+// ---------------------------------------------------------------------------
+// end
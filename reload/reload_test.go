@@ -0,0 +1,173 @@
+package reload
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// handlerFor builds a router whose handler answers with the status given
+func handlerFor(status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(status)
+	})
+}
+
+func serve(router *Router) int {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	return w.Code
+}
+
+func TestKeepsRouterWhenRebuildFails(t *testing.T) {
+
+	served := 0
+	builds := []func() (http.Handler, func()){
+		func() (http.Handler, func()) { return handlerFor(http.StatusOK), func() { served = 1 } },
+		func() (http.Handler, func()) { panic("template does not parse") },
+		func() (http.Handler, func()) { return handlerFor(http.StatusAccepted), func() { served = 3 } },
+	}
+	build := 0
+	router := NewRouter(func() (http.Handler, func()) {
+		b := builds[build]
+		build++
+		return b()
+	})
+
+	router.Rebuild()
+	if code := serve(router); code != http.StatusOK || served != 1 {
+		t.Errorf(`Failed rebuild fail: %d %d`, code, served)
+	}
+
+	router.Rebuild()
+	if code := serve(router); code != http.StatusAccepted || served != 3 {
+		t.Errorf(`Rebuild fail: %d %d`, code, served)
+	}
+}
+
+func TestServesRequestsDuringRebuilds(t *testing.T) {
+
+	building := make(chan struct{})
+	built := make(chan struct{})
+	served := make(chan struct{})
+
+	status := http.StatusOK
+	router := NewRouter(func() (http.Handler, func()) {
+		if status != http.StatusOK {
+			close(building)
+			<-built // Slowly
+		}
+		return handlerFor(status), func() { close(served) }
+	})
+	<-served
+
+	served = make(chan struct{})
+	status = http.StatusAccepted
+
+	rebuilt := make(chan struct{})
+	go func() {
+		router.Rebuild()
+		close(rebuilt)
+	}()
+	<-building
+
+	answered := make(chan int)
+	go func() { answered <- serve(router) }()
+
+	select {
+	case code := <-answered:
+		if code != http.StatusOK {
+			t.Errorf(`Served by the build under way: %d`, code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal(`Request held up by rebuild`)
+	}
+	select {
+	case <-served:
+		t.Error(`Served before the build completed`)
+	default:
+	}
+
+	close(built)
+	<-rebuilt
+	if code := serve(router); code != http.StatusAccepted {
+		t.Errorf(`Rebuild fail: %d`, code)
+	}
+}
+
+func TestReleasedRequestsDoNotHoldUpRebuilds(t *testing.T) {
+
+	waiting := make(chan struct{})
+	done := make(chan struct{})
+
+	router := NewRouter(func() (http.Handler, func()) {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/slow" {
+				return
+			}
+			reacquire := Release(req)
+			close(waiting)
+			<-done // Waiting on another service
+			reacquire()
+		}), func() {}
+	})
+
+	go router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+	<-waiting
+
+	rebuilt := make(chan struct{})
+	go func() {
+		router.Rebuild()
+		close(rebuilt)
+	}()
+
+	select {
+	case <-rebuilt:
+	case <-time.After(5 * time.Second):
+		t.Error(`Rebuild held up by released request`)
+	}
+	close(done)
+}
+
+func TestStopsWatching(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(`Failed to create directory` + err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	builds := make(chan struct{}, 10)
+	router := NewRouter(func() (http.Handler, func()) {
+		builds <- struct{}{}
+		return handlerFor(http.StatusOK), func() {}
+	})
+	<-builds
+
+	stop := router.Watch([]string{dir})
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "changed.md"), []byte("# Changed"), 0644); err != nil {
+		t.Fatal(`Failed to change directory` + err.Error())
+	}
+	select {
+	case <-builds:
+	case <-time.After(5 * watchInterval):
+		t.Fatal(`Watch fail`)
+	}
+
+	stop()
+	stop()
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "changed again.md"), []byte("# Changed"), 0644); err != nil {
+		t.Fatal(`Failed to change directory` + err.Error())
+	}
+	select {
+	case <-builds:
+		t.Error(`Stop fail`)
+	case <-time.After(2 * watchInterval):
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+package reload
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/UKHomeOffice/dapperdox/logger"
+)
+
+// How often the watched directories are checked for changes
+const watchInterval = time.Second
+
+// ---------------------------------------------------------------------------
+// Watch rebuilds the router whenever a file is added to, removed from or changed beneath
+// any of the directories. Directories are polled, rather than relying on filesystem
+// notifications, so that editors which replace files and network mounts both behave.
+// Watching continues until stop is called.
+func (r *Router) Watch(dirs []string) (stop func()) {
+
+	var watched []string
+	for _, dir := range dirs {
+		if len(dir) != 0 {
+			logger.Infof(nil, "Watching %s for changes", dir)
+			watched = append(watched, dir)
+		}
+	}
+
+	done := make(chan struct{})
+	go r.watch(watched, signature(watched), done)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+func (r *Router) watch(dirs []string, last uint64, done <-chan struct{}) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		current := signature(dirs)
+		if current == last {
+			continue
+		}
+		last = current
+
+		r.Rebuild()
+	}
+}
+
+// ---------------------------------------------------------------------------
+// signature summarises the name, size and modification time of every file beneath the
+// directories, so that any change to any of them gives a different signature.
+func signature(dirs []string) uint64 {
+	h := fnv.New64a()
+
+	for _, dir := range dirs {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				// The file went away while walking. The next poll will pick up the change.
+				return nil
+			}
+			fmt.Fprintf(h, "%s\x00%d\x00%d\x00", path, info.Size(), info.ModTime().UnixNano())
+			return nil
+		})
+	}
+
+	return h.Sum64()
+}
+
+// ---------------------------------------------------------------------------
+// end
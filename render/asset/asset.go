@@ -47,10 +47,65 @@ var gfmReplace []*gfmReplacer
 var sectionSplitRegex = regexp.MustCompile("\\[\\[[\\w\\-\\/]+\\]\\]")
 var gfmMapSplit = regexp.MustCompile(":")
 
+// CompileError describes an asset file that was skipped because it could not be compiled
+type CompileError struct {
+	File    string `json:"file"`
+	Message string `json:"message"`
+}
+
+func (e *CompileError) Error() string {
+	return e.File + ": " + e.Message
+}
+
+var compileErrors []*CompileError
+
+// ---------------------------------------------------------------------------
+// Errors returns the problems found by every call to Compile
+func Errors() []*CompileError {
+	return compileErrors
+}
+
+// ---------------------------------------------------------------------------
+// Reset discards every compiled asset, so that the asset directories can be compiled afresh
+func Reset() {
+	_bindata = map[string][]byte{}
+	_metadata = map[string]map[string]string{}
+	guideReplacer = nil
+	gfmReplace = nil
+	compileErrors = nil
+}
+
+func compileError(file string, format string, args ...interface{}) {
+	e := &CompileError{File: file, Message: fmt.Sprintf(format, args...)}
+	logger.Errorf(nil, "  * Error %s\n", e)
+
+	// Directories are compiled again each time a renderer is created, so only keep the first report
+	for _, existing := range compileErrors {
+		if *existing == *e {
+			return
+		}
+	}
+	compileErrors = append(compileErrors, e)
+}
+
+// ---------------------------------------------------------------------------
+// Set is the assets compiled since the last Reset. Reset starts a new set rather than
+// emptying the last, so a set that is no longer being compiled into does not change.
+type Set map[string][]byte
+
+// Compiled returns the assets compiled since the last Reset
+func Compiled() Set {
+	return _bindata
+}
+
 // ---------------------------------------------------------------------------
 func Asset(name string) ([]byte, error) {
+	return Compiled().Asset(name)
+}
+
+func (s Set) Asset(name string) ([]byte, error) {
 	cannonicalName := strings.Replace(name, "\\", "/", -1)
-	if a, ok := _bindata[cannonicalName]; ok {
+	if a, ok := s[cannonicalName]; ok {
 		return a, nil
 	}
 	return nil, fmt.Errorf("Asset %s not found", name)
@@ -58,8 +113,12 @@ func Asset(name string) ([]byte, error) {
 
 // ---------------------------------------------------------------------------
 func AssetNames() []string {
-	names := make([]string, 0, len(_bindata))
-	for name := range _bindata {
+	return Compiled().AssetNames()
+}
+
+func (s Set) AssetNames() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
 		names = append(names, name)
 	}
 	return names
@@ -164,8 +223,8 @@ func Compile(dir string, prefix string) {
 				sections, headings := splitOnSection(string(buf))
 
 				if sections == nil {
-					logger.Errorf(nil, "  * Error no sections defined in overlay file %s\n", relative)
-					os.Exit(1)
+					compileError(path, "no [[section]] markers defined in overlay file")
+					return nil
 				}
 
 				for i, heading := range headings {
@@ -185,8 +244,7 @@ func Compile(dir string, prefix string) {
 			storeTemplate(prefix, relative, guideReplacer.Replace(string(buf)), meta)
 
 		case ".html":
-			logger.Errorf(nil, "  * Error - Refusing to process .html files. Expects HTML template fragments with .tmpl extension. File %s\n", relative)
-			os.Exit(1)
+			compileError(path, "refusing to process .html files. Expects HTML template fragments with .tmpl extension")
 
 		default:
 			storeTemplate(prefix, relative, guideReplacer.Replace(string(buf)), meta)
@@ -31,6 +31,7 @@ import (
 	"github.com/UKHomeOffice/dapperdox/render/asset"
 	"github.com/UKHomeOffice/dapperdox/spec"
 	"github.com/ian-kent/htmlform"
+	"github.com/justinas/nosurf"
 	"github.com/unrolled/render"
 )
 
@@ -43,15 +44,37 @@ type overlayPathList []string
 
 var guides = map[string]GuideType{} // Guides are per specification-id, or 'top-level'
 
+var apiSuite map[string]*spec.APISpecification // The specifications rendered
+var hasDiagnostics bool
+
 // Vars is a map of variables
 type Vars map[string]interface{}
 
 var counter int
 
-// ----------------------------------------------------------------------------------------
+// registered is what Register compiles, which is rendered once Serve is called
+var registered = struct {
+	render         *render.Render
+	guides         map[string]GuideType
+	apiSuite       map[string]*spec.APISpecification
+	hasDiagnostics bool
+}{guides: map[string]GuideType{}}
 
+// ----------------------------------------------------------------------------------------
+// Register compiles the assets against the loaded specifications, for the guides navigation
+// to be set against. Nothing is rendered with them until Serve is called, so that what is
+// being rendered is not changed while it is registered.
 func Register() {
-	Render = New()
+	registered.render = New()
+	registered.guides = map[string]GuideType{} // Navigation is set again as the guides are registered
+	registered.apiSuite, registered.hasDiagnostics = spec.APISuite, len(spec.Diagnostics) > 0
+}
+
+// ----------------------------------------------------------------------------------------
+// Serve renders with what was last registered
+func Serve() {
+	Render, guides = registered.render, registered.guides
+	apiSuite, hasDiagnostics = registered.apiSuite, registered.hasDiagnostics
 }
 
 // ----------------------------------------------------------------------------------------
@@ -59,6 +82,80 @@ func Register() {
 func New() *render.Render {
 	logger.Tracef(nil, "creating instance of render.Render")
 
+	compileAssets()
+
+	return newRender(asset.Compiled())
+}
+
+// newRender creates a renderer of the templates of a set of compiled assets
+func newRender(assets asset.Set) *render.Render {
+	return render.New(render.Options{
+		Asset:      assets.Asset,
+		AssetNames: assets.AssetNames,
+		Directory:  templatesDir,
+		Layout:     "layout",
+		Funcs:      []template.FuncMap{templateFuncs(assets)},
+	})
+}
+
+// ----------------------------------------------------------------------------------------
+// TemplateError describes a template that does not parse
+type TemplateError struct {
+	File    string `json:"file"`
+	Message string `json:"message"`
+}
+
+func (e *TemplateError) Error() string {
+	return e.File + ": " + e.Message
+}
+
+// templatesDir is the asset directory the templates are compiled into
+const templatesDir = "assets/templates"
+
+// helperFuncs stand in for the functions github.com/unrolled/render adds to each template
+// as it is parsed, which are only given values as the template is executed.
+var helperFuncs = template.FuncMap{
+	"yield":   func() string { return "" },
+	"partial": func() string { return "" },
+	"current": func() string { return "" },
+	"block":   func() string { return "" },
+}
+
+// ----------------------------------------------------------------------------------------
+// Check compiles the assets as New does, and parses each template as the renderer would,
+// returning every template that does not parse where New panics on the first of them.
+func Check() []*TemplateError {
+	logger.Tracef(nil, "checking templates")
+
+	compileAssets()
+
+	var errors []*TemplateError
+	templates := template.New(templatesDir)
+	assets := asset.Compiled()
+
+	for _, path := range assets.AssetNames() {
+		if !strings.HasPrefix(path, templatesDir+"/") {
+			continue
+		}
+		name := strings.TrimPrefix(path, templatesDir+"/")
+		if i := strings.Index(name, "."); i == -1 || name[i:] != ".tmpl" {
+			continue
+		}
+
+		b, err := assets.Asset(path)
+		if err == nil {
+			_, err = templates.New(strings.TrimSuffix(name, ".tmpl")).Funcs(templateFuncs(assets)).Funcs(helperFuncs).Parse(string(b))
+		}
+		if err != nil {
+			errors = append(errors, &TemplateError{File: path, Message: err.Error()})
+		}
+	}
+	return errors
+}
+
+// ----------------------------------------------------------------------------------------
+// compileAssets compiles the assets directories, themes and sections, in order of priority
+func compileAssets() {
 	cfg, _ := config.Get()
 
 	asset.CompileGFMMap()
@@ -89,30 +186,28 @@ func New() *render.Render {
 	asset.Compile(cfg.DefaultAssetsDir+"/templates", "assets/templates")
 	// Fallback to local static directory
 	asset.Compile(cfg.DefaultAssetsDir+"/static", "assets/static")
+}
 
-	return render.New(render.Options{
-		Asset:      asset.Asset,
-		AssetNames: asset.AssetNames,
-		Directory:  "assets/templates",
-		Layout:     "layout",
-		Funcs: []template.FuncMap{template.FuncMap{
-			"map":           htmlform.Map,
-			"ext":           htmlform.Extend,
-			"fnn":           htmlform.FirstNotNil,
-			"arr":           htmlform.Arr,
-			"lc":            strings.ToLower,
-			"uc":            strings.ToUpper,
-			"join":          strings.Join,
-			"concat":        func(a, b string) string { return a + b },
-			"counter_set":   func(a int) int { counter = a; return counter },
-			"counter_add":   func(a int) int { counter += a; return counter },
-			"mod":           func(a int, m int) int { return a % m },
-			"safehtml":      func(s string) template.HTML { return template.HTML(s) },
-			"haveTemplate":  func(n string) *template.Template { return TemplateLookup(n) },
-			"overlay":       func(n string, d ...interface{}) template.HTML { return overlay(n, d) },
-			"getAssetPaths": func(s string, d ...interface{}) []string { return getAssetPaths(s, d) },
-		}},
-	})
+// ----------------------------------------------------------------------------------------
+// templateFuncs are the functions available to every template of a set of compiled assets
+func templateFuncs(assets asset.Set) template.FuncMap {
+	return template.FuncMap{
+		"map":           htmlform.Map,
+		"ext":           htmlform.Extend,
+		"fnn":           htmlform.FirstNotNil,
+		"arr":           htmlform.Arr,
+		"lc":            strings.ToLower,
+		"uc":            strings.ToUpper,
+		"join":          strings.Join,
+		"concat":        func(a, b string) string { return a + b },
+		"counter_set":   func(a int) int { counter = a; return counter },
+		"counter_add":   func(a int) int { counter += a; return counter },
+		"mod":           func(a int, m int) int { return a % m },
+		"safehtml":      func(s string) template.HTML { return template.HTML(s) },
+		"haveTemplate":  func(n string) *template.Template { return TemplateLookup(n) },
+		"overlay":       func(n string, d ...interface{}) template.HTML { return overlay(assets, n, d) },
+		"getAssetPaths": func(s string, d ...interface{}) []string { return getAssetPaths(s, d) },
+	}
 }
 
 // ----------------------------------------------------------------------------------------
@@ -143,7 +238,7 @@ func (w HTMLWriter) Write(data []byte) (int, error) { return w.h.Write(data) }
 func (w HTMLWriter) Flush()                         { w.h.Flush() }
 
 // XXX WHY ARRAY of DATA?
-func overlay(name string, data []interface{}) template.HTML { // TODO Will be specification specific
+func overlay(assets asset.Set, name string, data []interface{}) template.HTML { // TODO Will be specification specific
 
 	if data == nil || data[0] == nil {
 		logger.Printf(nil, "Data nil\n")
@@ -177,7 +272,7 @@ func overlay(name string, data []interface{}) template.HTML { // TODO Will be sp
 		logger.Tracef(nil, "Applying overlay '%s'\n", overlay)
 		writer := HTMLWriter{h: bufio.NewWriter(&b)}
 
-		r := New()
+		r := newRender(assets) // The renderer of the page is busy rendering it
 		// data is a single item array (though I've not figured out why yet!)
 		r.HTML(writer, http.StatusOK, overlay, data[0], render.HTMLOptions{Layout: ""})
 		writer.Flush()
@@ -225,6 +320,12 @@ func HTML(w http.ResponseWriter, status int, name string, binding interface{}, h
 	Render.HTML(w, status, name, binding, htmlOpt...)
 }
 
+// ----------------------------------------------------------------------------------------
+// JSON is an alias to github.com/unrolled/render.Render.JSON
+func JSON(w http.ResponseWriter, status int, v interface{}) {
+	Render.JSON(w, status, v)
+}
+
 // ----------------------------------------------------------------------------------------
 func TemplateLookup(t string) *template.Template {
 	return Render.TemplateLookup(t)
@@ -240,11 +341,16 @@ func DefaultVars(req *http.Request, apiSpec *spec.APISpecification, m Vars) map[
 
 	cfg, _ := config.Get()
 	m["Config"] = cfg
-	m["APISuite"] = spec.APISuite
+	m["APISuite"] = apiSuite
+	m["HasDiagnostics"] = hasDiagnostics
+	m["LiveReload"] = cfg.Watch && cfg.LiveReload
+	if req != nil {
+		m["CSRFToken"] = nosurf.Token(req)
+	}
 
 	// If we have a multiple specifications or are forcing a parent "root" page for the single specification
 	// then set MultipleSpecs to true to enable navigation back to the root page.
-	if cfg.ForceSpecList || len(spec.APISuite) > 1 {
+	if cfg.ForceSpecList || len(apiSuite) > 1 {
 		m["MultipleSpecs"] = true
 	}
 
@@ -262,9 +368,12 @@ func DefaultVars(req *http.Request, apiSpec *spec.APISpecification, m Vars) map[
 	m["SpecPath"] = "/" + apiSpec.ID
 	m["APIs"] = apiSpec.APIs
 	m["APIVersions"] = apiSpec.APIVersions
+	m["VersionList"] = spec.NewestFirst(apiSpec.Versions())
 	m["Resources"] = apiSpec.ResourceList
 	m["Info"] = apiSpec.APIInfo
 	m["SpecURL"] = apiSpec.URL
+	m["SpecBundled"] = apiSpec.Bundled
+	m["OAuth2Clients"] = cfg.OAuth2Clients(apiSpec.ID)
 
 	return m
 }
@@ -275,7 +384,7 @@ func SetGuidesNavigation(apiSpec *spec.APISpecification, guidesnav *[]*navigatio
 	if apiSpec != nil {
 		id = apiSpec.ID
 	}
-	guides[id] = *guidesnav
+	registered.guides[id] = *guidesnav
 }
 
 // ----------------------------------------------------------------------------------------
@@ -0,0 +1,444 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+// A specification may be split across several files, such as paths/*.yaml and schemas/*.yaml,
+// with each $ref resolved relative to the file that holds it. Bundling assembles the files into
+// a single document before it is loaded, as kin-openapi does not follow a $ref to a whole file,
+// nor a $ref from one path item to another file. Referenced schemas are hoisted into the
+// schemas of the document, which keeps recursive schemas intact, and everything else that is
+// referenced is copied in place of its $ref.
+
+// Where a $ref appears, and so whether its target is a schema
+type refContext int
+
+const (
+	otherContext      refContext = iota
+	schemaContext                // A schema
+	schemaMapContext             // A map of names on to schemas, such as properties
+	schemaListContext            // A list of schemas, such as allOf
+)
+
+type bundler struct {
+	root     string                 // The location of the root document
+	home     string                 // The $ref prefix of the schemas of the document
+	remote   bool                   // The root document is remote, so may not reference local files
+	dir      string                 // The directory local files must be within, if any
+	replacer *strings.Replacer      // Applied to local files as they are read
+	docs     map[string]interface{} // Parsed documents, by location
+	hoisted  map[string]string      // Schema name, by the location and pointer of the schema
+	schemas  map[string]interface{} // Hoisted schemas, by name
+	names    map[string]bool        // Schema names in use
+	inlining map[string]bool        // Targets being copied, to detect a circular $ref
+}
+
+var schemaNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// httpClient fetches referenced documents, giving up on a host that does not answer
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// -----------------------------------------------------------------------------
+
+// bundle assembles a specification split across several files into a single document, which
+// it returns as JSON. A document without any $ref to another file is returned unchanged, with
+// bundled false.
+func bundle(src specSource, data []byte) (document []byte, bundled bool, err error) {
+
+	root, err := parseDocument(data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	base := src.Base().ResolveReference(&url.URL{}) // Without any dot segments
+	b := &bundler{
+		root:     base.String(),
+		home:     "#/definitions/",
+		docs:     map[string]interface{}{base.String(): root},
+		hoisted:  make(map[string]string),
+		schemas:  make(map[string]interface{}),
+		names:    make(map[string]bool),
+		inlining: make(map[string]bool),
+	}
+	if isOpenAPI3(data) {
+		b.home = "#/components/schemas/"
+	}
+	if file, ok := src.(*fileSource); ok {
+		b.replacer = file.replacer
+		b.dir = file.dir
+	} else {
+		b.remote = true
+	}
+
+	schemas := b.schemaSection(root)
+	for name := range schemas {
+		b.names[name] = true
+	}
+
+	if !b.external(root, base) {
+		return data, false, nil
+	}
+
+	if root, err = b.walk(root, base, otherContext); err != nil {
+		return nil, false, err
+	}
+
+	for name, schema := range b.schemas {
+		schemas[name] = schema
+	}
+
+	document, err = json.Marshal(root)
+	return document, true, err
+}
+
+// -----------------------------------------------------------------------------
+
+// BundleFile assembles the local specification file at path, and the files it references,
+// into a single document in the format of the file. The files referenced must be within dir.
+func BundleFile(path string, dir string) ([]byte, error) {
+
+	src := &fileSource{path: path, replacer: SpecReplacer(), dir: dir}
+
+	data, err := src.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	document, bundled, err := bundle(src, data)
+	if err != nil || !bundled || isJSON(data) {
+		return document, err
+	}
+	return yaml.JSONToYAML(document)
+}
+
+// -----------------------------------------------------------------------------
+
+// external reports whether node holds a $ref to any document but the root.
+func (b *bundler) external(node interface{}, base *url.URL) bool {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := n["$ref"].(string); ok {
+			if u, err := url.Parse(ref); err == nil {
+				target := base.ResolveReference(u)
+				target.Fragment = ""
+				return target.String() != b.root
+			}
+		}
+		for _, v := range n {
+			if b.external(v, base) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, v := range n {
+			if b.external(v, base) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
+
+// walk replaces every $ref within node, which belongs to the document at base.
+func (b *bundler) walk(node interface{}, base *url.URL, context refContext) (interface{}, error) {
+	var err error
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := n["$ref"].(string); ok {
+			return b.ref(ref, base, context == schemaContext)
+		}
+		for k, v := range n {
+			if n[k], err = b.walk(v, base, childContext(k, context)); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		elementContext := otherContext
+		if context == schemaListContext {
+			elementContext = schemaContext
+		}
+		for i, v := range n {
+			if n[i], err = b.walk(v, base, elementContext); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return node, nil
+}
+
+// childContext gives the context of the member key of a node in the given context.
+func childContext(key string, context refContext) refContext {
+	if context == schemaMapContext {
+		return schemaContext
+	}
+
+	switch key {
+	case "schema":
+		return schemaContext
+	case "schemas", "definitions":
+		return schemaMapContext
+	}
+
+	if context == schemaContext {
+		switch key {
+		case "items", "additionalProperties", "not":
+			return schemaContext
+		case "properties":
+			return schemaMapContext
+		case "allOf", "anyOf", "oneOf":
+			return schemaListContext
+		}
+	}
+	return otherContext
+}
+
+// -----------------------------------------------------------------------------
+
+// ref resolves a $ref found in the document at base. A $ref into the root document is kept.
+// A schema elsewhere is hoisted into the schemas of the root document, and anything else is
+// copied in place of the $ref.
+func (b *bundler) ref(ref string, base *url.URL, schema bool) (interface{}, error) {
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $ref %s: %s", ref, err)
+	}
+	target := base.ResolveReference(u)
+	pointer := target.Fragment
+	target.Fragment = ""
+	location := target.String()
+
+	if location == b.root {
+		return map[string]interface{}{"$ref": "#" + pointer}, nil
+	}
+
+	key := location + "#" + pointer
+
+	if schema || strings.Contains(pointer, "/schemas/") || strings.HasPrefix(pointer, "/definitions/") {
+		if name, ok := b.hoisted[key]; ok {
+			return map[string]interface{}{"$ref": b.home + name}, nil
+		}
+		name := b.schemaName(location, pointer)
+		b.hoisted[key] = name // Before walking the schema, in case it refers to itself
+
+		node, err := b.resolve(target, pointer)
+		if err != nil {
+			return nil, fmt.Errorf("unresolved $ref %s: %s", ref, err)
+		}
+		if b.schemas[name], err = b.walk(node, target, schemaContext); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"$ref": b.home + name}, nil
+	}
+
+	if b.inlining[key] {
+		return nil, fmt.Errorf("circular $ref %s", ref)
+	}
+	b.inlining[key] = true
+	defer delete(b.inlining, key)
+
+	node, err := b.resolve(target, pointer)
+	if err != nil {
+		return nil, fmt.Errorf("unresolved $ref %s: %s", ref, err)
+	}
+	return b.walk(node, target, otherContext)
+}
+
+// -----------------------------------------------------------------------------
+
+// resolve returns a copy of the node at the JSON pointer within the document at location.
+func (b *bundler) resolve(location *url.URL, pointer string) (interface{}, error) {
+
+	doc, ok := b.docs[location.String()]
+	if !ok {
+		data, err := b.read(location)
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = parseDocument(data); err != nil {
+			return nil, err
+		}
+		b.docs[location.String()] = doc
+	}
+
+	node := doc
+	if pointer != "" && pointer != "/" {
+		for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+			token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+
+			switch n := node.(type) {
+			case map[string]interface{}:
+				if node, ok = n[token]; !ok {
+					return nil, fmt.Errorf("%s has no member %s", location, pointer)
+				}
+			case []interface{}:
+				i, err := strconv.Atoi(token)
+				if err != nil || i < 0 || i >= len(n) {
+					return nil, fmt.Errorf("%s has no member %s", location, pointer)
+				}
+				node = n[i]
+			default:
+				return nil, fmt.Errorf("%s has no member %s", location, pointer)
+			}
+		}
+	}
+
+	// The copy is walked, leaving the document as read for any other $ref to the same node
+	return copyNode(node), nil
+}
+
+// read reads a referenced document, from a file or from http(s). A remotely hosted document
+// may only reference others over http(s), and a local file only files within the spec-dir,
+// so that a specification cannot pull other files of the server into the documentation.
+func (b *bundler) read(location *url.URL) ([]byte, error) {
+
+	if location.Scheme != "http" && location.Scheme != "https" {
+		if b.remote || (location.Scheme != "" && location.Scheme != "file") || location.Host != "" {
+			return nil, fmt.Errorf("$ref to %s is not allowed from %s", location, b.root)
+		}
+		file := filepath.FromSlash(location.Path)
+		if b.dir != "" {
+			rel, err := filepath.Rel(b.dir, file)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return nil, fmt.Errorf("$ref to %s is outside of the spec-dir", location)
+			}
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if b.replacer != nil {
+			data = []byte(b.replacer.Replace(string(data)))
+		}
+		return data, nil
+	}
+
+	resp, err := httpClient.Get(location.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s returned status %d", location, resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// -----------------------------------------------------------------------------
+
+// schemaName names a hoisted schema after the member it was found under or, for a schema that
+// is a whole file, after the file. A name already in use is numbered.
+func (b *bundler) schemaName(location, pointer string) string {
+
+	name := path.Base(pointer)
+	if pointer == "" || pointer == "/" {
+		name = strings.TrimSuffix(path.Base(location), path.Ext(location))
+	}
+	name = schemaNameChars.ReplaceAllString(strings.Replace(name, "~1", "/", -1), "_")
+
+	unique := name
+	for i := 2; b.names[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	b.names[unique] = true
+	return unique
+}
+
+// schemaSection returns the map of the root document that holds its schemas, creating it if
+// need be.
+func (b *bundler) schemaSection(root interface{}) map[string]interface{} {
+
+	doc, ok := root.(map[string]interface{})
+	if !ok {
+		return make(map[string]interface{})
+	}
+
+	parent := doc
+	key := "definitions"
+	if b.home == "#/components/schemas/" {
+		components, ok := doc["components"].(map[string]interface{})
+		if !ok {
+			components = make(map[string]interface{})
+			doc["components"] = components
+		}
+		parent = components
+		key = "schemas"
+	}
+
+	schemas, ok := parent[key].(map[string]interface{})
+	if !ok {
+		schemas = make(map[string]interface{})
+		parent[key] = schemas
+	}
+	return schemas
+}
+
+// -----------------------------------------------------------------------------
+
+// parseDocument parses a JSON or YAML document.
+func parseDocument(data []byte) (interface{}, error) {
+	if !isJSON(data) {
+		var err error
+		if data, err = yaml.YAMLToJSON(data); err != nil {
+			return nil, err
+		}
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// copyNode makes a deep copy of a parsed document node.
+func copyNode(node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(n))
+		for k, v := range n {
+			c[k] = copyNode(v)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(n))
+		for i, v := range n {
+			c[i] = copyNode(v)
+		}
+		return c
+	}
+	return node
+}
@@ -0,0 +1,190 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+package spec
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-openapi/spec"
+)
+
+// Constraints describes the limits a schema places on the value of a parameter or property,
+// besides its type and enumeration. Numbers are held as they are to be shown, with "" when
+// the schema does not give them. For an array, the limits on values are those of its items,
+// as is its enumeration.
+type Constraints struct {
+	Minimum              string
+	Maximum              string
+	ExclusiveMinimum     bool
+	ExclusiveMaximum     bool
+	MultipleOf           string
+	MinLength            string
+	MaxLength            string
+	Pattern              string
+	MinItems             string
+	MaxItems             string
+	UniqueItems          bool
+	Default              string // As JSON
+	Nullable             bool
+	WriteOnly            bool
+	AdditionalProperties string // "any" or "none", when allowed or forbidden without a schema
+}
+
+// -----------------------------------------------------------------------------
+
+// getConstraints2 reads the constraints of a Swagger 2 schema, given the schema of its values,
+// which for an array is the schema of its items. Swagger 2 has no nullable member, so the
+// x-nullable extension is read instead.
+func getConstraints2(s *spec.Schema, values *spec.Schema) Constraints {
+	c := Constraints{
+		Minimum:          formatFloat(values.Minimum),
+		Maximum:          formatFloat(values.Maximum),
+		ExclusiveMinimum: values.ExclusiveMinimum,
+		ExclusiveMaximum: values.ExclusiveMaximum,
+		MultipleOf:       formatFloat(values.MultipleOf),
+		MinLength:        formatMin(values.MinLength),
+		MaxLength:        formatInt(values.MaxLength),
+		Pattern:          values.Pattern,
+		MinItems:         formatMin(s.MinItems),
+		MaxItems:         formatInt(s.MaxItems),
+		UniqueItems:      s.UniqueItems,
+		Default:          formatDefault(s.Default),
+	}
+	getExtension(s.Extensions, "x-nullable", &c.Nullable)
+
+	if s.AdditionalProperties != nil && s.AdditionalProperties.Schema == nil {
+		c.AdditionalProperties = "none"
+		if s.AdditionalProperties.Allows {
+			c.AdditionalProperties = "any"
+		}
+	}
+	return c
+}
+
+// getConstraints3 reads the constraints of an OpenAPI 3 schema, given the schema of its
+// values, which for an array is the schema of its items.
+func getConstraints3(s *openapi3.Schema, values *openapi3.Schema) Constraints {
+	c := Constraints{
+		Minimum:          formatFloat(values.Min),
+		Maximum:          formatFloat(values.Max),
+		ExclusiveMinimum: values.ExclusiveMin,
+		ExclusiveMaximum: values.ExclusiveMax,
+		MultipleOf:       formatFloat(values.MultipleOf),
+		Pattern:          values.Pattern,
+		UniqueItems:      s.UniqueItems,
+		Default:          formatDefault(s.Default),
+		Nullable:         s.Nullable,
+		WriteOnly:        s.WriteOnly,
+	}
+	if values.MinLength > 0 {
+		c.MinLength = strconv.FormatUint(values.MinLength, 10)
+	}
+	if values.MaxLength != nil {
+		c.MaxLength = strconv.FormatUint(*values.MaxLength, 10)
+	}
+	if s.MinItems > 0 {
+		c.MinItems = strconv.FormatUint(s.MinItems, 10)
+	}
+	if s.MaxItems != nil {
+		c.MaxItems = strconv.FormatUint(*s.MaxItems, 10)
+	}
+
+	if s.AdditionalProperties == nil && s.AdditionalPropertiesAllowed != nil {
+		c.AdditionalProperties = "none"
+		if *s.AdditionalPropertiesAllowed {
+			c.AdditionalProperties = "any"
+		}
+	}
+	return c
+}
+
+// getParameterConstraints2 reads the constraints of a Swagger 2 parameter that is not in the
+// body, whose values are constrained by its items when it is an array.
+func getParameterConstraints2(param spec.Parameter) Constraints {
+	values := param.CommonValidations
+	if param.Type == "array" && param.Items != nil {
+		values = param.Items.CommonValidations
+	}
+
+	c := Constraints{
+		Minimum:          formatFloat(values.Minimum),
+		Maximum:          formatFloat(values.Maximum),
+		ExclusiveMinimum: values.ExclusiveMinimum,
+		ExclusiveMaximum: values.ExclusiveMaximum,
+		MultipleOf:       formatFloat(values.MultipleOf),
+		MinLength:        formatMin(values.MinLength),
+		MaxLength:        formatInt(values.MaxLength),
+		Pattern:          values.Pattern,
+		MinItems:         formatMin(param.MinItems),
+		MaxItems:         formatInt(param.MaxItems),
+		UniqueItems:      param.UniqueItems,
+		Default:          formatDefault(param.Default),
+	}
+	getExtension(param.Extensions, "x-nullable", &c.Nullable)
+	return c
+}
+
+// getParameterConstraints3 reads the constraints of the schema of an OpenAPI 3 parameter.
+func getParameterConstraints3(param *openapi3.Parameter) Constraints {
+	if param.Schema == nil || param.Schema.Value == nil {
+		return Constraints{}
+	}
+	s := param.Schema.Value
+
+	values := s
+	if s.Type == "array" && s.Items != nil && s.Items.Value != nil {
+		values = s.Items.Value
+	}
+	return getConstraints3(s, values)
+}
+
+// -----------------------------------------------------------------------------
+
+func formatFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func formatInt(i *int64) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.FormatInt(*i, 10)
+}
+
+// formatMin formats a minimum length or number of items, for which zero is no constraint.
+func formatMin(i *int64) string {
+	if i == nil || *i == 0 {
+		return ""
+	}
+	return strconv.FormatInt(*i, 10)
+}
+
+func formatDefault(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,213 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+package spec
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Deprecation describes the deprecation of a tag, operation, parameter or property. Besides
+// the deprecated member of an operation or parameter, it is read from the extensions:
+//
+//	x-deprecated: true                   for elements that have no deprecated member
+//	x-sunset: 2019-06-30                 the date the element is, or was, withdrawn
+//	x-replaced-by: /reference/pets/v2    a link to what replaces the element
+//
+// Giving a sunset or replacement deprecates the element.
+type Deprecation struct {
+	Deprecated  bool
+	Sunset      time.Time // Zero when no sunset is given
+	Replacement string
+}
+
+// Withdrawn reports whether the sunset has passed.
+func (d Deprecation) Withdrawn() bool {
+	return !d.Sunset.IsZero() && time.Now().After(d.Sunset)
+}
+
+// getDeprecation reads the deprecation extensions of an element, given whether the element is
+// deprecated by its own deprecated member. Pointer locates the element for diagnostics.
+func (c *APISpecification) getDeprecation(extensions map[string]interface{}, deprecated bool, pointer string) Deprecation {
+	d := Deprecation{Deprecated: deprecated}
+
+	var xDeprecated bool
+	if getExtension(extensions, "x-deprecated", &xDeprecated) && xDeprecated {
+		d.Deprecated = true
+	}
+
+	var sunset string
+	if getExtension(extensions, "x-sunset", &sunset) && sunset != "" {
+		t, err := parseDate(sunset)
+		if err != nil {
+			c.warnf(pointer+"/x-sunset", "Invalid sunset date %s", sunset)
+		} else {
+			d.Sunset = t
+			d.Deprecated = true
+		}
+	}
+
+	if getExtension(extensions, "x-replaced-by", &d.Replacement) && d.Replacement != "" {
+		d.Deprecated = true
+	}
+	return d
+}
+
+// getTagDeprecations3 reads the deprecation of each top level tag of an OpenAPI 3 document,
+// keyed by tag name. kin-openapi drops the extensions of a tag, so the tags are decoded again
+// from the raw tags member.
+func (c *APISpecification) getTagDeprecations3(spec *openapi3.Swagger) map[string]Deprecation {
+	deprecations := make(map[string]Deprecation)
+
+	var tags []map[string]interface{}
+	getExtension3(spec.ExtensionProps, "tags", &tags)
+
+	for i, tag := range tags {
+		name, _ := tag["name"].(string)
+		deprecations[name] = c.getDeprecation(tag, false, jsonPointer("tags", strconv.Itoa(i)))
+	}
+	return deprecations
+}
+
+// -----------------------------------------------------------------------------
+
+// DeprecatedElement is a single deprecated element of a specification, as listed by the
+// deprecations report.
+type DeprecatedElement struct {
+	Element     string `json:"element"`             // version, tag, operation, parameter or property
+	Name        string `json:"name"`                // Such as the operation's method and path, or the parameter name
+	Version     string `json:"version"`             // The version of the specification the element belongs to
+	Operation   string `json:"operation,omitempty"` // The method and path of a parameter's operation
+	Sunset      string `json:"sunset,omitempty"`    // The sunset date, as an RFC 3339 date
+	Withdrawn   bool   `json:"withdrawn"`           // Whether the sunset has passed
+	Replacement string `json:"replacement,omitempty"`
+	Path        string `json:"path"` // The path of the reference page for the element
+}
+
+// DeprecationReport lists every deprecated element of a specification
+type DeprecationReport struct {
+	Specification string              `json:"specification"`
+	Deprecations  []DeprecatedElement `json:"deprecations"`
+}
+
+// -----------------------------------------------------------------------------
+
+// Deprecations lists the deprecated elements of every version of the specification, newest
+// version first.
+func (c *APISpecification) Deprecations() *DeprecationReport {
+	report := &DeprecationReport{Specification: c.ID, Deprecations: make([]DeprecatedElement, 0)}
+
+	add := func(element, name, version, operation, path string, d Deprecation) {
+		e := DeprecatedElement{
+			Element:     element,
+			Name:        name,
+			Version:     version,
+			Operation:   operation,
+			Withdrawn:   d.Withdrawn(),
+			Replacement: d.Replacement,
+			Path:        "/" + c.ID + path + "?v=" + version,
+		}
+		if !d.Sunset.IsZero() {
+			e.Sunset = d.Sunset.Format("2006-01-02")
+		}
+		report.Deprecations = append(report.Deprecations, e)
+	}
+
+	for _, version := range NewestFirst(c.Versions()) {
+		if status := c.VersionStatus(version); status != nil && (status.Deprecated || !status.Sunset.IsZero()) {
+			add("version", version, version, "", "", Deprecation{Deprecated: true, Sunset: status.Sunset})
+		}
+
+		for _, api := range c.APIVersions[version] {
+			apiPath := "/reference/" + api.ID
+			if api.Deprecated {
+				add("tag", api.Name, version, "", apiPath, api.Deprecation)
+			}
+
+			for _, method := range api.Methods {
+				operation := strings.ToUpper(method.Method) + " " + method.Path
+				methodPath := apiPath + "/" + method.ID
+				if method.Deprecated {
+					add("operation", operation, version, "", methodPath, method.Deprecation)
+				}
+
+				for _, params := range [][]Parameter{method.PathParams, method.QueryParams, method.HeaderParams, method.FormParams} {
+					for _, param := range params {
+						if param.Deprecated {
+							add("parameter", param.Name, version, operation, methodPath, param.Deprecation)
+						}
+					}
+				}
+			}
+		}
+
+		resources := c.ResourceList[version]
+		ids := make([]string, 0, len(resources))
+		for id := range resources {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		seen := make(map[*Resource]bool)
+		for _, id := range ids {
+			resource := resources[id]
+			for _, name := range deprecatedProperties(resource, resource.ID, seen) {
+				add("property", name.name, version, "", "/resources/"+resource.ID, name.deprecation)
+			}
+		}
+	}
+
+	return report
+}
+
+// -----------------------------------------------------------------------------
+
+type deprecatedProperty struct {
+	name        string
+	deprecation Deprecation
+}
+
+// deprecatedProperties lists the deprecated properties of a resource, and of the resources of
+// its properties, named by their path from the resource. Seen guards against recursive schemas.
+func deprecatedProperties(r *Resource, prefix string, seen map[*Resource]bool) []deprecatedProperty {
+	if r == nil || seen[r] {
+		return nil
+	}
+	seen[r] = true
+
+	names := make([]string, 0, len(r.Properties))
+	for name := range r.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var deprecated []deprecatedProperty
+	for _, name := range names {
+		property := r.Properties[name]
+		if property.Deprecated {
+			deprecated = append(deprecated, deprecatedProperty{name: prefix + "." + name, deprecation: property.Deprecation})
+		}
+		if property.Link() == "" { // Otherwise listed under the resource of its schema
+			deprecated = append(deprecated, deprecatedProperties(property, prefix+"."+name, seen)...)
+		}
+	}
+	return deprecated
+}
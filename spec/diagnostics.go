@@ -0,0 +1,110 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+package spec
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/UKHomeOffice/dapperdox/logger"
+)
+
+// Severity of a problem found while loading a specification
+type Severity string
+
+const (
+	// SeverityError is a problem that caused part of a specification, or all of it, to be skipped
+	SeverityError Severity = "error"
+	// SeverityWarning is a problem that was worked around, so the documentation may be degraded
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic describes a problem found while loading a specification
+type Diagnostic struct {
+	Spec     string   `json:"spec"`     // The location of the specification
+	Pointer  string   `json:"pointer"`  // JSON pointer to the member at fault
+	Severity Severity `json:"severity"` // error or warning
+	Message  string   `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s#%s: %s", d.Severity, d.Spec, d.Pointer, d.Message)
+}
+
+// Diagnostics holds every problem found by the last call to LoadSpecifications, across all
+// specifications, including those that could not be loaded at all.
+var Diagnostics []Diagnostic
+
+// -----------------------------------------------------------------------------
+
+// HasErrors reports whether any of the diagnostics is an error.
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
+
+// addDiagnostic records a problem with the specification, logging it as it goes.
+func (c *APISpecification) addDiagnostic(severity Severity, pointer string, format string, args ...interface{}) {
+	d := Diagnostic{
+		Spec:     c.URL,
+		Pointer:  pointer,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	}
+
+	if severity == SeverityError {
+		logger.Errorf(nil, "Error: %s", d)
+	} else {
+		logger.Warnf(nil, "Warning: %s", d)
+	}
+
+	c.Diagnostics = append(c.Diagnostics, d)
+}
+
+func (c *APISpecification) errorf(pointer string, format string, args ...interface{}) {
+	c.addDiagnostic(SeverityError, pointer, format, args...)
+}
+
+func (c *APISpecification) warnf(pointer string, format string, args ...interface{}) {
+	c.addDiagnostic(SeverityWarning, pointer, format, args...)
+}
+
+// -----------------------------------------------------------------------------
+
+// jsonPointer builds a JSON pointer (RFC 6901) from its unescaped reference tokens.
+func jsonPointer(tokens ...string) string {
+	var pointer string
+	for _, token := range tokens {
+		token = strings.Replace(token, "~", "~0", -1)
+		token = strings.Replace(token, "/", "~1", -1)
+		pointer += "/" + token
+	}
+	return pointer
+}
+
+// methodPointer is the JSON pointer to an operation of the specification.
+func (c *APISpecification) methodPointer(method *Method) string {
+	path := strings.TrimPrefix(method.Path, c.basePath)
+	return jsonPointer("paths", path, strings.ToLower(method.Method))
+}
@@ -0,0 +1,432 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+package spec
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind classifies a difference between two versions of a specification
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeRemoved ChangeKind = "removed"
+	ChangeChanged ChangeKind = "changed"
+)
+
+// Change is a single difference between two versions of a specification. A change is
+// breaking when a client written against the old version may fail against the new one.
+type Change struct {
+	Rule      string     `json:"rule"` // Names the kind of change, such as operation-removed
+	Kind      ChangeKind `json:"kind"`
+	Element   string     `json:"element"`            // operation, parameter, property, enum or response
+	Operation string     `json:"operation"`          // The method and path of the operation, such as GET /pets
+	Location  string     `json:"location,omitempty"` // Where within the operation, such as query parameter limit
+	Message   string     `json:"message"`
+	Breaking  bool       `json:"breaking"`
+	APIID     string     `json:"-"` // The API, method and version of the operation in the newer
+	MethodID  string     `json:"-"` // version, or the older one if it was removed, for linking
+	Version   string     `json:"-"` // to its reference
+}
+
+// ChangeReport lists every difference between two versions of a specification
+type ChangeReport struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Breaking bool     `json:"breaking"` // Whether any of the changes is breaking
+	Changes  []Change `json:"changes"`
+}
+
+// -----------------------------------------------------------------------------
+
+// Changes compares two versions of the specification.
+func (c *APISpecification) Changes(from, to string) (*ChangeReport, error) {
+	fromAPIs, ok := c.APIVersions[from]
+	if !ok {
+		return nil, fmt.Errorf("specification %s has no version %s", c.ID, from)
+	}
+	toAPIs, ok := c.APIVersions[to]
+	if !ok {
+		return nil, fmt.Errorf("specification %s has no version %s", c.ID, to)
+	}
+
+	changes := CompareAPIs(fromAPIs, toAPIs)
+	for i := range changes {
+		changes[i].Version = to
+		if changes[i].Element == "operation" && changes[i].Kind == ChangeRemoved {
+			changes[i].Version = from
+		}
+	}
+	return NewChangeReport(from, to, changes), nil
+}
+
+// NewChangeReport builds the report of a set of changes.
+func NewChangeReport(from, to string, changes []Change) *ChangeReport {
+	report := &ChangeReport{From: from, To: to, Changes: changes}
+	if report.Changes == nil {
+		report.Changes = make([]Change, 0)
+	}
+	for _, change := range changes {
+		if change.Breaking {
+			report.Breaking = true
+		}
+	}
+	return report
+}
+
+// -----------------------------------------------------------------------------
+
+// CompareAPIs lists the differences between the operations of two sets of APIs, matching
+// operations by their HTTP method and path. Changes are ordered by operation.
+func CompareAPIs(from, to APISet) []Change {
+	d := &differ{}
+
+	fromMethods := methodsByOperation(from)
+	toMethods := methodsByOperation(to)
+
+	for op, f := range fromMethods {
+		if t, ok := toMethods[op]; ok {
+			d.compareMethods(op, f, t)
+		} else {
+			d.add(f, Change{Rule: "operation-removed", Kind: ChangeRemoved, Element: "operation", Operation: op,
+				Message: "Operation removed", Breaking: true})
+		}
+	}
+	for op, t := range toMethods {
+		if _, ok := fromMethods[op]; !ok {
+			d.add(t, Change{Rule: "operation-added", Kind: ChangeAdded, Element: "operation", Operation: op, Message: "Operation added"})
+		}
+	}
+
+	sort.SliceStable(d.changes, func(i, j int) bool {
+		return d.changes[i].Operation < d.changes[j].Operation
+	})
+	return d.changes
+}
+
+// -----------------------------------------------------------------------------
+
+type differ struct {
+	changes []Change
+	method  *Method // The operation being compared
+}
+
+func (d *differ) add(method *Method, change Change) {
+	if method != nil {
+		if method.APIGroup != nil {
+			change.APIID = method.APIGroup.ID
+		}
+		change.MethodID = method.ID
+	}
+	d.changes = append(d.changes, change)
+}
+
+func (d *differ) change(rule string, kind ChangeKind, element, op, location string, breaking bool, format string, args ...interface{}) {
+	d.add(d.method, Change{
+		Rule:      rule,
+		Kind:      kind,
+		Element:   element,
+		Operation: op,
+		Location:  location,
+		Message:   fmt.Sprintf(format, args...),
+		Breaking:  breaking,
+	})
+}
+
+// -----------------------------------------------------------------------------
+
+// methodsByOperation maps the methods of a set of APIs by "METHOD /path". A method that is
+// documented under more than one API (through multiple tags) is the same operation.
+func methodsByOperation(apis APISet) map[string]*Method {
+	methods := make(map[string]*Method)
+	for i := range apis {
+		for j := range apis[i].Methods {
+			m := &apis[i].Methods[j]
+			op := strings.ToUpper(m.Method) + " " + m.Path
+			if _, ok := methods[op]; !ok {
+				methods[op] = m
+			}
+		}
+	}
+	return methods
+}
+
+// -----------------------------------------------------------------------------
+
+func (d *differ) compareMethods(op string, from, to *Method) {
+	d.method = to
+
+	if to.Deprecated && !from.Deprecated {
+		d.change("operation-deprecated", ChangeChanged, "operation", op, "", false, "Operation deprecated")
+	}
+
+	d.compareParameters(op, "path", from.PathParams, to.PathParams)
+	d.compareParameters(op, "query", from.QueryParams, to.QueryParams)
+	d.compareParameters(op, "header", from.HeaderParams, to.HeaderParams)
+	d.compareParameters(op, "form", from.FormParams, to.FormParams)
+
+	// Request body
+	var fromBody, toBody *Resource
+	if from.BodyParam != nil {
+		fromBody = from.BodyParam.Resource
+	}
+	if to.BodyParam != nil {
+		toBody = to.BodyParam.Resource
+	}
+	switch {
+	case fromBody == nil && toBody != nil:
+		required := to.BodyParam.Required
+		d.change("request-body-added", ChangeAdded, "parameter", op, "request body", required, "Request body added")
+	case fromBody != nil && toBody == nil:
+		d.change("request-body-removed", ChangeRemoved, "parameter", op, "request body", true, "Request body removed")
+	case fromBody != nil:
+		if from.BodyParam.IsArray != to.BodyParam.IsArray {
+			d.change("body-array-changed", ChangeChanged, "parameter", op, "request body", true, "Request body changed between a single resource and an array")
+		}
+		if to.BodyParam.Required && !from.BodyParam.Required {
+			d.change("request-body-now-required", ChangeChanged, "parameter", op, "request body", true, "Request body is now required")
+		}
+		d.compareResources(op, "request body", fromBody, toBody, true, make(map[[2]*Resource]bool))
+	}
+
+	d.compareResponses(op, from, to)
+}
+
+// -----------------------------------------------------------------------------
+
+func (d *differ) compareParameters(op, in string, from, to []Parameter) {
+	fromParams := make(map[string]*Parameter)
+	for i := range from {
+		fromParams[from[i].Name] = &from[i]
+	}
+	toParams := make(map[string]*Parameter)
+	for i := range to {
+		toParams[to[i].Name] = &to[i]
+	}
+
+	for _, name := range sortedParameterNames(from) {
+		location := in + " parameter " + name
+		t, ok := toParams[name]
+		if !ok {
+			d.change("parameter-removed", ChangeRemoved, "parameter", op, location, true, "Parameter removed")
+			continue
+		}
+		f := fromParams[name]
+
+		if t.Required && !f.Required {
+			d.change("parameter-now-required", ChangeChanged, "parameter", op, location, true, "Parameter is now required")
+		} else if !t.Required && f.Required {
+			d.change("parameter-now-optional", ChangeChanged, "parameter", op, location, false, "Parameter is now optional")
+		}
+		if typeString(f.Type) != typeString(t.Type) {
+			d.change("type-changed", ChangeChanged, "parameter", op, location, true, "Type changed from %s to %s", typeString(f.Type), typeString(t.Type))
+		}
+		d.compareEnums(op, location, f.Enum, t.Enum, true)
+	}
+
+	for _, name := range sortedParameterNames(to) {
+		if _, ok := fromParams[name]; !ok {
+			required := toParams[name].Required
+			d.change("parameter-added", ChangeAdded, "parameter", op, in+" parameter "+name, required, "%s parameter added", requiredString(required))
+		}
+	}
+}
+
+func sortedParameterNames(params []Parameter) []string {
+	names := make([]string, 0, len(params))
+	for _, p := range params {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// -----------------------------------------------------------------------------
+
+func (d *differ) compareResponses(op string, from, to *Method) {
+	codes := make(map[int]bool)
+	for code := range from.Responses {
+		codes[code] = true
+	}
+	for code := range to.Responses {
+		codes[code] = true
+	}
+	sorted := make([]int, 0, len(codes))
+	for code := range codes {
+		sorted = append(sorted, code)
+	}
+	sort.Ints(sorted)
+
+	for _, code := range sorted {
+		location := "response " + strconv.Itoa(code)
+		f, inFrom := from.Responses[code]
+		t, inTo := to.Responses[code]
+
+		switch {
+		case !inTo:
+			d.change("response-removed", ChangeRemoved, "response", op, location, true, "Response removed")
+		case !inFrom:
+			d.change("response-added", ChangeAdded, "response", op, location, false, "Response added")
+		default:
+			d.compareResponse(op, location, &f, &t)
+		}
+	}
+
+	switch {
+	case from.DefaultResponse != nil && to.DefaultResponse == nil:
+		d.change("response-removed", ChangeRemoved, "response", op, "default response", true, "Response removed")
+	case from.DefaultResponse == nil && to.DefaultResponse != nil:
+		d.change("response-added", ChangeAdded, "response", op, "default response", false, "Response added")
+	case from.DefaultResponse != nil:
+		d.compareResponse(op, "default response", from.DefaultResponse, to.DefaultResponse)
+	}
+}
+
+func (d *differ) compareResponse(op, location string, from, to *Response) {
+	switch {
+	case from.Resource != nil && to.Resource == nil:
+		d.change("response-body-removed", ChangeRemoved, "response", op, location, true, "Response body removed")
+	case from.Resource == nil && to.Resource != nil:
+		d.change("response-body-added", ChangeAdded, "response", op, location, false, "Response body added")
+	case from.Resource != nil:
+		if from.IsArray != to.IsArray {
+			d.change("body-array-changed", ChangeChanged, "response", op, location, true, "Response body changed between a single resource and an array")
+		}
+		d.compareResources(op, location, from.Resource, to.Resource, false, make(map[[2]*Resource]bool))
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// compareResources compares the properties of a resource, recursing into the properties
+// of its properties. What is breaking depends upon the direction the resource travels: a
+// client must be able to send every request resource, and read every response resource.
+func (d *differ) compareResources(op, location string, from, to *Resource, request bool, seen map[[2]*Resource]bool) {
+	pair := [2]*Resource{from, to}
+	if seen[pair] {
+		return
+	}
+	seen[pair] = true
+
+	if typeString(from.Type) != typeString(to.Type) {
+		d.change("type-changed", ChangeChanged, "property", op, location, true, "Type changed from %s to %s", typeString(from.Type), typeString(to.Type))
+	}
+	d.compareEnums(op, location, from.Enum, to.Enum, request)
+
+	names := make(map[string]bool)
+	for name := range from.Properties {
+		names[name] = true
+	}
+	for name := range to.Properties {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		f := from.Properties[name]
+		t := to.Properties[name]
+		propLocation := location + " property " + name
+
+		// Read only properties are never sent in a request
+		if request && ((f != nil && f.ReadOnly) || (t != nil && t.ReadOnly)) {
+			if f != nil && t != nil && !f.ReadOnly && t.ReadOnly {
+				d.change("property-now-read-only", ChangeChanged, "property", op, propLocation, true, "Property is now read only")
+			}
+			continue
+		}
+
+		switch {
+		case t == nil:
+			// A client may still send a removed request property, but can no longer read a
+			// removed response property.
+			d.change("property-removed", ChangeRemoved, "property", op, propLocation, !request, "Property removed")
+		case f == nil:
+			breaking := request && t.Required
+			d.change("property-added", ChangeAdded, "property", op, propLocation, breaking, "%s property added", requiredString(t.Required))
+		default:
+			// A newly required request property must be sent. A response property that is no
+			// longer required may be missing.
+			if t.Required && !f.Required {
+				d.change("property-now-required", ChangeChanged, "property", op, propLocation, request, "Property is now required")
+			} else if !t.Required && f.Required {
+				d.change("property-now-optional", ChangeChanged, "property", op, propLocation, !request, "Property is now optional")
+			}
+			d.compareResources(op, propLocation, f, t, request, seen)
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// compareEnums reports values added to and removed from an enumeration. Narrowing the values
+// a client may send, or widening the values a client may receive, is breaking.
+func (d *differ) compareEnums(op, location string, from, to []string, request bool) {
+	if len(from) == 0 && len(to) == 0 {
+		return
+	}
+
+	fromValues := make(map[string]bool)
+	for _, v := range from {
+		fromValues[v] = true
+	}
+	toValues := make(map[string]bool)
+	for _, v := range to {
+		toValues[v] = true
+	}
+
+	if len(from) == 0 {
+		d.change("enum-restricted", ChangeChanged, "enum", op, location, request, "Values restricted to %s", strings.Join(to, ", "))
+		return
+	}
+	if len(to) == 0 {
+		d.change("enum-unrestricted", ChangeChanged, "enum", op, location, !request, "Values no longer restricted")
+		return
+	}
+
+	for _, v := range from {
+		if !toValues[v] {
+			d.change("enum-value-removed", ChangeRemoved, "enum", op, location, request, "Value %s removed", v)
+		}
+	}
+	for _, v := range to {
+		if !fromValues[v] {
+			d.change("enum-value-added", ChangeAdded, "enum", op, location, !request, "Value %s added", v)
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+func typeString(t []string) string {
+	return strings.Join(t, " of ")
+}
+
+func requiredString(required bool) string {
+	if required {
+		return "Required"
+	}
+	return "Optional"
+}
@@ -0,0 +1,351 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-openapi/spec"
+	"github.com/shurcooL/github_flavored_markdown"
+)
+
+// Examples of resources are generated from their schemas. The example of a value is, in order
+// of preference, the example given by its schema, its default, the first of its enumeration,
+// or a value made up to suit its type and format, and to lie within its minimum and maximum.
+
+// Example is a named example of a request or response body, or of a parameter
+type Example struct {
+	Name          string
+	Summary       string
+	Description   string
+	Value         string // JSON, unless the example is of a media type that is not JSON
+	ExternalValue string // The URL of an example that is not given in place
+}
+
+// Made up values of the string formats
+var formatExamples = map[string]string{
+	"date":      "2017-07-21",
+	"date-time": "2017-07-21T17:32:28Z",
+	"uuid":      "3fa85f64-5717-4562-b3fc-2c963f66afa6",
+	"email":     "user@example.com",
+	"uri":       "https://example.com",
+	"url":       "https://example.com",
+	"hostname":  "example.com",
+	"ipv4":      "192.0.2.1",
+	"ipv6":      "2001:db8::1",
+	"byte":      "ZXhhbXBsZQ==",
+	"binary":    "<binary>",
+	"password":  "********",
+}
+
+// -----------------------------------------------------------------------------
+
+// schemaExample2 returns the example of a Swagger 2 schema, given the schema of its values,
+// which for an array is the schema of its items, and the type of those values. It returns
+// nil for an object, or an array of objects, with no example or default, whose example is
+// built from its properties.
+func schemaExample2(s *spec.Schema, values *spec.Schema, valueType string, constraints Constraints) interface{} {
+	if example := explicitExample(s.Example, s.Default); example != nil {
+		return example
+	}
+	value := explicitExample(values.Example, values.Default)
+	if value == nil {
+		if !isPrimitive(valueType) {
+			return nil
+		}
+		value = madeUpExample(values.Enum, valueType, values.Format, constraints)
+	}
+	if s != values {
+		return []interface{}{value} // An array
+	}
+	return value
+}
+
+// schemaExample3 returns the example of an OpenAPI 3 schema, as schemaExample2 does.
+func schemaExample3(s *openapi3.Schema, values *openapi3.Schema, constraints Constraints) interface{} {
+	if example := explicitExample(s.Example, s.Default); example != nil {
+		return example
+	}
+	value := explicitExample(values.Example, values.Default)
+	if value == nil {
+		if !isPrimitive(values.Type) {
+			return nil
+		}
+		value = madeUpExample(values.Enum, values.Type, values.Format, constraints)
+	}
+	if s != values {
+		return []interface{}{value} // An array
+	}
+	return value
+}
+
+func explicitExample(example interface{}, def interface{}) interface{} {
+	if example != nil {
+		return example
+	}
+	return def
+}
+
+func isPrimitive(valueType string) bool {
+	switch valueType {
+	case "string", "integer", "number", "boolean":
+		return true
+	}
+	return false
+}
+
+// madeUpExample returns the first of an enumeration, or failing that a value made up to suit
+// the type, format and constraints of a primitive.
+func madeUpExample(enum []interface{}, valueType string, format string, constraints Constraints) interface{} {
+	if len(enum) > 0 {
+		return enum[0]
+	}
+
+	switch valueType {
+	case "boolean":
+		return true
+	case "integer":
+		return int64(numberExample(constraints, 1))
+	case "number":
+		return numberExample(constraints, 0.5)
+	}
+
+	if example, ok := formatExamples[format]; ok {
+		return example
+	}
+	return "string"
+}
+
+// numberExample returns zero, moved within the minimum and maximum of the constraints. An
+// exclusive bound is stepped inside by step.
+func numberExample(constraints Constraints, step float64) float64 {
+	var value float64
+
+	if min, err := strconv.ParseFloat(constraints.Minimum, 64); err == nil && value <= min {
+		value = min
+		if constraints.ExclusiveMinimum {
+			value += step
+		}
+	}
+	if max, err := strconv.ParseFloat(constraints.Maximum, 64); err == nil && value >= max {
+		value = max
+		if constraints.ExclusiveMaximum {
+			value -= step
+		}
+	}
+	return value
+}
+
+// -----------------------------------------------------------------------------
+
+// resourceExample returns the example of a resource, as indented JSON. Unless its schema
+// gives an example, it is built from the examples of its properties.
+func resourceExample(r *Resource, jsonres map[string]interface{}, isArray bool) string {
+	if r.example == nil {
+		return jsonResourceToString(jsonres, isArray)
+	}
+	example, _ := JSONMarshalIndent(r.example)
+	return string(example)
+}
+
+// BodyExample returns the example of a body holding the resource, or an array of the resource
+// if isArray is true. The Schema of a response resource is the example of a single resource,
+// unless its schema gives an example of the whole array.
+func (r *Resource) BodyExample(isArray bool) string {
+	if !isArray || r.example != nil || strings.HasPrefix(strings.TrimSpace(r.Schema), "[") {
+		return r.Schema
+	}
+	var example interface{}
+	if err := json.Unmarshal([]byte(r.Schema), &example); err != nil {
+		return r.Schema
+	}
+	b, _ := JSONMarshalIndent([]interface{}{example})
+	return string(b)
+}
+
+// exampleString formats an example of the media type, as indented JSON unless the media type
+// is not JSON and the example is a string, such as an XML document. The media type of the
+// example of a parameter is "".
+func exampleString(example interface{}, contentType string) string {
+	if s, ok := example.(string); ok && !strings.Contains(contentType, "json") {
+		return s
+	}
+	b, err := JSONMarshalIndent(example)
+	if err != nil {
+		return fmt.Sprintf("%v", example)
+	}
+	return string(b)
+}
+
+// parameterExample formats the example of a parameter, as it would be given in a request.
+// The values of an array are separated by commas.
+func parameterExample(example interface{}) string {
+	switch e := example.(type) {
+	case nil:
+		return ""
+	case string:
+		return e
+	case []interface{}:
+		values := make([]string, len(e))
+		for i, v := range e {
+			values[i] = parameterExample(v)
+		}
+		return strings.Join(values, ",")
+	}
+	b, err := json.Marshal(example)
+	if err != nil {
+		return fmt.Sprintf("%v", example)
+	}
+	return string(b)
+}
+
+// -----------------------------------------------------------------------------
+
+// setExamples2 sets the examples of a Swagger 2 parameter. Swagger 2 has no example member
+// for parameters, so the x-example extension is read, and the x-examples extension of a body
+// parameter, which is keyed by media type, as are the examples of a response.
+func (p *Parameter) setExamples2(src spec.Parameter) {
+	if src.In == "body" {
+		var examples map[string]interface{}
+		if getExtension(src.Extensions, "x-examples", &examples) {
+			p.Examples = mediaTypeExamples2(examples)
+		}
+		return
+	}
+
+	var example interface{}
+	if !getExtension(src.Extensions, "x-example", &example) && src.Type != "file" {
+		values := src.SimpleSchema
+		if src.Type == "array" && src.Items != nil {
+			values = src.Items.SimpleSchema
+		}
+		example = values.Default
+		if example == nil {
+			enum := src.Enum
+			if src.Type == "array" && src.Items != nil {
+				enum = src.Items.Enum
+			}
+			example = madeUpExample(enum, values.Type, values.Format, p.Constraints)
+		}
+	}
+	p.Example = parameterExample(example)
+}
+
+// setExamples3 sets the examples of an OpenAPI 3 parameter, from its own example or examples,
+// or failing those from its schema.
+func (p *Parameter) setExamples3(src *openapi3.Parameter) {
+	p.Examples = namedExamples3(src.Examples, "")
+
+	example := src.Example
+	if example == nil && src.Schema != nil && src.Schema.Value != nil {
+		s := src.Schema.Value
+		values := s
+		if s.Type == "array" && s.Items != nil && s.Items.Value != nil {
+			values = s.Items.Value
+		}
+		example = schemaExample3(s, values, p.Constraints)
+	}
+	p.Example = parameterExample(example)
+}
+
+// headerExample2 gives the example of a Swagger 2 response header, from its example or
+// x-example, or failing those as the example of a parameter is given.
+func headerExample2(h spec.Header) string {
+	example := h.Example
+	if example == nil && !getExtension(h.Extensions, "x-example", &example) {
+		values := h.SimpleSchema
+		enum := h.Enum
+		if h.Type == "array" && h.Items != nil {
+			values = h.Items.SimpleSchema
+			enum = h.Items.Enum
+		}
+		example = values.Default
+		if example == nil {
+			constraints := Constraints{Minimum: formatFloat(h.Minimum), Maximum: formatFloat(h.Maximum)}
+			example = madeUpExample(enum, values.Type, values.Format, constraints)
+		}
+	}
+	return parameterExample(example)
+}
+
+// headerExample3 gives the example of an OpenAPI 3 response header, from its example, or
+// failing that from its schema. kin-openapi does not model the example of a header, so it
+// is read as an extension.
+func headerExample3(h *openapi3.Header) string {
+	var example interface{}
+	if !getExtension3(h.ExtensionProps, "example", &example) && h.Schema != nil && h.Schema.Value != nil {
+		s := h.Schema.Value
+		values := s
+		if s.Type == "array" && s.Items != nil && s.Items.Value != nil {
+			values = s.Items.Value
+		}
+		example = schemaExample3(s, values, getConstraints3(s, values))
+	}
+	return parameterExample(example)
+}
+
+// -----------------------------------------------------------------------------
+
+// namedExamples3 lists the named examples of an OpenAPI 3 media type or parameter, in name
+// order.
+func namedExamples3(examples map[string]*openapi3.ExampleRef, contentType string) []Example {
+	names := make([]string, 0, len(examples))
+	for name := range examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var named []Example
+	for _, name := range names {
+		example := examples[name]
+		if example == nil || example.Value == nil {
+			continue
+		}
+		e := Example{
+			Name:          name,
+			Summary:       example.Value.Summary,
+			Description:   string(github_flavored_markdown.Markdown([]byte(example.Value.Description))),
+			ExternalValue: example.Value.ExternalValue,
+		}
+		if example.Value.Value != nil {
+			e.Value = exampleString(example.Value.Value, contentType)
+		}
+		named = append(named, e)
+	}
+	return named
+}
+
+// mediaTypeExamples2 lists Swagger 2 examples, which are keyed by media type, naming each
+// after its media type.
+func mediaTypeExamples2(examples map[string]interface{}) []Example {
+	contentTypes := make([]string, 0, len(examples))
+	for contentType := range examples {
+		contentTypes = append(contentTypes, contentType)
+	}
+	sort.Strings(contentTypes)
+
+	var named []Example
+	for _, contentType := range contentTypes {
+		named = append(named, Example{Name: contentType, Value: exampleString(examples[contentType], contentType)})
+	}
+	return named
+}
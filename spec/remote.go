@@ -0,0 +1,333 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+package spec
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UKHomeOffice/dapperdox/config"
+	"github.com/UKHomeOffice/dapperdox/logger"
+)
+
+// RemoteStatus describes how fresh a remotely hosted specification is
+type RemoteStatus struct {
+	Fetched  time.Time     // When the version being served was fetched
+	Interval time.Duration // How often the specification is refreshed, or zero if never
+	Stale    bool          // The latest version could not be fetched or loaded, so an older version is served
+	Error    string        // Why the latest version could not be fetched or loaded
+}
+
+// remoteSpec remembers what was last fetched from the location of a remotely hosted
+// specification. It outlives any one load of the specifications, so that refreshes can be
+// conditional, and so that the last version that loaded can be served when a refresh fails.
+type remoteSpec struct {
+	sync.Mutex
+
+	location string
+	interval time.Duration
+
+	etag         string
+	lastModified string
+	latest       []byte    // The most recently fetched document
+	fetched      time.Time // When latest was fetched
+	good         []byte    // The most recent document that loaded
+	goodFetched  time.Time // When good was fetched
+	err          error     // Why the most recent fetch or load failed
+
+	prefetched  bool  // Fetched by a refresh ahead of the next load, which reads latest rather than fetching
+	prefetchErr error // Why the fetch ahead of the next load failed
+}
+
+var remoteSpecs = map[string]*remoteSpec{}
+var remoteSpecsLock sync.Mutex
+
+// -----------------------------------------------------------------------------
+
+// remoteSpecFor returns the remote state for a location, creating it on first use.
+func remoteSpecFor(location string) *remoteSpec {
+	remoteSpecsLock.Lock()
+	defer remoteSpecsLock.Unlock()
+
+	r, ok := remoteSpecs[location]
+	if !ok {
+		r = &remoteSpec{location: location, interval: refreshInterval(location)}
+		remoteSpecs[location] = r
+	}
+	return r
+}
+
+// -----------------------------------------------------------------------------
+
+// refreshInterval returns how often the specification at location is to be refreshed. The
+// spec-refresh configuration holds either a duration, applying to every remote specification,
+// or a url=duration pair for just the one. A specification is only fetched at load if
+// neither is given.
+func refreshInterval(location string) time.Duration {
+	cfg, err := config.Get()
+	if err != nil {
+		logger.Errorf(nil, "error configuring app: %s", err)
+		return 0
+	}
+
+	var interval time.Duration
+
+	for _, refresh := range cfg.SpecRefresh {
+		duration := refresh
+		specific := false
+
+		if i := strings.LastIndex(refresh, "="); i != -1 {
+			if refresh[:i] != location {
+				continue
+			}
+			duration = refresh[i+1:]
+			specific = true
+		}
+
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			logger.Errorf(nil, "Error: invalid spec-refresh %s: %s", refresh, err)
+			continue
+		}
+		interval = d
+		if specific {
+			break
+		}
+	}
+
+	return interval
+}
+
+// -----------------------------------------------------------------------------
+
+// fetch requests the specification, conditional on the version last fetched. It reports
+// whether the remote host returned a different document. The remote host is not waited on
+// with the state locked, so that its status can be read in the meantime.
+func (r *remoteSpec) fetch() (bool, error) {
+	r.Lock()
+	req, err := http.NewRequest("GET", r.location, nil)
+	if err != nil {
+		r.Unlock()
+		return false, err
+	}
+	conditional := r.latest != nil
+	if conditional {
+		if r.etag != "" {
+			req.Header.Set("If-None-Match", r.etag)
+		}
+		if r.lastModified != "" {
+			req.Header.Set("If-Modified-Since", r.lastModified)
+		}
+	}
+	r.Unlock()
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && conditional:
+		logger.Tracef(nil, "Specification %s is unchanged", r.location)
+		return false, nil
+	case resp.StatusCode != http.StatusOK:
+		return false, fmt.Errorf("failed to fetch specification %s: %s", r.location, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.etag = resp.Header.Get("ETag")
+	r.lastModified = resp.Header.Get("Last-Modified")
+
+	if bytes.Equal(body, r.latest) {
+		return false, nil
+	}
+
+	r.latest = body
+	r.fetched = time.Now()
+
+	return true, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// prefetch records the outcome of a fetch ahead of the next load.
+func (r *remoteSpec) prefetch(err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.prefetched, r.prefetchErr = true, err
+}
+
+// read returns the latest document, fetching it unless it was fetched ahead of this load.
+func (r *remoteSpec) read() ([]byte, error) {
+	r.Lock()
+	prefetched, err := r.prefetched, r.prefetchErr
+	r.prefetched, r.prefetchErr = false, nil
+	r.Unlock()
+
+	if !prefetched {
+		_, err = r.fetch()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.latestBody(), nil
+}
+
+func (r *remoteSpec) latestBody() []byte {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.latest
+}
+
+// loaded records that the latest document loaded, so is the one to fall back to.
+func (r *remoteSpec) loaded() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.good = r.latest
+	r.goodFetched = r.fetched
+	r.err = nil
+}
+
+// failed records why the latest document could not be loaded, returning the last document
+// that did, if there is one.
+func (r *remoteSpec) failed(err error) []byte {
+	r.Lock()
+	defer r.Unlock()
+
+	r.err = err
+	return r.good
+}
+
+func (r *remoteSpec) status() *RemoteStatus {
+	r.Lock()
+	defer r.Unlock()
+
+	s := &RemoteStatus{
+		Fetched:  r.goodFetched,
+		Interval: r.interval,
+	}
+	if r.err != nil {
+		s.Stale = true
+		s.Error = r.err.Error()
+	}
+	return s
+}
+
+// -----------------------------------------------------------------------------
+
+// loadRemote loads a remotely hosted specification. When the latest version cannot be
+// fetched or loaded, the last version that did load is served instead, and is marked stale.
+// A non-empty version is the version of the API that the whole specification documents.
+func loadRemote(src *urlSource, location string, version string) (*APISpecification, error) {
+
+	specification := &APISpecification{URL: location, version: version}
+
+	err := specification.load(src)
+	if err == nil {
+		src.remote.loaded()
+		specification.Remote = src.remote.status()
+		return specification, nil
+	}
+
+	good := src.remote.failed(err)
+	if good == nil {
+		return specification, err
+	}
+
+	stale := &APISpecification{URL: location, version: version}
+	if e := stale.loadData(src, good); e != nil {
+		return specification, err
+	}
+	stale.Remote = src.remote.status()
+	stale.warnf("", "Serving the version fetched at %s, as the latest version failed to load: %s",
+		stale.Remote.Fetched.Format(time.RFC1123), err)
+
+	return stale, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// RefreshRemoteSpecifications polls each remotely hosted specification that has a refresh
+// interval, calling changed whenever one of them changes, or starts or stops failing to be
+// fetched. changed is expected to reload the specifications. Polling continues until stop
+// is called.
+func RefreshRemoteSpecifications(changed func()) (stop func()) {
+
+	remoteSpecsLock.Lock()
+	defer remoteSpecsLock.Unlock()
+
+	done := make(chan struct{})
+
+	for _, r := range remoteSpecs {
+		if r.interval <= 0 {
+			continue
+		}
+		logger.Infof(nil, "Refreshing %s every %s", r.location, r.interval)
+		go r.refresh(changed, done)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+func (r *remoteSpec) refresh(changed func(), done <-chan struct{}) {
+	failing := false
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		modified, err := r.fetch()
+		if err != nil {
+			logger.Warnf(nil, "Warning: unable to refresh specification %s: %s", r.location, err)
+		}
+
+		if modified || (err != nil) != failing {
+			r.prefetch(err) // So that the reload reads what was just fetched
+			changed()
+		}
+		failing = err != nil
+	}
+}
+
+// -----------------------------------------------------------------------------
+// end
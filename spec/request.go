@@ -0,0 +1,488 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Requests are matched against the methods of the current version of a specification, and
+// checked against the parameters and bodies those methods document, as are responses against
+// the responses they document, for the mock server and the validating proxy.
+
+var (
+	pathParamPattern = regexp.MustCompile(`\{([^}/]+)\}`)
+	uuidPattern      = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// -----------------------------------------------------------------------------
+
+// FindMethod returns the method of the current version that a request of the HTTP method to
+// the path calls, with the values of its path parameters, or nil if there is none. The path
+// is that of Method.Path, so for Swagger 2 includes the basePath. Where the templates of
+// several methods match, such as /orders/mine and /orders/{id}, the method with the fewest
+// path parameters is the one called.
+func (c *APISpecification) FindMethod(httpMethod, path string) (*Method, map[string]string) {
+	var found *Method
+	var foundParams map[string]string
+
+	for i := range c.APIs {
+		for j := range c.APIs[i].Methods {
+			method := &c.APIs[i].Methods[j]
+			if !strings.EqualFold(method.Method, httpMethod) {
+				continue
+			}
+			params, ok := matchPath(method.Path, path)
+			if ok && (found == nil || len(params) < len(foundParams)) {
+				found, foundParams = method, params
+			}
+		}
+	}
+	return found, foundParams
+}
+
+// AllowedMethods lists the HTTP methods, in upper case, of the methods of the current version
+// whose path template matches the path.
+func (c *APISpecification) AllowedMethods(path string) []string {
+	var allowed []string
+	seen := make(map[string]bool)
+
+	for _, api := range c.APIs {
+		for _, method := range api.Methods {
+			name := strings.ToUpper(method.Method)
+			if _, ok := matchPath(method.Path, path); ok && !seen[name] {
+				seen[name] = true
+				allowed = append(allowed, name)
+			}
+		}
+	}
+	return allowed
+}
+
+// FindOperation returns the specification of a suite, and its method, that a request of the
+// HTTP method to the path of a site calls, with the values of its path parameters, or nil if
+// there is none. The path is that of the method below the path of the URL of its API, as the
+// API explorer calls it.
+func FindOperation(suite map[string]*APISpecification, httpMethod, path string) (*APISpecification, *Method, map[string]string) {
+	ids := make([]string, 0, len(suite))
+	for id := range suite {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		c := suite[id]
+		for i := range c.APIs {
+			base := ""
+			if c.APIs[i].URL != nil {
+				base = strings.TrimSuffix(c.APIs[i].URL.Path, "/")
+			}
+			if !strings.HasPrefix(path, base) {
+				continue
+			}
+			if method, params := c.FindMethod(httpMethod, strings.TrimPrefix(path, base)); method != nil {
+				return c, method, params
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+// matchPath matches a path against a path template, such as /orders/{id}, returning the
+// unescaped values of the template's parameters.
+func matchPath(template, path string) (map[string]string, bool) {
+	var names []string
+	var pattern bytes.Buffer
+
+	pattern.WriteString("^")
+	last := 0
+	for _, loc := range pathParamPattern.FindAllStringSubmatchIndex(template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		pattern.WriteString("([^/]+)")
+		names = append(names, template[loc[2]:loc[3]])
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+	pattern.WriteString("/?$")
+
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, false
+	}
+	match := re.FindStringSubmatch(path)
+	if match == nil {
+		return nil, false
+	}
+
+	params := make(map[string]string, len(names))
+	for i, name := range names {
+		value, err := url.PathUnescape(match[i+1])
+		if err != nil {
+			value = match[i+1]
+		}
+		params[name] = value
+	}
+	return params, true
+}
+
+// -----------------------------------------------------------------------------
+
+// ValidateRequest checks a request against the parameters and body documented by the method,
+// given the values of its path parameters, and describes each problem it finds. The body of
+// the request is left to be read again.
+func (m *Method) ValidateRequest(req *http.Request, pathParams map[string]string) []string {
+	var problems []string
+
+	for i := range m.PathParams {
+		p := &m.PathParams[i]
+		var values []string
+		if value, ok := pathParams[p.Name]; ok {
+			values = []string{value}
+		}
+		problems = append(problems, p.validate(values)...)
+	}
+
+	query := req.URL.Query()
+	for i := range m.QueryParams {
+		p := &m.QueryParams[i]
+		problems = append(problems, p.validate(query[p.Name])...)
+	}
+
+	for i := range m.HeaderParams {
+		p := &m.HeaderParams[i]
+		problems = append(problems, p.validate(req.Header[http.CanonicalHeaderKey(p.Name)])...)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return append(problems, fmt.Sprintf("request body could not be read: %s", err))
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if len(m.FormParams) > 0 {
+		problems = append(problems, m.validateForm(req, body)...)
+	}
+
+	if m.BodyParam != nil {
+		if len(bytes.TrimSpace(body)) == 0 {
+			if m.BodyParam.Required {
+				problems = append(problems, "request body is required")
+			}
+			return problems
+		}
+
+		contentType := req.Header.Get("Content-Type")
+		schema := m.BodyParam.schema
+		if len(m.BodyParam.MediaTypes) > 0 {
+			mt := findMediaType(m.BodyParam.MediaTypes, contentType)
+			if mt == nil {
+				return append(problems, fmt.Sprintf("request body media type %q is not documented", contentType))
+			}
+			schema = mt.schema
+		}
+		problems = append(problems, checkBody("request body", schema, contentType, body, true)...)
+	}
+	return problems
+}
+
+// ValidateResponse checks a response to the method against the response documented for its
+// status, describing each problem it finds.
+func (m *Method) ValidateResponse(status int, header http.Header, body []byte) []string {
+	response, ok := m.Responses[status]
+	if !ok {
+		if m.DefaultResponse == nil {
+			return []string{fmt.Sprintf("response status %d is not documented", status)}
+		}
+		response = *m.DefaultResponse
+	}
+
+	var problems []string
+	for _, h := range response.Headers {
+		if h.Required && header.Get(h.Name) == "" {
+			problems = append(problems, fmt.Sprintf("response header %q is required", h.Name))
+		}
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return problems
+	}
+
+	contentType := header.Get("Content-Type")
+	schema := response.schema
+	if len(response.MediaTypes) > 0 {
+		mt := findMediaType(response.MediaTypes, contentType)
+		if mt == nil {
+			return append(problems, fmt.Sprintf("response media type %q is not documented for status %d", contentType, status))
+		}
+		schema = mt.schema
+	}
+	return append(problems, checkBody("response body", schema, contentType, body, false)...)
+}
+
+// findMediaType finds the media type of a Content-Type header among those documented, which
+// may be a range such as application/*.
+func findMediaType(mediaTypes []MediaType, contentType string) *MediaType {
+	name := mediaTypeName(contentType)
+	for i := range mediaTypes {
+		if mediaTypeName(mediaTypes[i].ContentType) == name {
+			return &mediaTypes[i]
+		}
+	}
+	for i := range mediaTypes {
+		documented := mediaTypeName(mediaTypes[i].ContentType)
+		if documented == "*/*" || (strings.HasSuffix(documented, "/*") && strings.HasPrefix(name, strings.TrimSuffix(documented, "*"))) {
+			return &mediaTypes[i]
+		}
+	}
+	return nil
+}
+
+// mediaTypeName gives the media type of a Content-Type header, without its parameters.
+func mediaTypeName(contentType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+}
+
+// checkBody checks a JSON body against its schema. Bodies of other media types are not checked.
+func checkBody(name string, schema *bodySchema, contentType string, body []byte, isRequest bool) []string {
+	if !strings.Contains(contentType, "json") {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return []string{name + " is not valid JSON"}
+	}
+	if schema == nil {
+		return nil
+	}
+
+	problems := schema.check(value, isRequest)
+	for i := range problems {
+		problems[i] = name + " " + problems[i]
+	}
+	return problems
+}
+
+// validateForm checks the form parameters of a request, parsing the form from a copy of the
+// request so that the body may be read again.
+func (m *Method) validateForm(req *http.Request, body []byte) []string {
+	form := *req
+	form.Body = ioutil.NopCloser(bytes.NewReader(body))
+	form.Form = nil
+	form.PostForm = nil
+	form.MultipartForm = nil
+
+	var err error
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data") {
+		err = form.ParseMultipartForm(32 << 20)
+	} else {
+		err = form.ParseForm()
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("request form could not be read: %s", err)}
+	}
+
+	var problems []string
+	for i := range m.FormParams {
+		p := &m.FormParams[i]
+		values := form.PostForm[p.Name]
+		if form.MultipartForm != nil && len(form.MultipartForm.File[p.Name]) > 0 {
+			values = []string{"<file>"} // The content of a file is not checked
+		}
+		problems = append(problems, p.validate(values)...)
+	}
+	return problems
+}
+
+// -----------------------------------------------------------------------------
+
+// validate checks the values given for a parameter, which for an array not given as multiple
+// parameters are split according to its collection format.
+func (p *Parameter) validate(values []string) []string {
+	if len(values) == 0 || (len(values) == 1 && values[0] == "" && p.In != "query") {
+		if p.Required {
+			return []string{p.problem("is required")}
+		}
+		return nil
+	}
+	if len(p.Type) == 0 {
+		return nil
+	}
+	valueType := p.Type[len(p.Type)-1]
+
+	if p.Type[0] != "array" {
+		if message := p.checkValue(values[0], valueType); message != "" {
+			return []string{p.problem(message)}
+		}
+		return nil
+	}
+
+	var items []string
+	for _, value := range values {
+		items = append(items, splitCollection(value, p.CollectionFormat)...)
+	}
+
+	var problems []string
+	if min, err := strconv.Atoi(p.MinItems); err == nil && len(items) < min {
+		problems = append(problems, p.problem(fmt.Sprintf("has %d items, fewer than the minimum %d", len(items), min)))
+	}
+	if max, err := strconv.Atoi(p.MaxItems); err == nil && len(items) > max {
+		problems = append(problems, p.problem(fmt.Sprintf("has %d items, more than the maximum %d", len(items), max)))
+	}
+	for _, item := range items {
+		if message := p.checkValue(item, valueType); message != "" {
+			problems = append(problems, p.problem(message))
+		}
+	}
+	return problems
+}
+
+func (p *Parameter) problem(message string) string {
+	in := p.In
+	if in == "formData" {
+		in = "form"
+	}
+	return fmt.Sprintf("%s parameter %q: %s", in, p.Name, message)
+}
+
+// splitCollection splits the value of an array parameter into its items.
+func splitCollection(value string, collectionFormat string) []string {
+	switch collectionFormat {
+	case "multi":
+		return []string{value}
+	case "ssv":
+		return strings.Split(value, " ")
+	case "tsv":
+		return strings.Split(value, "\t")
+	case "pipes":
+		return strings.Split(value, "|")
+	}
+	return strings.Split(value, ",")
+}
+
+// checkValue checks a single value against the type or format, enumeration and constraints of
+// a parameter, returning "" if it is valid, or what is wrong with it.
+func (p *Parameter) checkValue(value string, valueType string) string {
+	var number *float64
+
+	switch valueType {
+	case "integer", "int32", "int64":
+		bits := 64
+		if valueType == "int32" {
+			bits = 32
+		}
+		i, err := strconv.ParseInt(value, 10, bits)
+		if err != nil {
+			return fmt.Sprintf("%q is not an integer", value)
+		}
+		f := float64(i)
+		number = &f
+	case "number", "float", "double":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Sprintf("%q is not a number", value)
+		}
+		number = &f
+	case "boolean":
+		if value != "true" && value != "false" {
+			return fmt.Sprintf("%q is not true or false", value)
+		}
+	default:
+		if message := formatProblem(value, valueType); message != "" {
+			return message
+		}
+	}
+
+	if len(p.Enum) > 0 && !enumContains(p.Enum, value, number) {
+		return fmt.Sprintf("%q is not one of %s", value, strings.Join(p.Enum, ", "))
+	}
+
+	if number != nil {
+		return p.checkNumber(*number, value)
+	}
+
+	length := utf8.RuneCountInString(value)
+	if min, err := strconv.Atoi(p.MinLength); err == nil && length < min {
+		return fmt.Sprintf("%q is shorter than the minimum length %d", value, min)
+	}
+	if max, err := strconv.Atoi(p.MaxLength); err == nil && length > max {
+		return fmt.Sprintf("%q is longer than the maximum length %d", value, max)
+	}
+	if p.Pattern != "" {
+		if re, err := regexp.Compile(p.Pattern); err == nil && !re.MatchString(value) {
+			return fmt.Sprintf("%q does not match the pattern %s", value, p.Pattern)
+		}
+	}
+	return ""
+}
+
+// checkNumber checks a number against the minimum, maximum and multipleOf of a parameter.
+func (p *Parameter) checkNumber(n float64, value string) string {
+	if min, err := strconv.ParseFloat(p.Minimum, 64); err == nil {
+		if p.ExclusiveMinimum && n <= min {
+			return fmt.Sprintf("%s is not greater than the exclusive minimum %s", value, p.Minimum)
+		}
+		if n < min {
+			return fmt.Sprintf("%s is less than the minimum %s", value, p.Minimum)
+		}
+	}
+	if max, err := strconv.ParseFloat(p.Maximum, 64); err == nil {
+		if p.ExclusiveMaximum && n >= max {
+			return fmt.Sprintf("%s is not less than the exclusive maximum %s", value, p.Maximum)
+		}
+		if n > max {
+			return fmt.Sprintf("%s is greater than the maximum %s", value, p.Maximum)
+		}
+	}
+	if multipleOf, err := strconv.ParseFloat(p.MultipleOf, 64); err == nil && multipleOf > 0 {
+		q := n / multipleOf
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			return fmt.Sprintf("%s is not a multiple of %s", value, p.MultipleOf)
+		}
+	}
+	return ""
+}
+
+// enumContains reports whether a value is one of an enumeration. A number matches an equal
+// number, so that 1.0 is one of an enumeration of 1.
+func enumContains(enum []string, value string, number *float64) bool {
+	for _, e := range enum {
+		if e == value {
+			return true
+		}
+		if number != nil {
+			if f, err := strconv.ParseFloat(e, 64); err == nil && f == *number {
+				return true
+			}
+		}
+	}
+	return false
+}
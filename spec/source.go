@@ -0,0 +1,232 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+package spec
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/UKHomeOffice/dapperdox/config"
+	"github.com/UKHomeOffice/dapperdox/logger"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/ghodss/yaml"
+	"github.com/go-openapi/loads"
+	"github.com/go-openapi/spec"
+	"github.com/go-openapi/swag"
+)
+
+// A specSource supplies the raw document of a specification, and the location that any
+// relative $ref within the document is resolved against. Local specifications are read
+// straight from the spec-dir, so loading never needs DapperDox to be listening for
+// (and serving itself) specification requests.
+type specSource interface {
+	Read() ([]byte, error)
+	Base() *url.URL
+	String() string
+}
+
+// -----------------------------------------------------------------------------
+
+// fileSource reads a specification file from the local filesystem, applying the
+// spec-rewrite-url replacements on the way, exactly as handlers/specs does when it
+// serves the same file.
+type fileSource struct {
+	path     string
+	replacer *strings.Replacer
+	dir      string // The directory that the files it references must be within, if any
+}
+
+func (s *fileSource) Read() ([]byte, error) {
+	buf, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if s.replacer != nil {
+		buf = []byte(s.replacer.Replace(string(buf)))
+	}
+	return buf, nil
+}
+
+func (s *fileSource) Base() *url.URL {
+	path, err := filepath.Abs(s.path)
+	if err != nil {
+		path = s.path
+	}
+	return &url.URL{Path: filepath.ToSlash(path)}
+}
+
+func (s *fileSource) String() string {
+	return s.path
+}
+
+// -----------------------------------------------------------------------------
+
+// urlSource fetches a specification that is hosted remotely over http(s). Fetches are
+// conditional on the version last fetched from the same location, which is kept so that it
+// can be served again when the remote host reports it unchanged.
+type urlSource struct {
+	location *url.URL
+	remote   *remoteSpec
+}
+
+func (s *urlSource) Read() ([]byte, error) {
+	return s.remote.read()
+}
+
+func (s *urlSource) Base() *url.URL {
+	return s.location
+}
+
+func (s *urlSource) String() string {
+	return s.location.String()
+}
+
+// -----------------------------------------------------------------------------
+
+// newSpecSource returns the source for a configured spec-filename. Anything that is not an
+// http(s) URL is a file relative to the spec-dir.
+func newSpecSource(specDir string, specLocation string) (specSource, error) {
+	if !isLocalSpecUrl(specLocation) {
+		u, err := url.Parse(specLocation)
+		if err != nil {
+			return nil, err
+		}
+		return &urlSource{location: u, remote: remoteSpecFor(u.String())}, nil
+	}
+
+	path, err := filepath.Abs(filepath.Join(specDir, filepath.FromSlash(specLocation)))
+	if err != nil {
+		return nil, err
+	}
+	src := &fileSource{path: path, replacer: SpecReplacer()}
+	if specDir != "" {
+		if src.dir, err = filepath.Abs(specDir); err != nil {
+			return nil, err
+		}
+	}
+	return src, nil
+}
+
+// -----------------------------------------------------------------------------
+
+var specReplacer *strings.Replacer
+
+// SpecReplacer returns the replacer built from the spec-rewrite-url configuration, which
+// maps URLs found in specification documents on to the site-url (or the given to URL).
+func SpecReplacer() *strings.Replacer {
+	if specReplacer != nil {
+		return specReplacer
+	}
+
+	cfg, err := config.Get()
+	if err != nil {
+		logger.Errorf(nil, "error configuring app: %s", err)
+	}
+
+	var replacements []string
+
+	// Configure the replacer with key=value pairs
+	for i := range cfg.SpecRewriteURL {
+
+		slice := strings.Split(cfg.SpecRewriteURL[i], "=")
+
+		switch len(slice) {
+		case 1: // Map between configured URL and site URL
+			replacements = append(replacements, slice[0], cfg.SiteURL)
+		case 2: // Map between configured to=from URL pair
+			replacements = append(replacements, slice...)
+		default:
+			panic("Invalid DocumentWriteUrl - does not contain an = delimited from=to pair")
+		}
+	}
+	specReplacer = strings.NewReplacer(replacements...)
+
+	return specReplacer
+}
+
+// -----------------------------------------------------------------------------
+
+// loadSwagger2Spec parses the bundled document read from a source through go-openapi,
+// expanding every $ref but those to schemas, which keep their names until resources are built.
+func loadSwagger2Spec(src specSource, data []byte) (*loads.Document, error) {
+
+	logger.Infof(nil, "Importing OpenAPI specifications from %s", src)
+
+	raw := json.RawMessage(data)
+	if !isJSON(data) {
+		yamlDoc, err := swag.BytesToYAMLDoc(data)
+		if err != nil {
+			return nil, err
+		}
+		raw, err = swag.YAMLToJSON(yamlDoc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	document, err := loads.Analyzed(raw, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Any $ref to another file has already been bundled into the document, so every $ref is
+	// now within it
+	err = spec.ExpandSpec(document.Spec(), &spec.ExpandOptions{SkipSchemas: true})
+	if err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+// -----------------------------------------------------------------------------
+
+// loadOpenAPI3Spec parses the bundled document read from a source through kin-openapi.
+func loadOpenAPI3Spec(src specSource, data []byte) (*openapi3.Swagger, error) {
+
+	logger.Infof(nil, "Importing OpenAPI specifications from %s", src)
+
+	loader := openapi3.NewSwaggerLoader()
+	loader.IsExternalRefsAllowed = true
+
+	return loader.LoadSwaggerFromDataWithPath(data, src.Base())
+}
+
+// -----------------------------------------------------------------------------
+
+// isOpenAPI3 reports whether the document declares itself as OpenAPI 3, through the openapi
+// member that replaced the swagger member of a Swagger 2 document.
+func isOpenAPI3(data []byte) bool {
+	var document struct {
+		OpenAPI string `json:"openapi"`
+	}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return false
+	}
+	return document.OpenAPI != ""
+}
+
+// -----------------------------------------------------------------------------
+
+func isJSON(data []byte) bool {
+	trimmed := strings.TrimSpace(string(data))
+	return strings.HasPrefix(trimmed, "{")
+}
@@ -23,7 +23,6 @@ import (
 	"fmt"
 	"github.com/getkin/kin-openapi/openapi3"
 	"net/url"
-	"os"
 	"regexp"
 	"sort"
 	"strconv"
@@ -46,10 +45,30 @@ type APISpecification struct {
 
 	SecurityDefinitions map[string]SecurityScheme
 	DefaultSecurity     map[string]Security
+	DefaultRequirements []SecurityRequirement
 	ResourceList        map[string]map[string]*Resource // Version->ResourceName->Resource
 	APIVersions         map[string]APISet               // Version->APISet
+	CurrentVersion      string                          // The version shown when no version is asked for
+	Bundled             bool                            // Whether the local specification is split across several files
+	VersionStatuses     map[string]*VersionStatus       // Version->Deprecation, for deprecated versions
+	Diagnostics         []Diagnostic                    // Problems found while loading the specification
+	Remote              *RemoteStatus                   // Freshness of a remotely hosted specification
+
+	basePath string // Swagger 2 basePath, which prefixes each method path
+	version  string // When loading one version of a specification from its own file, the version it documents
+
+	definitions spec.Definitions               // Swagger 2 named schemas, which are resolved as they are used
+	schemas     map[string]*openapi3.SchemaRef // OpenAPI 3 named schemas
+	building    map[string]bool                // Named schemas whose resources are being built, to stop recursion
+	components  map[string]*Resource           // Resources of named schemas used by properties, by version, origin and name
+	pending     []pendingComponent             // Named schemas used by properties, yet to be cross linked
+
+	namedSchemas map[string]interface{} // Named schemas decoded from JSON, by $ref, for checking bodies
 }
 
+// APISuite holds the specifications loaded by the last call to LoadSpecifications. They are
+// loaded afresh for each build of the documentation, so what serves requests takes what it
+// needs of them as it is registered.
 var APISuite map[string]*APISpecification
 
 // GetByName returns an API by name
@@ -102,6 +121,7 @@ type APIGroup struct {
 	ExternalDocs           *ExternalDocs
 	Consumes               []string
 	Produces               []string
+	Deprecation            // Of the tag grouping the methods
 }
 
 type Version struct {
@@ -109,21 +129,41 @@ type Version struct {
 	Methods []Method
 }
 
+// OAuth2Scheme describes an OAuth2 security scheme. The OAuth2Flow, AuthorizationUrl and
+// TokenUrl describe the first of its flows, as a Swagger 2 scheme only ever has one. Scopes
+// holds the scopes of every flow.
 type OAuth2Scheme struct {
 	OAuth2Flow       string
 	AuthorizationUrl string
 	TokenUrl         string
 	Scopes           map[string]string
+	Flows            []OAuth2Flow // All flows supported by the scheme
+}
+
+// OAuth2Flow describes a single OAuth2 flow. Flow is one of implicit, password, application
+// or accessCode for Swagger 2, and implicit, password, clientCredentials or
+// authorizationCode for OpenAPI 3.
+type OAuth2Flow struct {
+	Flow             string
+	AuthorizationUrl string
+	TokenUrl         string
+	RefreshUrl       string
+	Scopes           map[string]string
 }
 
 type SecurityScheme struct {
-	IsApiKey      bool
-	IsBasic       bool
-	IsOAuth2      bool
-	Type          string
-	Description   string
-	ParamName     string
-	ParamLocation string
+	Name             string
+	IsApiKey         bool
+	IsBasic          bool
+	IsBearer         bool
+	IsOAuth2         bool
+	IsOpenIdConnect  bool
+	Type             string
+	Description      string
+	ParamName        string
+	ParamLocation    string // query, header or cookie
+	BearerFormat     string
+	OpenIdConnectUrl string
 	OAuth2Scheme
 }
 
@@ -132,6 +172,11 @@ type Security struct {
 	Scopes map[string]string
 }
 
+// SecurityRequirement is a set of security schemes, keyed by name, that must all be satisfied
+// together. A method is authorised by satisfying any one of its requirements. An empty
+// requirement means that authorisation is optional.
+type SecurityRequirement map[string]Security
+
 // Method represents an API method
 type Method struct {
 	ID              string
@@ -151,10 +196,13 @@ type Method struct {
 	Responses       map[int]Response
 	DefaultResponse *Response // A ptr to allow of easy checking of its existance in templates
 	Resources       []*Resource
-	Security        map[string]Security
+	Security        map[string]Security   // Every scheme that may be used, keyed by name
+	Requirements    []SecurityRequirement // The combinations of schemes that authorise the method
 	APIGroup        *APIGroup
 	SortKey         string
-	Deprecated      bool
+	Version         string       // The version of the API that the method belongs to
+	CodeSamples     []CodeSample // Sample calls of the method, one per language
+	Deprecation
 }
 
 // Parameter represents an API method parameter
@@ -167,8 +215,24 @@ type Parameter struct {
 	Required                    bool
 	Type                        []string
 	Enum                        []string
-	Resource                    *Resource // For "in body" parameters
-	IsArray                     bool      // "in body" parameter is an array
+	Resource                    *Resource   // For "in body" parameters
+	IsArray                     bool        // "in body" parameter is an array
+	MediaTypes                  []MediaType // OpenAPI 3 request body, per media type
+	Example                     string      // As it would be given in a request
+	Examples                    []Example   // Named examples
+	Deprecation
+	Constraints
+	schema                      *bodySchema // For "in body" parameters
+}
+
+// MediaType represents the body of a request or response for a single content type
+type MediaType struct {
+	ContentType string
+	Resource    *Resource
+	IsArray     bool
+	Example     string
+	Examples    []Example // Named examples
+	schema      *bodySchema
 }
 
 // Response represents an API method response
@@ -178,6 +242,9 @@ type Response struct {
 	Resource          *Resource
 	Headers           []Header
 	IsArray           bool
+	MediaTypes        []MediaType // OpenAPI 3 response content, per media type
+	Examples          []Example   // Swagger 2 examples, named by media type
+	schema            *bodySchema // Swagger 2
 }
 
 type ResourceOrigin int
@@ -202,7 +269,34 @@ type Resource struct {
 	ExcludeFromOperations []string
 	Methods               map[string]*Method
 	Enum                  []string
+	Variants              []*Resource    // oneOf/anyOf alternatives, each with its own example
+	VariantKind           string         // "oneOf" or "anyOf"
+	Discriminator         *Discriminator // Selects between the Variants
+	DiscriminatorValue    string         // The discriminator value that selects this variant
+	Not                   *Resource      // A schema the resource must not match
+	Component             string         // The name of the schema under definitions or components/schemas, if any
+	Deprecation                          // Of a property
+	Constraints
 	origin                ResourceOrigin
+	example               interface{}       // Given by, or made up from, the schema, unless built from its properties
+	spec                  *APISpecification // For a property that links to the resource of its named schema
+	version               string
+}
+
+// Link returns the path of the resource page of the named schema of a property, or "" if the
+// property is described in place.
+func (r *Resource) Link() string {
+	if r.spec == nil {
+		return ""
+	}
+	return "/" + r.spec.ID + "/resources/" + TitleToKebab(r.Component) + "?v=" + r.version
+}
+
+// Discriminator names the property of a polymorphic resource that selects its variant, and
+// maps the values of that property on to the IDs of the variant resources.
+type Discriminator struct {
+	PropertyName string
+	Mapping      map[string]string
 }
 
 type Header struct {
@@ -214,6 +308,7 @@ type Header struct {
 	Default                     string
 	Required                    bool
 	Enum                        []string
+	Example                     string // As it would be sent in a response
 }
 
 // -----------------------------------------------------------------------------
@@ -263,7 +358,7 @@ func (api *APIGroup) getMethodSortKey(path, method, operation, navigation, summa
 // -----------------------------------------------------------------------------
 // -----------------------------------------------------------------------------
 
-func LoadSpecifications(specHost string, collapse bool) error {
+func LoadSpecifications(collapse bool) error {
 
 	if APISuite == nil {
 		APISuite = make(map[string]*APISpecification)
@@ -275,12 +370,7 @@ func LoadSpecifications(specHost string, collapse bool) error {
 		return err
 	}
 
-	if strings.HasPrefix(specHost, "0.0.0.0") {
-		splithost := strings.Split(specHost, ":")
-		splithost[0] = "127.0.0.1"
-		specHost = strings.Join(splithost, ":")
-		logger.Tracef(nil, "Serving specifications from %s\n", specHost)
-	}
+	Diagnostics = nil
 
 	for _, specLocation := range cfg.SpecFilename {
 
@@ -296,41 +386,96 @@ func LoadSpecifications(specHost string, collapse bool) error {
 		}
 
 		specification.URL = specLocation
+		specification.Diagnostics = nil
 
-		location, err := url.Parse(normalizeSpecLocation(specLocation, specHost))
-		if err != nil {
-			return err
+		// A specification that fails to load is skipped, so that the others are still served.
+		src, err := newSpecSource(cfg.SpecDir, specLocation)
+		if err == nil {
+			if remote, ok := src.(*urlSource); ok {
+				specification, err = loadRemote(remote, specLocation, "")
+			} else {
+				err = specification.load(src)
+			}
 		}
+		if err != nil && !HasErrors(specification.Diagnostics) {
+			specification.errorf("", "%s", err)
+		}
+		Diagnostics = append(Diagnostics, specification.Diagnostics...)
 
-		document, err := loadSpec(normalizeSpecLocation(specLocation, specHost))
 		if err != nil {
-			return err
+			continue
 		}
 
-		openAPI3Spec, _ := openapi3.NewSwaggerLoader().LoadSwaggerFromURI(location)
-
-		if openAPI3Spec.OpenAPI != "" {
-			logger.Infof(nil, "OpenAPI 3")
-
-			err = specification.LoadOpenAPI3(document, openAPI3Spec)
-			if err != nil {
-				return err
-			}
-		} else {
-			logger.Infof(nil, "Swagger 2")
+		APISuite[specification.ID] = specification
+	}
 
-			err = specification.LoadSwagger2(document)
-			if err != nil {
-				return err
-			}
-		}
+	// Specifications served as several versions, each loaded from its own file
+	specifications, diagnostics := loadSpecificationVersions(cfg.SpecDir, cfg.SpecVersion, cfg.SpecCurrentVersion)
+	Diagnostics = append(Diagnostics, diagnostics...)
 
+	for _, specification := range specifications {
 		APISuite[specification.ID] = specification
 	}
 
 	return nil
 }
 
+// LoadSpecification loads a single specification from a file or http(s) URL, without adding
+// it to the APISuite. Problems found while loading are recorded in its Diagnostics.
+func LoadSpecification(location string) (*APISpecification, error) {
+
+	specification := &APISpecification{URL: location}
+
+	src, err := newSpecSource("", location)
+	if err != nil {
+		return specification, err
+	}
+	return specification, specification.load(src)
+}
+
+// load reads a specification from its source, and builds the API model from whichever
+// OpenAPI version the document declares.
+func (c *APISpecification) load(src specSource) error {
+
+	data, err := src.Read()
+	if err != nil {
+		return err
+	}
+
+	return c.loadData(src, data)
+}
+
+// loadData builds the API model from a document read from the source.
+func (c *APISpecification) loadData(src specSource, data []byte) error {
+
+	// Assemble a specification that is split across several files into one document
+	data, bundled, err := bundle(src, data)
+	if err != nil {
+		return err
+	}
+	if _, ok := src.(*fileSource); ok {
+		c.Bundled = bundled
+	}
+
+	if isOpenAPI3(data) {
+		logger.Infof(nil, "OpenAPI 3")
+
+		openAPI3Spec, err := loadOpenAPI3Spec(src, data)
+		if err != nil {
+			return err
+		}
+		return c.LoadOpenAPI3(openAPI3Spec)
+	}
+
+	logger.Infof(nil, "Swagger 2")
+
+	document, err := loadSwagger2Spec(src, data)
+	if err != nil {
+		return err
+	}
+	return c.LoadSwagger2(document)
+}
+
 // LoadSwagger2 loads API specs from the supplied Swagger2 document
 func (c *APISpecification) LoadSwagger2(swagger2Doc *loads.Document) error {
 
@@ -342,9 +487,12 @@ func (c *APISpecification) LoadSwagger2(swagger2Doc *loads.Document) error {
 	if basePathLen == 1 && basePath[0] == '/' {
 		basePathLen = 0
 	}
+	if basePathLen > 0 {
+		c.basePath = basePath
+	}
 
 	scheme := "http"
-	if swagger2Spec.Schemes != nil {
+	if len(swagger2Spec.Schemes) > 0 {
 		scheme = swagger2Spec.Schemes[0]
 	}
 
@@ -363,14 +511,21 @@ func (c *APISpecification) LoadSwagger2(swagger2Doc *loads.Document) error {
 	}
 
 	if len(c.APIInfo.Title) == 0 {
-		logger.Errorf(nil, "Error: Specification %s does not have a info.title member.\n", c.URL)
-		os.Exit(1)
+		c.errorf("/info/title", "Specification does not have a info.title member")
+		return fmt.Errorf("specification %s does not have a info.title member", c.URL)
 	}
 
 	logger.Tracef(nil, "Parse OpenAPI specification '%s'\n", c.APIInfo.Title)
 
 	c.ID = TitleToKebab(c.APIInfo.Title)
 
+	c.definitions = swagger2Spec.Definitions
+	c.namedSchemas = namedSchemas2(swagger2Spec.Definitions)
+
+	c.getSecurityDefinitions(swagger2Spec)
+	c.getDefaultSecurity(swagger2Spec)
+	c.getVersionStatuses(swagger2Spec.Extensions)
+
 	methodNavByName := true // Should methods in the navigation be presented by type (GET, POST) or name (string)?
 	if byname, ok := swagger2Spec.Extensions["x-navigateMethodsByName"].(bool); ok {
 		methodNavByName = byname
@@ -381,7 +536,7 @@ func (c *APISpecification) LoadSwagger2(swagger2Doc *loads.Document) error {
 		for _, sortBy := range sortByList {
 			keyname := sortBy.(string)
 			if _, ok := sortTypes[keyname]; !ok {
-				logger.Errorf(nil, "Error: Invalid x-sortBy value %s\n", keyname)
+				c.warnf("/x-sortMethodsBy", "Invalid x-sortMethodsBy value %s", keyname)
 			} else {
 				methodSortBy = append(methodSortBy, keyname)
 			}
@@ -394,7 +549,7 @@ func (c *APISpecification) LoadSwagger2(swagger2Doc *loads.Document) error {
 	// Use the top level TAGS to order the API resources/endpoints
 	// If Tags: [] is not defined, or empty, then no filtering or ordering takes place,
 	// and all API paths will be documented..
-	for _, tag := range getTags(swagger2Spec) {
+	for tagIndex, tag := range getTags(swagger2Spec) {
 		logger.Tracef(nil, "  In tag loop...\n")
 		// Tag matching may not be as expected if multiple paths have the same TAG (which is technically permitted)
 		var ok bool
@@ -432,6 +587,7 @@ func (c *APISpecification) LoadSwagger2(swagger2Doc *loads.Document) error {
 				MethodSortBy:           methodSortBy,
 				Consumes:               swagger2Spec.Consumes,
 				Produces:               swagger2Spec.Produces,
+				Deprecation:            c.getDeprecation(tag.Extensions, false, jsonPointer("tags", strconv.Itoa(tagIndex))),
 			}
 		}
 
@@ -459,18 +615,18 @@ func (c *APISpecification) LoadSwagger2(swagger2Doc *loads.Document) error {
 
 			var ver string
 			if ver, ok = pathItem.Extensions["x-version"].(string); !ok {
-				ver = "latest"
+				ver = LatestVersion
 			}
-			api.CurrentVersion = ver
 
-			c.getMethods2(tag, api, &api.Methods, &pathItem, path, ver) // Current version
-			//c.getVersions(tag, api, pathItem.Versions, path)           // All versions
+			var methods []Method
+			c.getMethods2(tag, api, &methods, &pathItem, path, ver)
+			api.addMethods(methods)
 
 			// If API was populated (will not be if tags do not match), add to set
 			if !groupingByTag && len(api.Methods) > 0 {
 				logger.Tracef(nil, "    + Adding %s\n", name)
 
-				sort.Sort(SortMethods(api.Methods))
+				api.setCurrentVersion()
 				c.APIs = append(c.APIs, *api) // All APIs (versioned within)
 			}
 		}
@@ -478,39 +634,46 @@ func (c *APISpecification) LoadSwagger2(swagger2Doc *loads.Document) error {
 		if groupingByTag && len(api.Methods) > 0 {
 			logger.Tracef(nil, "    + Adding %s\n", name)
 
-			sort.Sort(SortMethods(api.Methods))
+			api.setCurrentVersion()
 			c.APIs = append(c.APIs, *api) // All APIs (versioned within)
 		}
 	}
 
 	// Build a API map, grouping by version
-	for _, api := range c.APIs {
-		for v, _ := range api.Versions {
-			if c.APIVersions == nil {
-				c.APIVersions = make(map[string]APISet)
-			}
-			// Create copy of API and set Methods array to be correct for the version we are building
-			napi := api
-			napi.Methods = napi.Versions[v]
-			napi.Versions = nil
-			c.APIVersions[v] = append(c.APIVersions[v], napi) // Group APIs by version
-		}
-	}
+	c.buildAPIVersions()
+
+	c.checkMethodIDs()
 
 	return nil
 }
 
-// LoadOpenAPI3 loads API specs from the supplied Swagger2 document AND openAPI3 spec.
-// The use of both documents is a bit of technical debt. The openapi3.Swagger struct doesn't contain the Tags element.
-// Its on the todo list!
-func (c *APISpecification) LoadOpenAPI3(swagger2Doc *loads.Document, openAPI3Spec *openapi3.Swagger) error {
+// serverURL3 gives the URL of an OpenAPI 3 server, with each of its variables replaced by its
+// default.
+func serverURL3(server *openapi3.Server) string {
+	u := server.URL
+	for name, variable := range server.Variables {
+		if variable != nil && variable.Default != nil {
+			u = strings.Replace(u, "{"+name+"}", fmt.Sprintf("%v", variable.Default), -1)
+		}
+	}
+	return u
+}
 
-	swagger2Spec := swagger2Doc.Spec()
+// LoadOpenAPI3 loads API specs from the supplied OpenAPI3 spec
+func (c *APISpecification) LoadOpenAPI3(openAPI3Spec *openapi3.Swagger) error {
 
 	u, err := url.Parse("http://localhost")
 	if err != nil {
 		return err
 	}
+	if len(openAPI3Spec.Servers) > 0 && openAPI3Spec.Servers[0] != nil {
+		// The API is documented at its first server, as the location of a Swagger 2 API is
+		// given by its host
+		if u, err = u.Parse(serverURL3(openAPI3Spec.Servers[0])); err != nil {
+			return err
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/")
+	}
 
 	c.APIInfo.Description = string(github_flavored_markdown.Markdown([]byte(openAPI3Spec.Info.Description)))
 	c.APIInfo.Title = openAPI3Spec.Info.Title
@@ -522,25 +685,33 @@ func (c *APISpecification) LoadOpenAPI3(swagger2Doc *loads.Document, openAPI3Spe
 	}
 
 	if len(c.APIInfo.Title) == 0 {
-		logger.Errorf(nil, "Error: Specification %s does not have a info.title member.\n", c.URL)
-		os.Exit(1)
+		c.errorf("/info/title", "Specification does not have a info.title member")
+		return fmt.Errorf("specification %s does not have a info.title member", c.URL)
 	}
 
 	logger.Tracef(nil, "Parse OpenAPI specification '%s'\n", c.APIInfo.Title)
 
 	c.ID = TitleToKebab(c.APIInfo.Title)
 
+	c.schemas = openAPI3Spec.Components.Schemas
+	c.namedSchemas = namedSchemas3(openAPI3Spec.Components.Schemas)
+
+	c.getSecurityDefinitions3(openAPI3Spec)
+	c.getDefaultSecurity3(openAPI3Spec)
+	c.getVersionStatuses(openAPI3Spec.Extensions)
+
 	methodNavByName := true // Should methods in the navigation be presented by type (GET, POST) or name (string)?
-	if byname, ok := openAPI3Spec.Extensions["x-navigateMethodsByName"].(bool); ok {
+	var byname bool
+	if getExtension3(openAPI3Spec.ExtensionProps, "x-navigateMethodsByName", &byname) {
 		methodNavByName = byname
 	}
 
 	methodSortBy := []string{"path", "operation"}
-	if sortByList, ok := openAPI3Spec.Extensions["x-sortMethodsBy"].([]interface{}); ok {
-		for _, sortBy := range sortByList {
-			keyname := sortBy.(string)
+	var sortByList []string
+	if getExtension3(openAPI3Spec.ExtensionProps, "x-sortMethodsBy", &sortByList) {
+		for _, keyname := range sortByList {
 			if _, ok := sortTypes[keyname]; !ok {
-				logger.Errorf(nil, "Error: Invalid x-sortBy value %s\n", keyname)
+				c.warnf("/x-sortMethodsBy", "Invalid x-sortMethodsBy value %s", keyname)
 			} else {
 				methodSortBy = append(methodSortBy, keyname)
 			}
@@ -550,8 +721,9 @@ func (c *APISpecification) LoadOpenAPI3(swagger2Doc *loads.Document, openAPI3Spe
 	// Use the top level TAGS to order the API resources/endpoints
 	// If Tags: [] is not defined, or empty, then no filtering or ordering takes place,
 	// and all API paths will be documented..
-	// TODO - use openapi3 to get tags
-	for _, tag := range getTags(swagger2Spec) {
+	tagDeprecations := c.getTagDeprecations3(openAPI3Spec)
+
+	for _, tag := range getTags3(openAPI3Spec) {
 		logger.Tracef(nil, "  In tag loop...\n")
 
 		api := &APIGroup{}
@@ -586,6 +758,7 @@ func (c *APISpecification) LoadOpenAPI3(swagger2Doc *loads.Document, openAPI3Spe
 				Info:                   &c.APIInfo,
 				MethodNavigationByName: methodNavByName,
 				MethodSortBy:           methodSortBy,
+				Deprecation:            tagDeprecations[name],
 			}
 		}
 
@@ -606,15 +779,20 @@ func (c *APISpecification) LoadOpenAPI3(swagger2Doc *loads.Document, openAPI3Spe
 				}
 			}
 
-			api.CurrentVersion = "latest"
+			var ver string
+			if !getExtension3(pathItem.ExtensionProps, "x-version", &ver) {
+				ver = LatestVersion
+			}
 
-			c.getMethods3(tag, api, &api.Methods, pathItem, path, api.CurrentVersion) // Current version
+			var methods []Method
+			c.getMethods3(tag, api, &methods, pathItem, path, ver)
+			api.addMethods(methods)
 
 			// If API was populated (will not be if tags do not match), add to set
 			if !groupingByTag && len(api.Methods) > 0 {
 				logger.Tracef(nil, "    + Adding %s\n", name)
 
-				sort.Sort(SortMethods(api.Methods))
+				api.setCurrentVersion()
 				c.APIs = append(c.APIs, *api) // All APIs (versioned within)
 			}
 		}
@@ -622,16 +800,47 @@ func (c *APISpecification) LoadOpenAPI3(swagger2Doc *loads.Document, openAPI3Spe
 		if groupingByTag && len(api.Methods) > 0 {
 			logger.Tracef(nil, "    + Adding %s\n", name)
 
-			sort.Sort(SortMethods(api.Methods))
+			api.setCurrentVersion()
 			c.APIs = append(c.APIs, *api) // All APIs (versioned within)
 		}
 	}
 
+	// Build a API map, grouping by version
+	c.buildAPIVersions()
+
+	c.checkMethodIDs()
+
 	return nil
 }
 
 // -----------------------------------------------------------------------------
 
+// checkMethodIDs reports methods that share a route, as only one of them can be viewed.
+func (c *APISpecification) checkMethodIDs() {
+	seen := make(map[string]bool)
+
+	check := func(api APIGroup, version string, methods []Method) {
+		for i := range methods {
+			route := version + " " + api.ID + "/" + methods[i].ID
+			if seen[route] {
+				c.warnf(c.methodPointer(&methods[i]), "Method ID %s is used more than once in API %s (version %s)", methods[i].ID, api.ID, version)
+			}
+			seen[route] = true
+		}
+	}
+
+	for _, api := range c.APIs {
+		check(api, api.CurrentVersion, api.Methods)
+		for version, methods := range api.Versions {
+			if version != api.CurrentVersion {
+				check(api, version, methods)
+			}
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+
 func getTags(specification *spec.Swagger) []spec.Tag {
 	var tags []spec.Tag
 
@@ -644,6 +853,60 @@ func getTags(specification *spec.Swagger) []spec.Tag {
 	return tags
 }
 
+func getTags3(specification *openapi3.Swagger) []openapi3.Tag {
+	var tags []openapi3.Tag
+
+	// kin-openapi does not model the top level tags member of the document, but keeps it (as it
+	// does any other member it does not model) along with the vendor extensions.
+	var specTags openapi3.Tags
+	if getExtension3(specification.ExtensionProps, "tags", &specTags) {
+		for _, tag := range specTags {
+			if tag != nil {
+				tags = append(tags, *tag)
+			}
+		}
+	}
+	if len(tags) == 0 {
+		tags = append(tags, openapi3.Tag{})
+	}
+	return tags
+}
+
+// -----------------------------------------------------------------------------
+// getExtension3 decodes the named vendor extension into v, returning false if the extension
+// is not present or cannot be decoded. kin-openapi holds extensions as raw JSON, rather than
+// the decoded values that go-openapi gives us for a Swagger 2 document.
+func getExtension3(props openapi3.ExtensionProps, name string, v interface{}) bool {
+	return getExtension(props.Extensions, name, v)
+}
+
+// getExtension decodes the named extension, as either Swagger 2 or OpenAPI 3 hold them, into v.
+func getExtension(extensions map[string]interface{}, name string, v interface{}) bool {
+	ext, ok := extensions[name]
+	if !ok {
+		return false
+	}
+
+	var raw []byte
+	switch e := ext.(type) {
+	case json.RawMessage:
+		raw = e
+	case []byte:
+		raw = e
+	default:
+		var err error
+		if raw, err = json.Marshal(e); err != nil {
+			return false
+		}
+	}
+
+	if err := json.Unmarshal(raw, v); err != nil {
+		logger.Errorf(nil, "Error: Invalid %s value %s\n", name, raw)
+		return false
+	}
+	return true
+}
+
 // -----------------------------------------------------------------------------
 
 func (c *APISpecification) getMethods2(tag spec.Tag, api *APIGroup, methods *[]Method, pi *spec.PathItem, path string, version string) {
@@ -657,7 +920,7 @@ func (c *APISpecification) getMethods2(tag spec.Tag, api *APIGroup, methods *[]M
 	c.getMethod2(tag, api, methods, version, pi, pi.Patch, path, "patch")
 }
 
-func (c *APISpecification) getMethods3(tag spec.Tag, api *APIGroup, methods *[]Method, pi *openapi3.PathItem, path string, version string) {
+func (c *APISpecification) getMethods3(tag openapi3.Tag, api *APIGroup, methods *[]Method, pi *openapi3.PathItem, path string, version string) {
 
 	c.getMethod3(tag, api, methods, version, pi, pi.Get, path, "get")
 	c.getMethod3(tag, api, methods, version, pi, pi.Post, path, "post")
@@ -675,6 +938,14 @@ func (c *APISpecification) getMethod2(tag spec.Tag, api *APIGroup, methods *[]Me
 		logger.Tracef(nil, "Skipping %s %s - Operation is nil.", path, methodname)
 		return
 	}
+	// An operation may belong to a different version from the rest of its path
+	if ver, ok := operation.Extensions["x-version"].(string); ok {
+		version = ver
+	}
+	// A specification loaded as one version, from its own file, is wholly that version
+	if c.version != "" {
+		version = c.version
+	}
 	// Filter and sort by matching current top-level tag with the operation tags.
 	// If Tagging is not used by spec, then process each operation without filtering.
 	taglen := len(operation.Tags)
@@ -698,11 +969,20 @@ func (c *APISpecification) getMethod2(tag spec.Tag, api *APIGroup, methods *[]Me
 	}
 }
 
-func (c *APISpecification) getMethod3(tag spec.Tag, api *APIGroup, methods *[]Method, version string, pathitem *openapi3.PathItem, operation *openapi3.Operation, path, methodname string) {
+func (c *APISpecification) getMethod3(tag openapi3.Tag, api *APIGroup, methods *[]Method, version string, pathitem *openapi3.PathItem, operation *openapi3.Operation, path, methodname string) {
 	if operation == nil {
 		logger.Tracef(nil, "Skipping %s %s - Operation is nil.", path, methodname)
 		return
 	}
+	// An operation may belong to a different version from the rest of its path
+	var ver string
+	if getExtension3(operation.ExtensionProps, "x-version", &ver) {
+		version = ver
+	}
+	// A specification loaded as one version, from its own file, is wholly that version
+	if c.version != "" {
+		version = c.version
+	}
 	// Filter and sort by matching current top-level tag with the operation tags.
 	// If Tagging is not used by spec, then process each operation without filtering.
 	taglen := len(operation.Tags)
@@ -738,6 +1018,7 @@ func (c *APISpecification) getSecurityDefinitions(spec *spec.Swagger) {
 		stype := d.Type
 
 		def := &SecurityScheme{
+			Name:          n,
 			Description:   string(github_flavored_markdown.Markdown([]byte(d.Description))),
 			Type:          stype,  // basic, apiKey or oauth2
 			ParamName:     d.Name, // name of header to be used if ParamLocation is 'header'
@@ -759,34 +1040,138 @@ func (c *APISpecification) getSecurityDefinitions(spec *spec.Swagger) {
 			for s, n := range d.Scopes {
 				def.Scopes[s] = n
 			}
+			def.Flows = append(def.Flows, OAuth2Flow{
+				Flow:             d.Flow,
+				AuthorizationUrl: d.AuthorizationURL,
+				TokenUrl:         d.TokenURL,
+				Scopes:           def.Scopes,
+			})
+		}
+
+		c.SecurityDefinitions[n] = *def
+	}
+}
+
+func (c *APISpecification) getSecurityDefinitions3(spec *openapi3.Swagger) {
+
+	if c.SecurityDefinitions == nil {
+		c.SecurityDefinitions = make(map[string]SecurityScheme)
+	}
+
+	for n, ref := range spec.Components.SecuritySchemes {
+		if ref == nil || ref.Value == nil {
+			continue
+		}
+		d := ref.Value
+		stype := d.Type
+
+		def := &SecurityScheme{
+			Name:          n,
+			Description:   string(github_flavored_markdown.Markdown([]byte(d.Description))),
+			Type:          stype,  // http, apiKey, oauth2 or openIdConnect
+			ParamName:     d.Name, // name of header, query parameter or cookie, for an apiKey
+			ParamLocation: d.In,   // Either query, header or cookie
+		}
+
+		switch stype {
+		case "apiKey":
+			def.IsApiKey = true
+		case "http":
+			switch strings.ToLower(d.Scheme) {
+			case "basic":
+				def.IsBasic = true
+			case "bearer":
+				def.IsBearer = true
+				def.BearerFormat = d.BearerFormat
+			}
+		case "oauth2":
+			def.IsOAuth2 = true
+			def.Scopes = make(map[string]string)
+			if d.Flows != nil {
+				// Flows are listed in the order the OpenAPI 3 specification declares them
+				addOAuth2Flow3(def, "implicit", d.Flows.Implicit)
+				addOAuth2Flow3(def, "password", d.Flows.Password)
+				addOAuth2Flow3(def, "clientCredentials", d.Flows.ClientCredentials)
+				addOAuth2Flow3(def, "authorizationCode", d.Flows.AuthorizationCode)
+			}
+		case "openIdConnect":
+			def.IsOpenIdConnect = true
+			// kin-openapi does not model openIdConnectUrl, so it is held with the extensions
+			getExtension3(d.ExtensionProps, "openIdConnectUrl", &def.OpenIdConnectUrl)
 		}
 
 		c.SecurityDefinitions[n] = *def
 	}
 }
 
+func addOAuth2Flow3(def *SecurityScheme, name string, f *openapi3.OAuthFlow) {
+	if f == nil {
+		return
+	}
+
+	flow := OAuth2Flow{
+		Flow:             name,
+		AuthorizationUrl: f.AuthorizationURL,
+		TokenUrl:         f.TokenURL,
+		RefreshUrl:       f.RefreshURL,
+		Scopes:           make(map[string]string),
+	}
+	for s, n := range f.Scopes {
+		flow.Scopes[s] = n
+		def.Scopes[s] = n
+	}
+
+	if len(def.Flows) == 0 {
+		def.OAuth2Flow = flow.Flow
+		def.AuthorizationUrl = flow.AuthorizationUrl
+		def.TokenUrl = flow.TokenUrl
+	}
+	def.Flows = append(def.Flows, flow)
+}
+
 // -----------------------------------------------------------------------------
 
 func (c *APISpecification) getDefaultSecurity(spec *spec.Swagger) {
 	c.DefaultSecurity = make(map[string]Security)
 	c.processSecurity(spec.Security, c.DefaultSecurity)
+	c.DefaultRequirements = c.processSecurityRequirements(spec.Security, "/security")
+}
+
+func (c *APISpecification) getDefaultSecurity3(spec *openapi3.Swagger) {
+	security := securityRequirements3(spec.Security)
+
+	c.DefaultSecurity = make(map[string]Security)
+	c.processSecurity(security, c.DefaultSecurity)
+	c.DefaultRequirements = c.processSecurityRequirements(security, "/security")
+}
+
+// securityRequirements3 converts OpenAPI 3 security requirements to the Swagger 2 form.
+func securityRequirements3(srs openapi3.SecurityRequirements) []map[string][]string {
+	var security []map[string][]string
+	for _, sr := range srs {
+		security = append(security, map[string][]string(sr))
+	}
+	return security
 }
 
 // -----------------------------------------------------------------------------
-func (p *Parameter) setType2(src spec.Parameter) {
+func (p *Parameter) setType2(src spec.Parameter) error {
+	var err error
+
 	if src.Type == "array" {
-		if len(src.CollectionFormat) == 0 {
-			logger.Errorf(nil, "Error: Request parameter %s is an array without declaring the collectionFormat.\n", src.Name)
-			os.Exit(1)
+		collectionFormat := src.CollectionFormat
+		if len(collectionFormat) == 0 {
+			err = fmt.Errorf("Request parameter %s is an array without declaring the collectionFormat, so csv is assumed", src.Name)
+			collectionFormat = "csv"
 		}
 		p.Type = append(p.Type, src.Type)
-		p.CollectionFormat = src.CollectionFormat
-		p.CollectionFormatDescription = collectionFormatDescription(src.CollectionFormat)
+		p.CollectionFormat = collectionFormat
+		p.CollectionFormatDescription = collectionFormatDescription(collectionFormat)
 	}
 	var ptype string
 	var format string
 
-	if src.Type == "array" {
+	if src.Type == "array" && src.Items != nil {
 		ptype = src.Items.Type
 		format = src.Items.Format
 	} else {
@@ -797,17 +1182,22 @@ func (p *Parameter) setType2(src spec.Parameter) {
 		ptype = format
 	}
 	p.Type = append(p.Type, ptype)
+
+	return err
 }
 
-func (p *Parameter) setType3(src *openapi3.Parameter) {
+func (p *Parameter) setType3(src *openapi3.Parameter) error {
+	if src.Schema == nil || src.Schema.Value == nil {
+		return fmt.Errorf("Request parameter %s does not declare a schema", src.Name)
+	}
 	if src.Schema.Value.Type == "array" {
-		if len(src.Schema.Value.Items.Value.Type) == 0 {
-			logger.Errorf(nil, "Error: Request parameter %s is an array without declaring the collectionFormat.\n", src.Name)
-			os.Exit(1)
+		if src.Schema.Value.Items == nil || src.Schema.Value.Items.Value == nil || len(src.Schema.Value.Items.Value.Type) == 0 {
+			p.Type = append(p.Type, "array")
+			return fmt.Errorf("Request parameter %s is an array without declaring the type of its items", src.Name)
 		}
-		p.Type = append(p.Type, src.Schema.Value.Items.Value.Type)
-		p.CollectionFormat = src.Schema.Value.Format
-		p.CollectionFormatDescription = collectionFormatDescription(src.Schema.Value.Items.Value.Type)
+		p.Type = append(p.Type, "array")
+		p.CollectionFormat = collectionFormat3(src)
+		p.CollectionFormatDescription = collectionFormatDescription(p.CollectionFormat)
 	}
 	var ptype string
 	var format string
@@ -823,6 +1213,31 @@ func (p *Parameter) setType3(src *openapi3.Parameter) {
 		ptype = format
 	}
 	p.Type = append(p.Type, ptype)
+
+	return nil
+}
+
+// collectionFormat3 gives the Swagger 2 collectionFormat equivalent to the style of an OpenAPI 3
+// array parameter.
+func collectionFormat3(src *openapi3.Parameter) string {
+	sm, err := src.SerializationMethod()
+	if err != nil {
+		return ""
+	}
+	switch sm.Style {
+	case openapi3.SerializationForm:
+		if sm.Explode {
+			return "multi"
+		}
+		return "csv"
+	case openapi3.SerializationSimple:
+		return "csv"
+	case openapi3.SerializationSpaceDelimited:
+		return "ssv"
+	case openapi3.SerializationPipeDelimited:
+		return "pipes"
+	}
+	return ""
 }
 
 func (p *Parameter) setEnums2(src spec.Parameter) {
@@ -834,21 +1249,24 @@ func (p *Parameter) setEnums2(src spec.Parameter) {
 	}
 	var es = make([]string, 0)
 	for _, e := range ea {
-		es = append(es, fmt.Sprintf("%s", e))
+		es = append(es, fmt.Sprintf("%v", e))
 	}
 	p.Enum = es
 }
 
 func (p *Parameter) setEnums3(src *openapi3.Parameter) {
+	if src.Schema == nil || src.Schema.Value == nil {
+		return
+	}
 	var ea []interface{}
-	if src.Schema.Value.Type == "array" {
+	if src.Schema.Value.Type == "array" && src.Schema.Value.Items != nil && src.Schema.Value.Items.Value != nil {
 		ea = src.Schema.Value.Items.Value.Enum
 	} else {
 		ea = src.Schema.Value.Enum
 	}
 	var es = make([]string, 0)
 	for _, e := range ea {
-		es = append(es, fmt.Sprintf("%s", e))
+		es = append(es, fmt.Sprintf("%v", e))
 	}
 	p.Enum = es
 }
@@ -897,7 +1315,9 @@ func (c *APISpecification) processMethod2(api *APIGroup, pathItem *spec.PathItem
 		OperationName:  operationName,
 		APIGroup:       api,
 		SortKey:        sortkey,
+		Version:        version,
 	}
+	method.Deprecation = c.getDeprecation(o.Extensions, o.Deprecated, c.methodPointer(method))
 	if len(o.Consumes) > 0 {
 		method.Consumes = o.Consumes
 	} else {
@@ -922,8 +1342,8 @@ func (c *APISpecification) processMethod2(api *APIGroup, pathItem *spec.PathItem
 		name := o.Summary
 		description := o.Description
 		if name == "" {
-			logger.Errorf(nil, "Error: Operation '%s' does not have an operationId or summary member.", id)
-			os.Exit(1)
+			c.warnf(c.methodPointer(method), "Operation does not have an x-pathName or summary member, so it is named by its path")
+			name = path
 		}
 		api.Name = name
 		api.Description = description
@@ -934,15 +1354,20 @@ func (c *APISpecification) processMethod2(api *APIGroup, pathItem *spec.PathItem
 		c.ResourceList = make(map[string]map[string]*Resource)
 	}
 
-	for _, param := range o.Parameters {
+	for i, param := range o.Parameters {
 		p := Parameter{
 			Name:        param.Name,
 			In:          param.In,
 			Description: string(github_flavored_markdown.Markdown([]byte(param.Description))),
 			Required:    param.Required,
 		}
-		p.setType2(param)
+		if err := p.setType2(param); err != nil {
+			c.warnf(c.methodPointer(method)+jsonPointer("parameters", strconv.Itoa(i)), "%s", err)
+		}
+		p.Deprecation = c.getDeprecation(param.Extensions, false, c.methodPointer(method)+jsonPointer("parameters", strconv.Itoa(i)))
+		p.Constraints = getParameterConstraints2(param)
 		p.setEnums2(param)
+		p.setExamples2(param)
 
 		switch strings.ToLower(param.In) {
 		case "formdata":
@@ -951,15 +1376,20 @@ func (c *APISpecification) processMethod2(api *APIGroup, pathItem *spec.PathItem
 			method.PathParams = append(method.PathParams, p)
 		case "body":
 			if param.Schema == nil {
-				logger.Errorf(nil, "Error: 'in body' parameter %s is missing a schema declaration.\n", param.Name)
-				os.Exit(1)
+				c.errorf(c.methodPointer(method)+jsonPointer("parameters", strconv.Itoa(i)), "'in body' parameter %s is missing a schema declaration", param.Name)
+				continue
 			}
 			var body map[string]interface{}
+			p.schema = c.bodySchema2(param.Schema)
 			p.Resource, body, p.IsArray = c.resourceFromSchema2(param.Schema, method, nil, true)
-			p.Resource.Schema = jsonResourceToString(body, p.IsArray)
+			if p.Resource == nil {
+				continue
+			}
+			p.Resource.Schema = resourceExample(p.Resource, body, p.IsArray)
 			p.Resource.origin = RequestBody
 			method.BodyParam = &p
 			c.crossLinkMethodAndResource(p.Resource, method, version)
+			c.crossLinkComponents()
 		case "header":
 			method.HeaderParams = append(method.HeaderParams, p)
 		case "query":
@@ -969,12 +1399,13 @@ func (c *APISpecification) processMethod2(api *APIGroup, pathItem *spec.PathItem
 
 	// Compile resources from response declaration
 
+	var responses map[int]spec.Response
 	if o.Responses == nil {
-		logger.Errorf(nil, "Error: Operation %s %s is missing a responses declaration.\n", methodname, path)
-		os.Exit(1)
+		c.errorf(c.methodPointer(method), "Operation is missing a responses declaration")
+	} else {
+		responses = o.Responses.StatusCodeResponses
 	}
-	// FIXME - Dies if there are no responses...
-	for status, response := range o.Responses.StatusCodeResponses {
+	for status, response := range responses {
 		logger.Tracef(nil, "Response for status %d", status)
 		//spew.Dump(response)
 
@@ -991,7 +1422,7 @@ func (c *APISpecification) processMethod2(api *APIGroup, pathItem *spec.PathItem
 
 	}
 
-	if o.Responses.Default != nil {
+	if o.Responses != nil && o.Responses.Default != nil {
 		rsp := c.buildResponse2(o.Responses.Default, method, version)
 		method.DefaultResponse = rsp
 	}
@@ -1000,8 +1431,13 @@ func (c *APISpecification) processMethod2(api *APIGroup, pathItem *spec.PathItem
 	method.Security = make(map[string]Security)
 	if c.processSecurity(o.Security, method.Security) == false {
 		method.Security = c.DefaultSecurity
+		method.Requirements = c.DefaultRequirements
+	} else {
+		method.Requirements = c.processSecurityRequirements(o.Security, c.methodPointer(method)+"/security")
 	}
 
+	method.CodeSamples = c.codeSamples(method, o.Extensions)
+
 	return method
 }
 
@@ -1011,7 +1447,7 @@ func (c *APISpecification) processMethod3(api *APIGroup, pathItem *openapi3.Path
 	var gotOpname bool
 
 	operationName := methodname
-	if opname, gotOpname = o.Extensions["x-operationName"].(string); gotOpname {
+	if gotOpname = getExtension3(o.ExtensionProps, "x-operationName", &opname); gotOpname {
 		operationName = opname
 	}
 
@@ -1047,15 +1483,17 @@ func (c *APISpecification) processMethod3(api *APIGroup, pathItem *openapi3.Path
 		OperationName:  operationName,
 		APIGroup:       api,
 		SortKey:        sortkey,
-		Deprecated:     o.Deprecated,
+		Version:        version,
 	}
+	method.Deprecation = c.getDeprecation(o.Extensions, o.Deprecated, c.methodPointer(method))
 
 	// If Tagging is not used by spec to select, group and order API paths to document, then
 	// complete the missing names.
 	// First try the vendor extension x-pathName, falling back to summary if not set.
 	// XXX Note, that the APIGroup will get the last pathName set on the path methods added to the group (by tag).
 	//
-	if pathname, ok := pathItem.Extensions["x-pathName"].(string); ok {
+	var pathname string
+	if getExtension3(pathItem.ExtensionProps, "x-pathName", &pathname) {
 		api.Name = pathname
 		api.ID = TitleToKebab(api.Name)
 	}
@@ -1063,8 +1501,8 @@ func (c *APISpecification) processMethod3(api *APIGroup, pathItem *openapi3.Path
 		name := o.Summary
 		description := o.Description
 		if name == "" {
-			logger.Errorf(nil, "Error: Operation '%s' does not have an operationId or summary member.", id)
-			os.Exit(1)
+			c.warnf(c.methodPointer(method), "Operation does not have an x-pathName or summary member, so it is named by its path")
+			name = path
 		}
 		api.Name = name
 		api.Description = description
@@ -1075,7 +1513,10 @@ func (c *APISpecification) processMethod3(api *APIGroup, pathItem *openapi3.Path
 		c.ResourceList = make(map[string]map[string]*Resource)
 	}
 
-	for _, param := range o.Parameters {
+	for i, param := range o.Parameters {
+		if param.Value == nil {
+			continue
+		}
 		p := Parameter{
 			Name:        param.Value.Name,
 			In:          param.Value.In,
@@ -1083,26 +1524,19 @@ func (c *APISpecification) processMethod3(api *APIGroup, pathItem *openapi3.Path
 			Required:    param.Value.Required,
 		}
 
-		p.setType3(param.Value)
+		if err := p.setType3(param.Value); err != nil {
+			c.warnf(c.methodPointer(method)+jsonPointer("parameters", strconv.Itoa(i)), "%s", err)
+		}
+		p.Deprecation = c.getDeprecation(param.Value.Extensions, param.Value.Deprecated, c.methodPointer(method)+jsonPointer("parameters", strconv.Itoa(i)))
+		p.Constraints = getParameterConstraints3(param.Value)
 		p.setEnums3(param.Value)
+		p.setExamples3(param.Value)
 
 		switch strings.ToLower(param.Value.In) {
 		case "formdata":
 			method.FormParams = append(method.FormParams, p)
 		case "path":
 			method.PathParams = append(method.PathParams, p)
-		case "body":
-			if param.Value.Schema == nil {
-				logger.Errorf(nil, "Error: 'in body' parameter %s is missing a schema declaration.\n", param.Value.Name)
-				os.Exit(1)
-			}
-			var body map[string]interface{}
-			// TODO request body
-			p.Resource, body, p.IsArray = c.resourceFromSchema3(param.Value.Schema.Value, p.Name, method, nil, true)
-			p.Resource.Schema = jsonResourceToString(body, p.IsArray)
-			p.Resource.origin = RequestBody
-			method.BodyParam = &p
-			c.crossLinkMethodAndResource(p.Resource, method, version)
 		case "header":
 			method.HeaderParams = append(method.HeaderParams, p)
 		case "query":
@@ -1110,50 +1544,140 @@ func (c *APISpecification) processMethod3(api *APIGroup, pathItem *openapi3.Path
 		}
 	}
 
+	// OpenAPI 3 replaces the 'in body' parameter with a requestBody, which may declare a
+	// different schema for each media type the operation consumes.
+	if o.RequestBody != nil && o.RequestBody.Value != nil {
+		method.BodyParam = c.buildRequestBody3(o.RequestBody.Value, method, version)
+		method.Consumes = sortedContentTypes(o.RequestBody.Value.Content)
+	}
+
 	// Compile resources from response declaration
 
-	if o.Responses == nil {
-		logger.Errorf(nil, "Error: Operation %s %s is missing a responses declaration.\n", methodname, path)
-		os.Exit(1)
+	if len(o.Responses) == 0 {
+		c.errorf(c.methodPointer(method), "Operation is missing a responses declaration")
 	}
 
-	// FIXME - Dies if there are no responses...
 	for status, response := range o.Responses {
-		logger.Tracef(nil, "Response for status %d", status)
-		//spew.Dump(response)
-		logger.Infof(nil, response.Ref)
-
-		hasSchema := false
-		for contentType, mediaType := range response.Value.Content {
-			logger.Debugf(nil, contentType)
-			logger.Debugf(nil, mediaType.Schema.Value.Type)
-			hasSchema = true
+		if status == "default" || response.Value == nil {
+			continue
 		}
+		logger.Tracef(nil, "Response for status %s", status)
 
-		// Discover if the resource is already declared, and pick it up
-		// if it is (keyed on version number)
-		if hasSchema {
-			if _, ok := c.ResourceList[version]; !ok {
-				c.ResourceList[version] = make(map[string]*Resource)
-			}
+		iStatus, err := strconv.Atoi(status)
+		if err != nil {
+			c.warnf(c.methodPointer(method)+jsonPointer("responses", status), "Unsupported response status %s", status)
+			continue
 		}
 		rsp := c.buildResponse3(response.Value, method, version)
-		iStatus, _ := strconv.Atoi(status)
 		(*rsp).StatusDescription = HTTPStatusDescription(iStatus)
 		method.Responses[iStatus] = *rsp
+	}
+
+	if def := o.Responses.Default(); def != nil && def.Value != nil {
+		rsp := c.buildResponse3(def.Value, method, version)
+		method.DefaultResponse = rsp
+	}
 
+	method.Produces = producedContentTypes(o.Responses)
+
+	// If no Security given for operation, then the global defaults are appled. An empty list
+	// of requirements removes the global defaults from the operation.
+	if o.Security == nil {
+		method.Security = c.DefaultSecurity
+		method.Requirements = c.DefaultRequirements
+	} else {
+		security := securityRequirements3(*o.Security)
+		method.Security = make(map[string]Security)
+		c.processSecurity(security, method.Security)
+		method.Requirements = c.processSecurityRequirements(security, c.methodPointer(method)+"/security")
 	}
 
-	//if o.Responses.Default != nil {
-	//	rsp := c.buildResponse3(o.Responses.Default().Value, method, version)
-	//	method.DefaultResponse = rsp
-	//}
+	method.CodeSamples = c.codeSamples(method, o.Extensions)
 
 	return method
 }
 
 // -----------------------------------------------------------------------------
 
+func (c *APISpecification) buildRequestBody3(body *openapi3.RequestBody, method *Method, version string) *Parameter {
+
+	p := &Parameter{
+		Name:        "body",
+		In:          "body",
+		Description: string(github_flavored_markdown.Markdown([]byte(body.Description))),
+		Required:    body.Required,
+	}
+
+	for _, contentType := range sortedContentTypes(body.Content) {
+		mediaType := body.Content[contentType]
+
+		mt := MediaType{
+			ContentType: contentType,
+		}
+
+		if mediaType.Schema != nil && mediaType.Schema.Value != nil {
+			var json_body map[string]interface{}
+
+			mt.schema = c.bodySchema3(mediaType.Schema)
+
+			mt.Resource, json_body, mt.IsArray = c.resourceFromSchema3(mediaType.Schema, "", method, nil, true)
+			if mt.Resource != nil {
+				mt.Resource.Schema = resourceExample(mt.Resource, json_body, mt.IsArray)
+				mt.Resource.origin = RequestBody
+				c.crossLinkMethodAndResource(mt.Resource, method, version)
+				c.crossLinkComponents()
+			}
+		}
+
+		if mediaType.Example != nil {
+			mt.Example = exampleString(mediaType.Example, contentType)
+		}
+		mt.Examples = namedExamples3(mediaType.Examples, contentType)
+
+		p.MediaTypes = append(p.MediaTypes, mt)
+	}
+
+	// The body parameter itself describes the preferred media type, so that templates
+	// written for a Swagger 2 'in body' parameter continue to work.
+	if preferred := preferredMediaType(p.MediaTypes); preferred != nil {
+		p.Resource = preferred.Resource
+		p.IsArray = preferred.IsArray
+	}
+
+	return p
+}
+
+// sortedContentTypes returns the media types declared by an OpenAPI 3 content map, in a
+// stable order.
+func sortedContentTypes(content openapi3.Content) []string {
+	var contentTypes []string
+	for contentType := range content {
+		contentTypes = append(contentTypes, contentType)
+	}
+	sort.Strings(contentTypes)
+	return contentTypes
+}
+
+// preferredMediaType picks the JSON media type, if one is declared, falling back to the
+// first media type that has a schema.
+func preferredMediaType(mediaTypes []MediaType) *MediaType {
+	var preferred *MediaType
+	for i := range mediaTypes {
+		if mediaTypes[i].Resource == nil {
+			continue
+		}
+		if strings.Contains(mediaTypes[i].ContentType, "json") {
+			return &mediaTypes[i]
+		}
+		if preferred == nil {
+			preferred = &mediaTypes[i]
+		}
+	}
+	return preferred
+}
+
+// -----------------------------------------------------------------------------
+
 func (c *APISpecification) buildResponse2(resp *spec.Response, method *Method, version string) *Response {
 	var response *Response
 
@@ -1162,24 +1686,31 @@ func (c *APISpecification) buildResponse2(resp *spec.Response, method *Method, v
 		var r *Resource
 		var is_array bool
 		var example_json map[string]interface{}
+		var schema *bodySchema
 
 		if resp.Schema != nil {
+			schema = c.bodySchema2(resp.Schema)
 			r, example_json, is_array = c.resourceFromSchema2(resp.Schema, method, nil, false)
 
 			if r != nil {
-				r.Schema = jsonResourceToString(example_json, false)
+				r.Schema = resourceExample(r, example_json, false)
 				r.origin = MethodResponse
 				vres = c.crossLinkMethodAndResource(r, method, version)
+				c.crossLinkComponents()
 			}
 		}
 		response = &Response{
 			Description: string(github_flavored_markdown.Markdown([]byte(resp.Description))),
 			Resource:    vres,
 			IsArray:     is_array,
+			Examples:    mediaTypeExamples2(resp.Examples),
+			schema:      schema,
 		}
 		method.Resources = append(method.Resources, response.Resource) // Add the resource to the method which uses it
 
-		response.compileHeaders(resp)
+		for _, name := range response.compileHeaders(resp) {
+			c.warnf(c.methodPointer(method), "Response header %s is an array without declaring the collectionFormat, so csv is assumed", name)
+		}
 	}
 	return response
 }
@@ -1188,47 +1719,88 @@ func (c *APISpecification) buildResponse3(resp *openapi3.Response, method *Metho
 	var response *Response
 
 	if resp != nil {
-		var vres *Resource
-		var r *Resource
-		var is_array bool
-		var example_json map[string]interface{}
+		response = &Response{
+			Description: string(github_flavored_markdown.Markdown([]byte(resp.Description))),
+		}
 
-		// get the first content type available
+		for _, contentType := range sortedContentTypes(resp.Content) {
+			mediaType := resp.Content[contentType]
 
-		var schema *openapi3.Schema
-		var name string
-		for _, mediaType := range resp.Content {
-			schema = mediaType.Schema.Value
-			name = parseSchemaRef(mediaType.Schema.Ref)
-			break
-		}
+			mt := MediaType{
+				ContentType: contentType,
+			}
 
-		if schema != nil {
-			r, example_json, is_array = c.resourceFromSchema3(schema, name, method, nil, false)
+			if mediaType.Schema != nil && mediaType.Schema.Value != nil {
+				mt.schema = c.bodySchema3(mediaType.Schema)
+				r, example_json, is_array := c.resourceFromSchema3(mediaType.Schema, "", method, nil, false)
 
-			if r != nil {
-				r.Schema = jsonResourceToString(example_json, false)
-				r.origin = MethodResponse
-				vres = c.crossLinkMethodAndResource(r, method, version)
+				if r != nil {
+					r.Schema = resourceExample(r, example_json, false)
+					r.origin = MethodResponse
+					mt.Resource = c.crossLinkMethodAndResource(r, method, version)
+					mt.IsArray = is_array
+					c.crossLinkComponents()
+				}
+			}
+
+			if mediaType.Example != nil {
+				mt.Example = exampleString(mediaType.Example, contentType)
 			}
+			mt.Examples = namedExamples3(mediaType.Examples, contentType)
+
+			response.MediaTypes = append(response.MediaTypes, mt)
 		}
-		response = &Response{
-			Description: string(github_flavored_markdown.Markdown([]byte(resp.Description))),
-			Resource:    vres,
-			IsArray:     is_array,
+
+		// As with request bodies, the response itself describes the preferred media type.
+		if preferred := preferredMediaType(response.MediaTypes); preferred != nil {
+			response.Resource = preferred.Resource
+			response.IsArray = preferred.IsArray
+		}
+		for _, mt := range response.MediaTypes {
+			if mt.Resource != nil {
+				method.Resources = append(method.Resources, mt.Resource) // Add the resource to the method which uses it
+			}
 		}
-		method.Resources = append(method.Resources, response.Resource) // Add the resource to the method which uses it
 
-		//response.compileHeaders(resp)
+		response.compileHeaders3(resp)
 	}
 	return response
 }
 
-func parseSchemaRef(schemaRef string) string {
-	if len(schemaRef) < 21 {
-		return schemaRef
+// producedContentTypes returns every media type returned by the responses of an OpenAPI 3
+// operation, the OpenAPI 3 equivalent of the Swagger 2 produces list.
+func producedContentTypes(responses openapi3.Responses) []string {
+	seen := make(map[string]bool)
+	var contentTypes []string
+
+	for _, response := range responses {
+		if response.Value == nil {
+			continue
+		}
+		for contentType := range response.Value.Content {
+			if !seen[contentType] {
+				seen[contentType] = true
+				contentTypes = append(contentTypes, contentType)
+			}
+		}
+	}
+	sort.Strings(contentTypes)
+	return contentTypes
+}
+
+// schemaRefName returns the name of the schema that a $ref refers to, when it is a member of
+// the definitions (Swagger 2) or components/schemas (OpenAPI 3) of the document, or "" if not.
+func schemaRefName(ref string) string {
+	for _, prefix := range []string{"#/components/schemas/", "#/definitions/"} {
+		if strings.HasPrefix(ref, prefix) {
+			name := ref[len(prefix):]
+			if strings.Contains(name, "/") {
+				return "" // Within a named schema, rather than the schema itself
+			}
+			return strings.Replace(strings.Replace(name, "~1", "/", -1), "~0", "~", -1)
+		}
 	}
-	return schemaRef[21:]
+	return ""
 }
 
 // -----------------------------------------------------------------------------
@@ -1286,6 +1858,160 @@ func (c *APISpecification) crossLinkMethodAndResource(resource *Resource, method
 	return vres
 }
 
+// -----------------------------------------------------------------------------
+// Named schemas, those under the definitions (Swagger 2) or components/schemas (OpenAPI 3) of
+// a specification, keep their $ref as the specification is loaded. A resource built from a
+// named schema is identified by the name, and a property that is a named object, or an array
+// of them, links to the resource of its schema rather than describing it again. The resource
+// is cross linked with every method that uses it, however deeply it is nested.
+
+// pendingComponent is the named schema of a property, yet to be cross linked with the method
+// that uses it
+type pendingComponent struct {
+	key               string
+	name              string
+	method            *Method
+	isRequestResource bool
+}
+
+// enterComponent records that the resource of a named schema is being built, returning false
+// if it already is, in which case the schema is recursive.
+func (c *APISpecification) enterComponent(name string) bool {
+	if name == "" {
+		return true
+	}
+	if c.building == nil {
+		c.building = make(map[string]bool)
+	}
+	if c.building[name] {
+		return false
+	}
+	c.building[name] = true
+	return true
+}
+
+func (c *APISpecification) leaveComponent(name string) {
+	delete(c.building, name)
+}
+
+// linkComponent links a property that is a named object, or an array of them, to the resource
+// of its schema, queueing that resource to be cross linked with the method.
+func (c *APISpecification) linkComponent(property *Resource, method *Method, isRequestResource bool) {
+	if property.Component == "" || len(property.Type) != 1 {
+		return // Described in place, as are primitives, arrays of primitives and maps
+	}
+	if t := strings.ToLower(property.Type[0]); t != "object" && t != "array" {
+		return
+	}
+	property.spec = c
+	property.version = method.Version
+
+	// A request resource leaves out the properties excluded from the method's operation, so
+	// is built for each operation
+	origin := "response"
+	if isRequestResource {
+		origin = "request/" + method.OperationName
+	}
+	c.pending = append(c.pending, pendingComponent{
+		key:               method.Version + "/" + origin + "/" + property.Component,
+		name:              property.Component,
+		method:            method,
+		isRequestResource: isRequestResource,
+	})
+}
+
+// crossLinkComponents builds the resource of each named schema queued by linkComponent, once
+// per version and origin, and per operation for a request, and cross links it with the method that uses it. Building a resource
+// may queue further named schemas.
+func (c *APISpecification) crossLinkComponents() {
+	if c.components == nil {
+		c.components = make(map[string]*Resource)
+	}
+
+	for len(c.pending) > 0 {
+		pending := c.pending[0]
+		c.pending = c.pending[1:]
+
+		r, ok := c.components[pending.key]
+		if !ok {
+			r = c.componentResource(pending.name, pending.method, pending.isRequestResource)
+			c.components[pending.key] = r
+		}
+		if r != nil {
+			c.crossLinkMethodAndResource(r, pending.method, pending.method.Version)
+		}
+	}
+}
+
+// componentResource builds the resource of a named schema.
+func (c *APISpecification) componentResource(name string, method *Method, isRequestResource bool) *Resource {
+	var r *Resource
+	var example map[string]interface{}
+
+	if _, ok := c.definitions[name]; ok {
+		s := &spec.Schema{SchemaProps: spec.SchemaProps{Ref: spec.MustCreateRef("#" + jsonPointer("definitions", name))}}
+		r, example, _ = c.resourceFromSchema2(s, method, nil, isRequestResource)
+	} else if schema, ok := c.schemas[name]; ok && schema != nil {
+		ref := &openapi3.SchemaRef{Ref: "#" + jsonPointer("components", "schemas", name), Value: schema.Value}
+		r, example, _ = c.resourceFromSchema3(ref, "", method, nil, isRequestResource)
+	}
+	if r == nil {
+		return nil
+	}
+
+	r.Schema = resourceExample(r, example, false)
+	r.origin = MethodResponse
+	if isRequestResource {
+		r.origin = RequestBody
+	}
+	return r
+}
+
+// resolveSchema2 returns a copy of the named schema that a Swagger 2 schema refers to, along
+// with its name, or the schema itself and "" if it is not a $ref to a named schema. Building
+// a resource alters its schema, so each use of a named schema has its own copy.
+func (c *APISpecification) resolveSchema2(s *spec.Schema) (*spec.Schema, string) {
+	var component string
+	seen := make(map[string]bool)
+
+	for s != nil && s.Ref.String() != "" {
+		ref := s.Ref.String()
+		name := schemaRefName(ref)
+		definition, ok := c.definitions[name]
+		if !ok || seen[name] {
+			c.warnf("", "Unresolved $ref %s", ref)
+			break
+		}
+		seen[name] = true
+		if component == "" {
+			component = name
+		}
+		s = copySchema2(&definition)
+	}
+	return s, component
+}
+
+func copySchema2(s *spec.Schema) *spec.Schema {
+	var schema spec.Schema
+	if b, err := json.Marshal(s); err == nil && json.Unmarshal(b, &schema) == nil {
+		return &schema
+	}
+	return s
+}
+
+// operationResourceTitle titles the resource of an unnamed schema that has no title of its
+// own, after the operation that uses it.
+func operationResourceTitle(method *Method, isRequestResource bool) string {
+	name := method.Name
+	if name == "" {
+		name = strings.Replace(method.ID, "-", " ", -1)
+	}
+	if isRequestResource {
+		return name + " request"
+	}
+	return name + " response"
+}
+
 // -----------------------------------------------------------------------------
 // OpenAPI/Swagger/go-openAPI define a Header object and an Items object. A
 // Header _can_ be an Items object, if it is an array. Annoyingly, a Header
@@ -1317,7 +2043,7 @@ func getEnums(h spec.Header) []string {
 	}
 	var es = make([]string, 0)
 	for _, e := range ea {
-		es = append(es, fmt.Sprintf("%s", e))
+		es = append(es, fmt.Sprintf("%v", e))
 	}
 	return es
 }
@@ -1340,7 +2066,8 @@ func collectionFormatDescription(format string) string {
 	return ""
 }
 
-func (r *Response) compileHeaders(sr *spec.Response) {
+// compileHeaders returns the names of any headers that had to be degraded.
+func (r *Response) compileHeaders(sr *spec.Response) (degraded []string) {
 
 	if sr.Headers == nil {
 		return
@@ -1354,13 +2081,14 @@ func (r *Response) compileHeaders(sr *spec.Response) {
 
 		htype := getType(params)
 		if params.Type == "array" {
-			if len(params.CollectionFormat) == 0 {
-				logger.Errorf(nil, "Error: Response header %s is an array without declaring the collectionFormat.\n", name)
-				os.Exit(1)
+			collectionFormat := params.CollectionFormat
+			if len(collectionFormat) == 0 {
+				degraded = append(degraded, name)
+				collectionFormat = "csv"
 			}
 			header.Type = append(header.Type, params.Type)
-			header.CollectionFormat = params.CollectionFormat
-			header.CollectionFormatDescription = collectionFormatDescription(params.CollectionFormat)
+			header.CollectionFormat = collectionFormat
+			header.CollectionFormatDescription = collectionFormatDescription(collectionFormat)
 		}
 		format := getFormat(params)
 		if len(format) > 0 {
@@ -1368,6 +2096,86 @@ func (r *Response) compileHeaders(sr *spec.Response) {
 		}
 		header.Type = append(header.Type, htype)
 		header.Enum = getEnums(params)
+		header.Example = headerExample2(params)
+
+		r.Headers = append(r.Headers, *header)
+	}
+	return
+}
+
+// OpenAPI 3 describes a header through a schema, and always serialises an array header
+// with the simple style, which is comma separated.
+func getType3(s *openapi3.Schema) string {
+	if s.Type == "array" && s.Items != nil && s.Items.Value != nil {
+		return s.Items.Value.Type
+	}
+	return s.Type
+}
+func getFormat3(s *openapi3.Schema) string {
+	if s.Type == "array" && s.Items != nil && s.Items.Value != nil {
+		return s.Items.Value.Format
+	}
+	return s.Format
+}
+func getEnums3(s *openapi3.Schema) []string {
+	var ea []interface{}
+	if s.Type == "array" && s.Items != nil && s.Items.Value != nil {
+		ea = s.Items.Value.Enum
+	} else {
+		ea = s.Enum
+	}
+	var es = make([]string, 0)
+	for _, e := range ea {
+		es = append(es, fmt.Sprintf("%v", e))
+	}
+	return es
+}
+
+func (r *Response) compileHeaders3(sr *openapi3.Response) {
+
+	if sr.Headers == nil {
+		return
+	}
+
+	var names []string
+	for name := range sr.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ref := sr.Headers[name]
+		if ref == nil || ref.Value == nil {
+			continue
+		}
+		params := ref.Value
+
+		header := &Header{
+			Description: string(github_flavored_markdown.Markdown([]byte(params.Description))),
+			Name:        name,
+		}
+		getExtension3(params.ExtensionProps, "required", &header.Required)
+
+		if params.Schema != nil && params.Schema.Value != nil {
+			schema := params.Schema.Value
+
+			htype := getType3(schema)
+			if schema.Type == "array" {
+				header.Type = append(header.Type, schema.Type)
+				header.CollectionFormat = "csv"
+				header.CollectionFormatDescription = collectionFormatDescription(header.CollectionFormat)
+			}
+			format := getFormat3(schema)
+			if len(format) > 0 {
+				htype = format
+			}
+			header.Type = append(header.Type, htype)
+			header.Enum = getEnums3(schema)
+			if schema.Default != nil {
+				header.Default = fmt.Sprintf("%v", schema.Default)
+			}
+		}
+		header.Example = headerExample3(params)
 
 		r.Headers = append(r.Headers, *header)
 	}
@@ -1381,29 +2189,69 @@ func (c *APISpecification) processSecurity(s []map[string][]string, security map
 	for _, sec := range s {
 		for n, scopes := range sec {
 			// Lookup security name in definitions
-			if scheme, ok := c.SecurityDefinitions[n]; ok {
+			if sc, ok := c.lookupSecurity(n, scopes); ok {
 				count++
 
-				// Add security
-				security[scheme.Type] = Security{
-					Scheme: &scheme,
-					Scopes: make(map[string]string),
-				}
-
-				if scheme.IsOAuth2 {
-					// Populate method specific scopes by cross referencing SecurityDefinitions
-					for _, scope := range scopes {
-						if scope_desc, ok := scheme.Scopes[scope]; ok {
-							security[scheme.Type].Scopes[scope] = scope_desc
-						}
+				// Add security, merging the scopes of any earlier requirement using the same scheme
+				if existing, ok := security[n]; ok {
+					for scope, desc := range existing.Scopes {
+						sc.Scopes[scope] = desc
 					}
 				}
+				security[n] = sc
 			}
 		}
 	}
 	return count != 0
 }
 
+// processSecurityRequirements keeps the security requirements as alternatives (OR), each of
+// which lists the schemes that must be used together (AND).
+func (c *APISpecification) processSecurityRequirements(s []map[string][]string, pointer string) []SecurityRequirement {
+
+	var requirements []SecurityRequirement
+	for i, sec := range s {
+		requirement := make(SecurityRequirement)
+		for n, scopes := range sec {
+			if sc, ok := c.lookupSecurity(n, scopes); ok {
+				requirement[n] = sc
+			} else {
+				c.warnf(pointer+jsonPointer(strconv.Itoa(i), n), "Security requirement references undefined scheme %s", n)
+			}
+		}
+		if len(requirement) == 0 && len(sec) > 0 {
+			continue // Only references undefined schemes
+		}
+		requirements = append(requirements, requirement)
+	}
+	return requirements
+}
+
+func (c *APISpecification) lookupSecurity(name string, scopes []string) (Security, bool) {
+
+	scheme, ok := c.SecurityDefinitions[name]
+	if !ok {
+		return Security{}, false
+	}
+
+	sc := Security{
+		Scheme: &scheme,
+		Scopes: make(map[string]string),
+	}
+
+	if scheme.IsOAuth2 || scheme.IsOpenIdConnect {
+		// Populate method specific scopes by cross referencing SecurityDefinitions
+		for _, scope := range scopes {
+			if scope_desc, ok := scheme.Scopes[scope]; ok {
+				sc.Scopes[scope] = scope_desc
+			} else {
+				sc.Scopes[scope] = ""
+			}
+		}
+	}
+	return sc, true
+}
+
 // -----------------------------------------------------------------------------
 
 func jsonResourceToString(jsonres map[string]interface{}, is_array bool) string {
@@ -1454,8 +2302,10 @@ func checkPropertyType2(s *spec.Schema) string {
 
 			if s.Items.Schema != nil {
 				s = s.Items.Schema
-			} else {
+			} else if len(s.Items.Schemas) > 0 {
 				s = &s.Items.Schemas[0] // - Main schema [1] = Additional properties? See online swagger editior.
+			} else {
+				return ptype
 			}
 
 			if s.Type == nil {
@@ -1507,7 +2357,7 @@ func checkPropertyType3(s *openapi3.Schema) string {
 
 		if s.Type == "array" {
 
-			if s.Items != nil {
+			if s.Items.Value != nil {
 				s = s.Items.Value
 			}
 
@@ -1534,6 +2384,7 @@ func (c *APISpecification) resourceFromSchema2(s *spec.Schema, method *Method, f
 	if s == nil {
 		return nil, nil, false
 	}
+	s, component := c.resolveSchema2(s)
 
 	stype := checkPropertyType2(s)
 	logger.Tracef(nil, "resourceFromSchema2: Schema type: %s\n", stype)
@@ -1564,6 +2415,11 @@ func (c *APISpecification) resourceFromSchema2(s *spec.Schema, method *Method, f
 		s.Type = append(s.Type, "object")
 	}
 
+	if s.Items != nil && s.Items.Schema == nil && len(s.Items.Schemas) == 0 {
+		c.errorf(c.methodPointer(method), "Array schema %s has no items schema", s.Title)
+		return nil, nil, false
+	}
+
 	original_s := s
 	if s.Items != nil {
 		stringorarray := s.Type
@@ -1576,6 +2432,10 @@ func (c *APISpecification) resourceFromSchema2(s *spec.Schema, method *Method, f
 			s = &s.Items.Schemas[0]
 			logger.Tracef(nil, "got s.Items.Schemas[0] for %s\n", s.Title)
 		}
+		if items, name := c.resolveSchema2(s); name != "" {
+			s = items
+			component = name
+		}
 		if s.Type == nil {
 			logger.Tracef(nil, "Got array of objects or object. Name %s\n", s.Title)
 			s.Type = stringorarray // Put back original type
@@ -1593,15 +2453,27 @@ func (c *APISpecification) resourceFromSchema2(s *spec.Schema, method *Method, f
 		logger.Tracef(nil, "REMAP SCHEMA (Type is now %s)\n", s.Type)
 	}
 
+	valueType := s.Type[len(s.Type)-1] // Before any format replaces it
 	if len(s.Format) > 0 {
 		s.Type[len(s.Type)-1] = s.Format
 	}
 
-	id := TitleToKebab(s.Title)
+	title := s.Title
+	id := TitleToKebab(title)
 
-	if len(fqNS) == 0 && id == "" {
-		logger.Errorf(nil, "Error: %s %s references a model definition that does not have a title member.", strings.ToUpper(method.Method), method.Path)
-		os.Exit(1)
+	if len(fqNS) == 0 {
+		// A resource is identified by the name of its schema, or failing that by its title, or
+		// by the operation that uses it
+		switch {
+		case component != "":
+			if title == "" {
+				title = component
+			}
+			id = TitleToKebab(component)
+		case title == "":
+			title = operationResourceTitle(method, isRequestResource)
+			id = TitleToKebab(title)
+		}
 	}
 
 	// Ignore ID (from title element) for all but child-objects...
@@ -1656,11 +2528,12 @@ func (c *APISpecification) resourceFromSchema2(s *spec.Schema, method *Method, f
 
 	r := &Resource{
 		ID:          id,
-		Title:       s.Title,
+		Title:       title,
 		Description: description,
 		Type:        s.Type,
 		Properties:  make(map[string]*Resource),
 		FQNS:        resourceFQNS,
+		Component:   component,
 	}
 
 	if s.Example != nil {
@@ -1673,11 +2546,14 @@ func (c *APISpecification) resourceFromSchema2(s *spec.Schema, method *Method, f
 
 	if len(s.Enum) > 0 {
 		for _, e := range s.Enum {
-			r.Enum = append(r.Enum, fmt.Sprintf("%s", e))
+			r.Enum = append(r.Enum, fmt.Sprintf("%v", e))
 		}
 	}
 
 	r.ReadOnly = original_s.ReadOnly
+	r.Constraints = getConstraints2(original_s, s)
+	r.example = schemaExample2(original_s, s, valueType, r.Constraints)
+	r.Deprecation = c.getDeprecation(original_s.Extensions, false, c.methodPointer(method))
 	if ops, ok := original_s.Extensions["x-excludeFromOperations"].([]interface{}); ok && isRequestResource {
 		// Mark resource property as being excluded from operations with this name.
 		// This filtering only takes effect in a request body, just like readOnly, so when isRequestResource is true
@@ -1691,20 +2567,35 @@ func (c *APISpecification) resourceFromSchema2(s *spec.Schema, method *Method, f
 	required := make(map[string]bool)
 	json_representation := make(map[string]interface{})
 
+	if !c.enterComponent(component) {
+		return r, json_representation, is_array // Recursive, so described by the resource of the schema
+	}
+	defer c.leaveComponent(component)
+
 	logger.Tracef(nil, "Call compileproperties2...\n")
 	c.compileproperties2(s, r, method, id, required, json_representation, myFQNS, chopped, isRequestResource)
 
 	for allof := range s.AllOf {
-		c.compileproperties2(&s.AllOf[allof], r, method, id, required, json_representation, myFQNS, chopped, isRequestResource)
+		allOf, _ := c.resolveSchema2(&s.AllOf[allof])
+		c.compileproperties2(allOf, r, method, id, required, json_representation, myFQNS, chopped, isRequestResource)
 	}
 
+	c.compileVariants2(s, r, method, json_representation, isRequestResource)
+
 	logger.Tracef(nil, "resourceFromSchema2 done\n")
 
 	return r, json_representation, is_array
 }
 
-func (c *APISpecification) resourceFromSchema3(s *openapi3.Schema, name string, method *Method, fqNS []string, isRequestResource bool) (*Resource, map[string]interface{}, bool) {
-	if s == nil {
+func (c *APISpecification) resourceFromSchema3(schema *openapi3.SchemaRef, name string, method *Method, fqNS []string, isRequestResource bool) (*Resource, map[string]interface{}, bool) {
+	if schema == nil || schema.Value == nil {
+		return nil, nil, false
+	}
+	s := schema.Value
+	component := schemaRefName(schema.Ref)
+
+	if s.Items != nil && s.Items.Value == nil {
+		c.errorf(c.methodPointer(method), "Unresolved $ref %s in the items of an array schema", s.Items.Ref)
 		return nil, nil, false
 	}
 
@@ -1713,14 +2604,15 @@ func (c *APISpecification) resourceFromSchema3(s *openapi3.Schema, name string,
 	logger.Tracef(nil, "FQNS: %s\n", fqNS)
 	logger.Tracef(nil, "CHECK schema type and items\n")
 
-	rType := spec.StringOrArray([]string{})
-	rType = append(rType, s.Type)
-
-	if rType == nil {
-		rType = append(rType, s.Type)
+	stype = s.Type
+	if stype == "" && (len(s.AllOf) > 0 || len(s.OneOf) > 0 || len(s.AnyOf) > 0) {
+		stype = "object" // A composed schema need not declare its type
 	}
 
-	title := s.Type
+	rType := spec.StringOrArray([]string{})
+	rType = append(rType, stype)
+
+	title := stype
 
 	originalS := s
 	if s.Items != nil {
@@ -1728,6 +2620,9 @@ func (c *APISpecification) resourceFromSchema3(s *openapi3.Schema, name string,
 
 		// Jump to nearest schema for items, depending on how it was declared
 		if s.Items.Value.Properties != nil { // items: { properties: {} }
+			if items := schemaRefName(s.Items.Ref); items != "" {
+				component = items
+			}
 			s = s.Items.Value
 			rType = append(rType, s.Type)
 			title = createTitle(s.Items, s.Type)
@@ -1760,12 +2655,23 @@ func (c *APISpecification) resourceFromSchema3(s *openapi3.Schema, name string,
 	if name != "" {
 		title = name
 	}
-	id := TitleToKebab(title)
+	if len(fqNS) == 0 {
+		// A resource is identified by the name of its schema, or failing that by its title, or
+		// by the operation that uses it
+		var schemaTitle string
+		getExtension3(originalS.ExtensionProps, "title", &schemaTitle) // Not modelled by kin-openapi
 
-	if len(fqNS) == 0 && id == "" {
-		logger.Errorf(nil, "Error: %s %s references a model definition that does not have a title member.", strings.ToUpper(method.Method), method.Path)
-		os.Exit(1)
+		switch {
+		case component != "":
+			title = component
+		case name != "":
+		case schemaTitle != "":
+			title = schemaTitle
+		default:
+			title = operationResourceTitle(method, isRequestResource)
+		}
 	}
+	id := TitleToKebab(title)
 
 	// Ignore ID (from title element) for all but child-objects...
 	// This prevents the title-derived ID being added onto the end of the FQNS.property as
@@ -1824,6 +2730,7 @@ func (c *APISpecification) resourceFromSchema3(s *openapi3.Schema, name string,
 		Type:        rType,
 		Properties:  make(map[string]*Resource),
 		FQNS:        resourceFQNS,
+		Component:   component,
 	}
 
 	if s.Example != nil {
@@ -1836,36 +2743,201 @@ func (c *APISpecification) resourceFromSchema3(s *openapi3.Schema, name string,
 
 	if len(s.Enum) > 0 {
 		for _, e := range s.Enum {
-			r.Enum = append(r.Enum, fmt.Sprintf("%s", e))
+			r.Enum = append(r.Enum, fmt.Sprintf("%v", e))
 		}
 	}
 
 	r.ReadOnly = originalS.ReadOnly
-	if ops, ok := originalS.Extensions["x-excludeFromOperations"].([]interface{}); ok && isRequestResource {
+	values := s // Of an array of primitives, the items
+	if s == originalS && s.Type == "array" && s.Items != nil && s.Items.Value != nil {
+		values = s.Items.Value
+	}
+	r.Constraints = getConstraints3(originalS, values)
+	r.example = schemaExample3(originalS, values, r.Constraints)
+	var deprecated bool
+	getExtension3(originalS.ExtensionProps, "deprecated", &deprecated) // Not modelled by kin-openapi
+	r.Deprecation = c.getDeprecation(originalS.Extensions, deprecated, c.methodPointer(method))
+	var ops []string
+	if isRequestResource && getExtension3(originalS.ExtensionProps, "x-excludeFromOperations", &ops) {
 		// Mark resource property as being excluded from operations with this name.
 		// This filtering only takes effect in a request body, just like readOnly, so when isRequestResource is true
-		for _, op := range ops {
-			if c, ok := op.(string); ok {
-				r.ExcludeFromOperations = append(r.ExcludeFromOperations, c)
-			}
-		}
+		r.ExcludeFromOperations = append(r.ExcludeFromOperations, ops...)
 	}
 
 	required := make(map[string]bool)
 	jsonRepresentations := make(map[string]interface{})
 
+	if !c.enterComponent(component) {
+		return r, jsonRepresentations, is_array // Recursive, so described by the resource of the schema
+	}
+	defer c.leaveComponent(component)
+
 	logger.Tracef(nil, "Call compileproperties2...\n")
 	c.compileproperties3(s, r, method, id, required, jsonRepresentations, myFQNS, chopped, isRequestResource)
 
-	for allof := range s.AllOf {
-		c.compileproperties3(s.AllOf[allof].Value, r, method, id, required, jsonRepresentations, myFQNS, chopped, isRequestResource)
+	for _, allOf := range s.AllOf {
+		if allOf == nil {
+			continue
+		}
+		if allOf.Value == nil {
+			c.errorf(c.methodPointer(method), "Unresolved $ref %s in the allOf of a schema", allOf.Ref)
+			continue
+		}
+		c.compileproperties3(allOf.Value, r, method, id, required, jsonRepresentations, myFQNS, chopped, isRequestResource)
 	}
 
+	c.compileVariants3(s, r, method, jsonRepresentations, isRequestResource)
+
 	logger.Tracef(nil, "resourceFromSchema2 done\n")
 
 	return r, jsonRepresentations, is_array
 }
 
+// -----------------------------------------------------------------------------
+// Takes the oneOf or anyOf alternatives of a schema, and adds them to the Resource object
+// as variants. Each variant carries its own JSON representation, with the discriminator
+// property (if there is one) set to the value that selects it. The resource's own JSON
+// representation takes the shape of its first variant.
+//
+func (c *APISpecification) compileVariants2(s *spec.Schema, r *Resource, method *Method, json_rep map[string]interface{}, isRequestResource bool) {
+
+	variants := s.OneOf
+	r.VariantKind = "oneOf"
+	if len(variants) == 0 {
+		variants = s.AnyOf
+		r.VariantKind = "anyOf"
+	}
+	if len(variants) == 0 {
+		r.VariantKind = ""
+	}
+
+	// Swagger 2 has no discriminator mapping. The value that selects a variant is the name of
+	// its definition, falling back to its title.
+	if s.Discriminator != "" {
+		r.Discriminator = &Discriminator{PropertyName: s.Discriminator, Mapping: make(map[string]string)}
+	}
+
+	for i := range variants {
+		variant := variants[i] // Copy, so that a missing title can be filled in
+		name := schemaRefName(variant.Ref.String())
+		if variant.Title == "" && name == "" {
+			variant.Title = fmt.Sprintf("%s option %d", r.Title, i+1)
+		}
+
+		vr, vjson, vIsArray := c.resourceFromSchema2(&variant, method, nil, isRequestResource)
+		if vr == nil {
+			continue
+		}
+		if name == "" {
+			name = variants[i].Title
+		}
+		if r.Discriminator != nil && name != "" {
+			vr.DiscriminatorValue = name
+			r.Discriminator.Mapping[vr.DiscriminatorValue] = vr.ID
+		}
+		addVariant(r, vr, vjson, vIsArray, json_rep, i == 0)
+	}
+
+	if s.Not != nil {
+		not := *s.Not
+		if not.Title == "" {
+			not.Title = "not " + r.Title
+		}
+		r.Not, _, _ = c.resourceFromSchema2(&not, method, nil, isRequestResource)
+	}
+}
+
+func (c *APISpecification) compileVariants3(s *openapi3.Schema, r *Resource, method *Method, json_rep map[string]interface{}, isRequestResource bool) {
+
+	variants := s.OneOf
+	r.VariantKind = "oneOf"
+	if len(variants) == 0 {
+		variants = s.AnyOf
+		r.VariantKind = "anyOf"
+	}
+	if len(variants) == 0 {
+		r.VariantKind = ""
+	}
+
+	if s.Discriminator != nil {
+		r.Discriminator = &Discriminator{PropertyName: s.Discriminator.PropertyName, Mapping: make(map[string]string)}
+		for value, ref := range s.Discriminator.Mapping {
+			name := schemaRefName(ref)
+			if name == "" {
+				name = ref // A mapping may give the name of the schema alone
+			}
+			r.Discriminator.Mapping[value] = TitleToKebab(name)
+		}
+	}
+
+	for i, variant := range variants {
+		if variant == nil || variant.Value == nil {
+			continue
+		}
+		name := schemaRefName(variant.Ref)
+		if name == "" {
+			name = fmt.Sprintf("%s option %d", r.Title, i+1)
+		}
+
+		vr, vjson, vIsArray := c.resourceFromSchema3(variant, name, method, nil, isRequestResource)
+		if vr == nil {
+			continue
+		}
+		if r.Discriminator != nil {
+			vr.DiscriminatorValue = discriminatorValue(r.Discriminator, vr.ID, variant.Ref)
+		}
+		addVariant(r, vr, vjson, vIsArray, json_rep, i == 0)
+	}
+
+	if s.Not != nil && s.Not.Value != nil {
+		name := schemaRefName(s.Not.Ref)
+		if name == "" {
+			name = "not " + r.Title
+		}
+		r.Not, _, _ = c.resourceFromSchema3(s.Not, name, method, nil, isRequestResource)
+	}
+}
+
+// discriminatorValue returns the value of the discriminator property that selects a variant.
+// An explicit mapping takes precedence, otherwise the value is the name of the schema.
+func discriminatorValue(d *Discriminator, id string, ref string) string {
+	var values []string
+	for value, mapped := range d.Mapping {
+		if mapped == id {
+			values = append(values, value)
+		}
+	}
+	if len(values) > 0 {
+		sort.Strings(values)
+		return values[0]
+	}
+	value := schemaRefName(ref)
+	if value == "" {
+		return ""
+	}
+	d.Mapping[value] = id
+	return value
+}
+
+func addVariant(r *Resource, vr *Resource, vjson map[string]interface{}, vIsArray bool, json_rep map[string]interface{}, first bool) {
+
+	if r.Discriminator != nil && vr.DiscriminatorValue != "" && len(vjson) > 0 {
+		vjson[r.Discriminator.PropertyName] = vr.DiscriminatorValue
+	}
+	if len(vjson) > 0 || vr.example != nil {
+		vr.Schema = resourceExample(vr, vjson, vIsArray)
+	}
+	r.Variants = append(r.Variants, vr)
+
+	if first {
+		for name, value := range vjson {
+			if _, ok := json_rep[name]; !ok {
+				json_rep[name] = value
+			}
+		}
+	}
+}
+
 func createTitle(schema *openapi3.SchemaRef, stype string) string {
 	if stype != "" {
 		return stype
@@ -1894,10 +2966,14 @@ func (c *APISpecification) compileproperties2(s *spec.Schema, r *Resource, metho
 
 	// Special case to deal with AdditionalProperties (which really just boils down to declaring a
 	// map of 'type' (string, int, object etc).
-	if s.AdditionalProperties != nil && s.AdditionalProperties.Allows {
+	if s.AdditionalProperties != nil && s.AdditionalProperties.Allows && s.AdditionalProperties.Schema != nil {
 		name := "<key>"
-		ap := s.AdditionalProperties.Schema
-		ap.Type = spec.StringOrArray([]string{"map", ap.Type[0]}) // massage type so that it is a map of 'type'
+		ap, _ := c.resolveSchema2(s.AdditionalProperties.Schema)
+		apType := "object" // Of any type, so its values are described as objects
+		if len(ap.Type) > 0 {
+			apType = ap.Type[0]
+		}
+		ap.Type = spec.StringOrArray([]string{"map", apType}) // massage type so that it is a map of 'type'
 
 		c.processProperty2(ap, name, r, method, id, required, json_rep, myFQNS, chopped, isRequestResource)
 	}
@@ -1911,14 +2987,14 @@ func (c *APISpecification) compileproperties3(s *openapi3.Schema, r *Resource, m
 	}
 
 	for name, property := range s.Properties {
-		c.processProperty3(property.Value, name, r, method, id, required, json_rep, myFQNS, chopped, isRequestResource)
+		c.processProperty3(property, name, r, method, id, required, json_rep, myFQNS, chopped, isRequestResource)
 	}
 
 	// Special case to deal with AdditionalProperties (which really just boils down to declaring a
 	// map of 'type' (string, int, object etc).
 	if s.AdditionalProperties != nil {
 		name := "<key>"
-		ap := s.AdditionalProperties.Value
+		ap := s.AdditionalProperties
 
 		c.processProperty3(ap, name, r, method, id, required, json_rep, myFQNS, chopped, isRequestResource)
 	}
@@ -1935,6 +3011,12 @@ func (c *APISpecification) processProperty2(s *spec.Schema, name string, r *Reso
 
 	logger.Tracef(nil, "A call resourceFromSchema2 for property %s\n", name)
 	resource, json_resource, _ = c.resourceFromSchema2(s, method, newFQNS, isRequestResource)
+	if resource == nil {
+		return
+	}
+	c.linkComponent(resource, method, isRequestResource)
+
+	s, _ = c.resolveSchema2(s) // For the items of an array, below
 
 	skip := isRequestResource && resource.ReadOnly
 	if !skip && resource.ExcludeFromOperations != nil {
@@ -2020,10 +3102,18 @@ func (c *APISpecification) processProperty2(s *spec.Schema, name string, r *Reso
 		// We're an object
 		json_rep[name] = json_resource
 	}
+	if resource.example != nil {
+		json_rep[name] = resource.example // Given by, or made up from, the schema
+	}
 	return
 }
 
-func (c *APISpecification) processProperty3(s *openapi3.Schema, name string, r *Resource, method *Method, id string, required map[string]bool, json_rep map[string]interface{}, myFQNS []string, chopped bool, isRequestResource bool) {
+func (c *APISpecification) processProperty3(schema *openapi3.SchemaRef, name string, r *Resource, method *Method, id string, required map[string]bool, json_rep map[string]interface{}, myFQNS []string, chopped bool, isRequestResource bool) {
+
+	if schema == nil || schema.Value == nil {
+		return
+	}
+	s := schema.Value
 
 	newFQNS := prepareNamespace(myFQNS, id, name, chopped)
 
@@ -2031,7 +3121,11 @@ func (c *APISpecification) processProperty3(s *openapi3.Schema, name string, r *
 	var resource *Resource
 
 	logger.Tracef(nil, "A call resourceFromSchema2 for property %s\n", name)
-	resource, json_resource, _ = c.resourceFromSchema3(s, name, method, newFQNS, isRequestResource)
+	resource, json_resource, _ = c.resourceFromSchema3(schema, name, method, newFQNS, isRequestResource)
+	if resource == nil {
+		return
+	}
+	c.linkComponent(resource, method, isRequestResource)
 
 	skip := isRequestResource && resource.ReadOnly
 	if !skip && resource.ExcludeFromOperations != nil {
@@ -2117,6 +3211,9 @@ func (c *APISpecification) processProperty3(s *openapi3.Schema, name string, r *
 		// We're an object
 		json_rep[name] = json_resource
 	}
+	if resource.example != nil {
+		json_rep[name] = resource.example // Given by, or made up from, the schema
+	}
 	return
 }
 
@@ -2155,32 +3252,6 @@ func CamelToKebab(s string) string {
 	return s
 }
 
-// -----------------------------------------------------------------------------
-
-func loadSpec(url string) (*loads.Document, error) {
-
-	logger.Infof(nil, "Importing OpenAPI specifications from %s", url)
-
-	document, err := loads.Spec(url)
-	if err != nil {
-		//logger.Errorf(nil, "Error: go-openapi/loads filed to load spec url [%s]: %s", url, err)
-		return nil, err
-	}
-
-	//options := &spec.ExpandOptions{
-	//	RelativeBase: "/Users/csmith1/src/go/src/github.com/UKHomeOffice/dapperdox-demo/specifications",
-	//}
-
-	// TODO Allow relative references https://github.com/go-openapi/spec/issues/14
-	err = spec.ExpandSpec(document.Spec(), nil)
-	if err != nil {
-		//logger.Errorf(nil, "Error: go-openapi/spec filed to expand spec: %s", err)
-		return nil, err
-	}
-
-	return document, nil
-}
-
 // -----------------------------------------------------------------------------
 // Wrapper around MarshalIndent to prevent < > & from being escaped
 func JSONMarshalIndent(v interface{}) ([]byte, error) {
@@ -2201,13 +3272,3 @@ func isLocalSpecUrl(specUrl string) bool {
 	}
 	return !match
 }
-
-// -----------------------------------------------------------------------------
-
-func normalizeSpecLocation(specLocation string, specHost string) string {
-	if isLocalSpecUrl(specLocation) {
-		return "http://" + specHost + specLocation
-	} else {
-		return specLocation
-	}
-}
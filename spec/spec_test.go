@@ -1,10 +1,22 @@
 package spec
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/go-openapi/loads"
 	"github.com/go-openapi/spec"
+	"go/format"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestLoadsSwagger2(t *testing.T) {
@@ -29,15 +41,11 @@ func TestLoadsOpenAPI3(t *testing.T) {
 
 	const openAPI3SpecFile = "../examples/specifications/petstore3/swagger.json"
 
-	swagger2Doc, _ := loads.JSONSpec(openAPI3SpecFile)
-
 	specification := &APISpecification{}
 
-	_ = spec.ExpandSpec(swagger2Doc.Spec(), nil)
-
 	openAPI3Spec, _ := openapi3.NewSwaggerLoader().LoadSwaggerFromFile(openAPI3SpecFile)
 
-	err := specification.LoadOpenAPI3(swagger2Doc, openAPI3Spec)
+	err := specification.LoadOpenAPI3(openAPI3Spec)
 
 	if err != nil {
 		t.Error(`Failed to load spec` + err.Error())
@@ -49,23 +57,1716 @@ func TestLoadsOpenAPI3(t *testing.T) {
 	if specification.APIInfo.Title != "Swagger Petstore3" {
 		t.Error(`APIInfo.Title fail`)
 	}
+	if len(specification.APIs) != 3 {
+		t.Error(`Tags fail`)
+	}
+	if pet := specification.GetByID("pet"); pet == nil || pet.ExternalDocs == nil || pet.ExternalDocs.URL != "http://swagger.io" {
+		t.Error(`Tag externalDocs fail`)
+	}
 
 }
 func TestLoadsRefData(t *testing.T) {
 
 	const openAPI3SpecFile = "../examples/specifications/refdata/swagger.yml"
 
-	swagger2Doc, _ := loads.JSONSpec(openAPI3SpecFile)
+	specification := &APISpecification{}
+
+	openAPI3Spec, _ := openapi3.NewSwaggerLoader().LoadSwaggerFromFile(openAPI3SpecFile)
+
+	err := specification.LoadOpenAPI3(openAPI3Spec)
+
+	if err != nil {
+		t.Error(`Failed to load spec` + err.Error())
+	}
+}
+
+func TestLoadsFromFileSource(t *testing.T) {
+
+	src := &fileSource{path: "../examples/specifications/petstore/swagger.json"}
 
 	specification := &APISpecification{}
 
-	_ = spec.ExpandSpec(swagger2Doc.Spec(), nil)
+	err := specification.load(src)
+
+	if err != nil {
+		t.Error(`Failed to load spec` + err.Error())
+	}
+	if specification.ID != "swagger-petstore" {
+		t.Error(`ID fail`)
+	}
+
+	src = &fileSource{path: "../examples/specifications/petstore3/swagger.json"}
+
+	specification = &APISpecification{}
+
+	err = specification.load(src)
+
+	if err != nil {
+		t.Error(`Failed to load spec` + err.Error())
+	}
+	if specification.ID != "swagger-petstore3" {
+		t.Error(`ID fail`)
+	}
+}
+
+// loadOpenAPI3Test loads an OpenAPI 3 document as the specification /<id>.yaml, failing the
+// test if it does not parse or load.
+func loadOpenAPI3Test(t *testing.T, id string, document string) *APISpecification {
+	return loadOpenAPI3Into(t, &APISpecification{URL: "/" + id + ".yaml"}, document)
+}
+
+// loadOpenAPI3Into loads an OpenAPI 3 document into the specification given.
+func loadOpenAPI3Into(t *testing.T, specification *APISpecification, document string) *APISpecification {
+	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData([]byte(document))
+	if err != nil {
+		t.Fatal(`Failed to parse spec` + err.Error())
+	}
+	if err = specification.LoadOpenAPI3(swagger); err != nil {
+		t.Fatal(`Failed to load spec` + err.Error())
+	}
+	return specification
+}
+
+func TestLoadsOpenAPI3RequestBody(t *testing.T) {
+
+	const openAPI3SpecFile = "../examples/specifications/petstore3/swagger.json"
+
+	specification := &APISpecification{}
+
+	openAPI3Spec, _ := openapi3.NewSwaggerLoader().LoadSwaggerFromFile(openAPI3SpecFile)
+
+	err := specification.LoadOpenAPI3(openAPI3Spec)
+
+	if err != nil {
+		t.Error(`Failed to load spec` + err.Error())
+	}
+
+	var addPet *Method
+	for i, method := range specification.GetByID("pet").Methods {
+		if method.ID == "add-pet" {
+			addPet = &specification.GetByID("pet").Methods[i]
+		}
+	}
+	if addPet == nil || addPet.BodyParam == nil {
+		t.Fatal(`Request body fail`)
+	}
+	if len(addPet.BodyParam.MediaTypes) != 2 || addPet.BodyParam.MediaTypes[0].ContentType != "application/json" {
+		t.Error(`Request body media types fail`)
+	}
+	if addPet.BodyParam.Resource == nil || addPet.BodyParam.Resource.ID != "pet" {
+		t.Error(`Request body resource fail`)
+	}
+	if len(addPet.Consumes) != 2 {
+		t.Error(`Consumes fail`)
+	}
+}
+
+func TestLoadsOpenAPI3Responses(t *testing.T) {
+
+	const openAPI3SpecFile = "../examples/specifications/petstore3/swagger.json"
+
+	specification := &APISpecification{}
 
 	openAPI3Spec, _ := openapi3.NewSwaggerLoader().LoadSwaggerFromFile(openAPI3SpecFile)
 
-	err := specification.LoadOpenAPI3(swagger2Doc, openAPI3Spec)
+	err := specification.LoadOpenAPI3(openAPI3Spec)
 
 	if err != nil {
 		t.Error(`Failed to load spec` + err.Error())
 	}
+
+	methods := make(map[string]Method)
+	for _, method := range specification.GetByID("user").Methods {
+		methods[method.ID] = method
+	}
+
+	login := methods["login-user"].Responses[200]
+	if len(login.MediaTypes) != 2 || login.MediaTypes[0].ContentType != "application/json" {
+		t.Error(`Response media types fail`)
+	}
+	if len(login.Headers) != 2 || login.Headers[0].Name != "X-Expires-After" || login.Headers[1].Type[0] != "int32" {
+		t.Error(`Response headers fail`)
+	}
+	if methods["logout-user"].DefaultResponse == nil {
+		t.Error(`Default response fail`)
+	}
+	if _, ok := methods["logout-user"].Responses[0]; ok {
+		t.Error(`Default response status fail`)
+	}
+}
+
+func TestLoadsOpenAPI3Polymorphism(t *testing.T) {
+
+	const openAPI3Spec = `
+openapi: 3.0.0
+info:
+  title: Payments
+  version: 1.0.0
+paths:
+  /payments:
+    get:
+      summary: List payments
+      responses:
+        '200':
+          description: A payment
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Payment'
+components:
+  schemas:
+    Payment:
+      oneOf:
+        - $ref: '#/components/schemas/Card'
+        - $ref: '#/components/schemas/BankTransfer'
+      discriminator:
+        propertyName: method
+        mapping:
+          card: '#/components/schemas/Card'
+    Card:
+      type: object
+      properties:
+        method:
+          type: string
+        number:
+          type: string
+    BankTransfer:
+      type: object
+      properties:
+        method:
+          type: string
+        iban:
+          type: string
+`
+	specification := loadOpenAPI3Test(t, "payments", openAPI3Spec)
+
+	payment := specification.ResourceList["latest"]["payment"]
+	if payment == nil || len(payment.Variants) != 2 || payment.VariantKind != "oneOf" {
+		t.Fatal(`Variants fail`)
+	}
+	if payment.Discriminator == nil || payment.Discriminator.PropertyName != "method" {
+		t.Error(`Discriminator fail`)
+	}
+	if payment.Variants[0].DiscriminatorValue != "card" || payment.Variants[1].DiscriminatorValue != "BankTransfer" {
+		t.Error(`Discriminator value fail`)
+	}
+	if !strings.Contains(payment.Variants[1].Schema, `"method": "BankTransfer"`) {
+		t.Error(`Variant example fail`)
+	}
+}
+
+func TestLoadsOpenAPI3Security(t *testing.T) {
+
+	const openAPI3Spec = `
+openapi: 3.0.0
+info:
+  title: Secured
+  version: 1.0.0
+security:
+  - bearer: []
+paths:
+  /accounts:
+    get:
+      summary: List accounts
+      security:
+        - oauth: [read]
+          key: []
+        - {}
+      responses:
+        '200':
+          description: The accounts
+  /profile:
+    get:
+      summary: Get profile
+      responses:
+        '200':
+          description: The profile
+components:
+  securitySchemes:
+    bearer:
+      type: http
+      scheme: bearer
+      bearerFormat: JWT
+    key:
+      type: apiKey
+      name: session
+      in: cookie
+    oidc:
+      type: openIdConnect
+      openIdConnectUrl: https://example.com/.well-known/openid-configuration
+    oauth:
+      type: oauth2
+      flows:
+        clientCredentials:
+          tokenUrl: https://example.com/token
+          scopes:
+            read: Read access
+        authorizationCode:
+          authorizationUrl: https://example.com/authorize
+          tokenUrl: https://example.com/token
+          scopes:
+            write: Write access
+`
+	specification := loadOpenAPI3Test(t, "accounts", openAPI3Spec)
+
+	if !specification.SecurityDefinitions["bearer"].IsBearer || specification.SecurityDefinitions["bearer"].BearerFormat != "JWT" {
+		t.Error(`Bearer scheme fail`)
+	}
+	if key := specification.SecurityDefinitions["key"]; !key.IsApiKey || key.ParamLocation != "cookie" {
+		t.Error(`API key scheme fail`)
+	}
+	if oidc := specification.SecurityDefinitions["oidc"]; !oidc.IsOpenIdConnect || oidc.OpenIdConnectUrl == "" {
+		t.Error(`OpenID Connect scheme fail`)
+	}
+	if oauth := specification.SecurityDefinitions["oauth"]; len(oauth.Flows) != 2 || oauth.OAuth2Flow != "clientCredentials" || len(oauth.Scopes) != 2 {
+		t.Error(`OAuth2 flows fail`)
+	}
+
+	methods := make(map[string]Method)
+	for _, api := range specification.APIs {
+		for _, method := range api.Methods {
+			methods[method.ID] = method
+		}
+	}
+
+	accounts := methods["list-accounts"]
+	if len(accounts.Requirements) != 2 || len(accounts.Requirements[0]) != 2 || len(accounts.Requirements[1]) != 0 {
+		t.Error(`Operation security requirements fail`)
+	}
+	if len(accounts.Security["oauth"].Scopes) != 1 {
+		t.Error(`Operation security scopes fail`)
+	}
+	if _, ok := methods["get-profile"].Security["bearer"]; !ok || len(methods["get-profile"].Requirements) != 1 {
+		t.Error(`Global security fail`)
+	}
+}
+
+func TestLoadsOpenAPI3WithDiagnostics(t *testing.T) {
+
+	const openAPI3Spec = `
+openapi: 3.0.0
+info:
+  title: Broken
+  version: 1.0.0
+paths:
+  /things/{id}:
+    get:
+      summary: Get a thing
+      parameters:
+        - name: id
+          in: path
+          required: true
+          content:
+            text/plain: {}
+      security:
+        - missing: []
+      responses: {}
+`
+	specification := loadOpenAPI3Test(t, "broken", openAPI3Spec)
+	if len(specification.Diagnostics) != 3 || !HasErrors(specification.Diagnostics) {
+		t.Fatal(`Diagnostics fail`)
+	}
+	for _, d := range specification.Diagnostics {
+		if d.Spec != "/broken.yaml" || !strings.HasPrefix(d.Pointer, "/paths/~1things~1{id}/get") {
+			t.Error(`Diagnostic pointer fail: ` + d.String())
+		}
+	}
+
+	specification = &APISpecification{}
+
+	swagger, _ := openapi3.NewSwaggerLoader().LoadSwaggerFromData([]byte(strings.Replace(openAPI3Spec, "title: Broken", "title: ''", 1)))
+
+	if specification.LoadOpenAPI3(swagger) == nil || specification.Diagnostics[0].Pointer != "/info/title" {
+		t.Error(`Missing title fail`)
+	}
+}
+
+func TestReportsUnresolvedSchemas(t *testing.T) {
+
+	const openAPI3Spec = `
+openapi: 3.0.0
+info:
+  title: Unresolved
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      summary: List pets
+      responses:
+        '200':
+          description: Pets
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: '#/components/schemas/Pet'
+    post:
+      summary: Add a pet
+      requestBody:
+        content:
+          application/json:
+            schema:
+              allOf:
+                - $ref: '#/components/schemas/Pet'
+      responses:
+        '201':
+          description: Added
+  /pets/{id}:
+    get:
+      summary: Get a pet
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        '200':
+          description: A pet
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        tags:
+          type: array
+          items:
+            type: string
+`
+	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData([]byte(openAPI3Spec))
+	if err != nil {
+		t.Fatal(`Failed to parse spec` + err.Error())
+	}
+	// As left by a $ref that could not be resolved
+	pets := swagger.Paths["/pets"]
+	pets.Get.Responses["200"].Value.Content["application/json"].Schema.Value.Items.Value = nil
+	pets.Post.RequestBody.Value.Content["application/json"].Schema.Value.AllOf[0].Value = nil
+	swagger.Components.Schemas["Pet"].Value.Properties["tags"].Value.Items.Value = nil
+
+	specification := &APISpecification{URL: "/unresolved.yaml"}
+
+	if err = specification.LoadOpenAPI3(swagger); err != nil {
+		t.Error(`Failed to load spec` + err.Error())
+	}
+	if len(specification.Diagnostics) != 3 || !HasErrors(specification.Diagnostics) {
+		t.Fatalf(`Diagnostics fail: %v`, specification.Diagnostics)
+	}
+	for _, d := range specification.Diagnostics {
+		if !strings.HasPrefix(d.Pointer, "/paths/~1pets") {
+			t.Error(`Diagnostic pointer fail: ` + d.String())
+		}
+	}
+
+	const swagger2Spec = `{
+  "swagger": "2.0",
+  "info": {"title": "Unresolved", "version": "1.0.0"},
+  "schemes": [],
+  "paths": {
+    "/pets": {
+      "get": {
+        "summary": "List pets",
+        "responses": {
+          "200": {
+            "description": "Pets",
+            "schema": {"type": "array", "items": []}
+          },
+          "default": {
+            "description": "Labels",
+            "schema": {"type": "object", "additionalProperties": {}}
+          }
+        }
+      }
+    }
+  }
+}`
+	document, err := loads.Analyzed(json.RawMessage(swagger2Spec), "")
+	if err != nil {
+		t.Fatal(`Failed to parse spec` + err.Error())
+	}
+
+	specification = &APISpecification{URL: "/unresolved.json"}
+
+	if err = specification.LoadSwagger2(document); err != nil {
+		t.Error(`Failed to load spec` + err.Error())
+	}
+	if len(specification.Diagnostics) != 1 || specification.Diagnostics[0].Pointer != "/paths/~1pets/get" {
+		t.Errorf(`Swagger 2 diagnostics fail: %v`, specification.Diagnostics)
+	}
+}
+
+func TestRefreshesRemoteSpecification(t *testing.T) {
+
+	const openAPI3Spec = `
+openapi: 3.0.0
+info:
+  title: Remote
+  version: 1.0.0
+paths: {}
+`
+	document, etag, status := openAPI3Spec, `"1"`, http.StatusOK
+	notModified := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(status)
+		w.Write([]byte(document))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/openapi.yaml")
+	src := &urlSource{location: u, remote: &remoteSpec{location: u.String()}}
+
+	specification, err := loadRemote(src, u.String(), "")
+	if err != nil || specification.APIInfo.Title != "Remote" || specification.Remote.Stale {
+		t.Fatal(`Failed to load remote spec`)
+	}
+
+	specification, err = loadRemote(src, u.String(), "")
+	if err != nil || notModified != 1 || specification.APIInfo.Title != "Remote" {
+		t.Error(`Conditional fetch fail`)
+	}
+
+	// A document that no longer parses leaves the last good version in place
+	document, etag = "openapi: [", `"2"`
+
+	specification, err = loadRemote(src, u.String(), "")
+	if err != nil || specification.APIInfo.Title != "Remote" || !specification.Remote.Stale {
+		t.Error(`Unparsable refresh fail`)
+	}
+
+	// As does a failed fetch
+	etag, status = `"3"`, http.StatusInternalServerError
+
+	specification, err = loadRemote(src, u.String(), "")
+	if err != nil || specification.APIInfo.Title != "Remote" || !specification.Remote.Stale {
+		t.Error(`Failed fetch fail`)
+	}
+
+	document, etag, status = strings.Replace(openAPI3Spec, "title: Remote", "title: Refreshed", 1), `"4"`, http.StatusOK
+
+	specification, err = loadRemote(src, u.String(), "")
+	if err != nil || specification.APIInfo.Title != "Refreshed" || specification.Remote.Stale {
+		t.Error(`Refresh fail`)
+	}
+}
+
+func TestStopsRefreshingRemoteSpecifications(t *testing.T) {
+
+	var lock sync.Mutex
+	fetches := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		fetches++
+		n := fetches
+		lock.Unlock()
+		w.Write([]byte(fmt.Sprintf("openapi: 3.0.0 # %d", n)))
+	}))
+	defer server.Close()
+
+	saved := remoteSpecs
+	defer func() { remoteSpecs = saved }()
+	remoteSpecs = map[string]*remoteSpec{server.URL: {location: server.URL, interval: 10 * time.Millisecond}}
+
+	changed := make(chan struct{}, 100)
+	stop := RefreshRemoteSpecifications(func() { changed <- struct{}{} })
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal(`Refresh fail`)
+	}
+	stop()
+	stop()
+
+	time.Sleep(50 * time.Millisecond) // A fetch under way when stopped may still finish
+	lock.Lock()
+	stopped := fetches
+	lock.Unlock()
+
+	time.Sleep(100 * time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	if fetches != stopped {
+		t.Errorf(`Stop fail: %d fetches after stopping`, fetches-stopped)
+	}
+}
+
+func TestReloadsWhatARefreshFetched(t *testing.T) {
+
+	var lock sync.Mutex
+	fetches := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		fetches++
+		n := fetches
+		lock.Unlock()
+		w.Write([]byte(fmt.Sprintf("openapi: 3.0.0 # %d", n)))
+	}))
+	defer server.Close()
+
+	remote := &remoteSpec{location: server.URL, interval: 10 * time.Millisecond}
+
+	saved := remoteSpecs
+	defer func() { remoteSpecs = saved }()
+	remoteSpecs = map[string]*remoteSpec{server.URL: remote}
+
+	// The reload that a change calls for reads the specifications
+	var once sync.Once
+	reloaded := make(chan string, 1)
+	stop := RefreshRemoteSpecifications(func() {
+		once.Do(func() {
+			b, _ := remote.read()
+
+			lock.Lock()
+			reloaded <- fmt.Sprintf("%s after %d fetches", b, fetches)
+			lock.Unlock()
+		})
+	})
+	defer stop()
+
+	select {
+	case reload := <-reloaded:
+		if reload != "openapi: 3.0.0 # 1 after 1 fetches" {
+			t.Errorf(`Reload fail: %s`, reload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal(`Refresh fail`)
+	}
+}
+
+func TestComparesVersions(t *testing.T) {
+
+	const openAPI3Spec = `
+openapi: 3.0.0
+info:
+  title: Pets
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      parameters:
+        - name: status
+          in: query
+          schema:
+            type: string
+            enum: [available, sold]
+      responses:
+        '200':
+          description: The pets
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+  /pets/{id}:
+    delete:
+      operationId: deletePet
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        '204':
+          description: Deleted
+components:
+  schemas:
+    Pet:
+      title: Pet
+      type: object
+      properties:
+        name:
+          type: string
+        tag:
+          type: string
+`
+	load := func(document string) APISet {
+		return loadOpenAPI3Test(t, "pets", document).APIs
+	}
+
+	from := load(openAPI3Spec)
+
+	if changes := CompareAPIs(from, load(openAPI3Spec)); len(changes) != 0 {
+		t.Error(`Unchanged spec fail`)
+	}
+
+	to := strings.Replace(openAPI3Spec, "enum: [available, sold]", "enum: [available]", 1)
+	to = strings.Replace(to, "        tag:\n          type: string\n", "", 1)
+	to = strings.Replace(to, "    delete:\n      operationId: deletePet", "    put:\n      operationId: updatePet", 1)
+
+	changes := CompareAPIs(from, load(to))
+	report := NewChangeReport("1", "2", changes)
+
+	expected := []string{
+		"DELETE /pets/{id} removed operation true",
+		"GET /pets removed enum true",
+		"GET /pets removed property true",
+		"PUT /pets/{id} added operation false",
+	}
+	if len(changes) != len(expected) || !report.Breaking {
+		t.Fatalf(`Changes fail: %v`, changes)
+	}
+	for i, change := range changes {
+		if got := fmt.Sprintf("%s %s %s %t", change.Operation, change.Kind, change.Element, change.Breaking); got != expected[i] {
+			t.Error(`Change fail: ` + got)
+		}
+	}
+
+	// A response property that is no longer required may be missing
+	required := load(strings.Replace(openAPI3Spec, "      type: object\n", "      type: object\n      required: [name]\n", 1))
+
+	changes = CompareAPIs(required, from)
+	if len(changes) != 1 || changes[0].Rule != "property-now-optional" || !changes[0].Breaking {
+		t.Errorf(`Now optional fail: %v`, changes)
+	}
+	changes = CompareAPIs(from, required)
+	if len(changes) != 1 || changes[0].Rule != "property-now-required" || changes[0].Breaking {
+		t.Errorf(`Now required fail: %v`, changes)
+	}
+}
+
+func TestLoadsOpenAPI3Versions(t *testing.T) {
+
+	const openAPI3Spec = `
+openapi: 3.0.0
+info:
+  title: Versioned
+  version: 2.0.0
+paths:
+  /v1/pets:
+    x-version: '1.0'
+    get:
+      operationId: listPets
+      responses:
+        '200':
+          description: The pets
+  /v2/pets:
+    x-version: '2.0'
+    get:
+      operationId: listPets
+      responses:
+        '200':
+          description: The pets
+    post:
+      operationId: addPet
+      x-version: '1.0'
+      responses:
+        '201':
+          description: Added
+`
+	specification := loadOpenAPI3Test(t, "pets", openAPI3Spec)
+
+	if versions := specification.Versions(); len(versions) != 2 || versions[0] != "1.0" || versions[1] != "2.0" {
+		t.Fatalf(`Versions fail: %v`, versions)
+	}
+	if len(specification.APIVersions["1.0"]) == 0 || len(specification.APIVersions["2.0"]) == 0 {
+		t.Fatal(`APIVersions fail`)
+	}
+
+	var v1, v2 int
+	for _, api := range specification.APIVersions["1.0"] {
+		v1 += len(api.Methods)
+	}
+	for _, api := range specification.APIVersions["2.0"] {
+		v2 += len(api.Methods)
+		if api.CurrentVersion != "2.0" {
+			t.Error(`CurrentVersion fail`)
+		}
+	}
+	if v1 != 2 || v2 != 1 {
+		t.Errorf(`Operation version fail: %d %d`, v1, v2)
+	}
+}
+
+func TestMergesSpecificationVersions(t *testing.T) {
+
+	const openAPI3Spec = `
+openapi: 3.0.0
+info:
+  title: Pets
+  version: 1.0.0
+tags:
+  - name: Pets
+paths:
+  /pets:
+    get:
+      tags: [Pets]
+      operationId: listPets
+      responses:
+        '200':
+          description: The pets
+          content:
+            application/json:
+              schema:
+                title: Pet
+                type: object
+`
+	load := func(version, document string) *APISpecification {
+		return loadOpenAPI3Into(t, &APISpecification{version: version}, document)
+	}
+
+	v2 := strings.Replace(openAPI3Spec, "operationId: listPets", "operationId: findPets", 1)
+	v2 = strings.Replace(v2, "title: Pets", "title: Pets Two", 1)
+
+	merged := mergeVersions("pets", map[string]*APISpecification{
+		"v1": load("v1", openAPI3Spec),
+		"v2": load("v2", v2),
+	}, "v1")
+
+	if merged.ID != "pets" || merged.APIInfo.Title != "Pets" || merged.CurrentVersion != "v1" {
+		t.Fatal(`Merge fail`)
+	}
+	if len(merged.APIs) != 1 || len(merged.APIs[0].Versions) != 2 || merged.APIs[0].Methods[0].ID != "list-pets" {
+		t.Fatal(`Merged API fail`)
+	}
+	if merged.APIs[0].Versions["v2"][0].ID != "find-pets" || len(merged.APIVersions) != 2 {
+		t.Error(`Merged versions fail`)
+	}
+	if len(merged.ResourceList["v1"]) != 1 || len(merged.ResourceList["v2"]) != 1 {
+		t.Error(`Merged resources fail`)
+	}
+}
+
+func TestOrdersVersions(t *testing.T) {
+
+	versions := []string{"latest", "v1.10", "1.9", "2.0.0-beta", "2.0.0", "v1.2.1", "draft"}
+	SortVersions(versions)
+
+	if strings.Join(versions, ",") != "draft,v1.2.1,1.9,v1.10,2.0.0-beta,2.0.0,latest" {
+		t.Fatal(`Sort fail ` + strings.Join(versions, ","))
+	}
+	if NewestFirst(versions)[0] != "latest" {
+		t.Error(`Newest first fail`)
+	}
+	if NearestVersion("1.5", []string{"1.0", "1.2", "2.0"}) != "1.2" || NearestVersion("0.1", []string{"1.0", "2.0"}) != "1.0" {
+		t.Error(`Nearest version fail`)
+	}
+}
+
+func TestLoadsVersionStatuses(t *testing.T) {
+
+	const openAPI3Spec = `
+openapi: 3.0.0
+info:
+  title: Pets
+  version: 1.0.0
+x-versions:
+  "1.0":
+    deprecated: true
+    sunset: 2000-01-31
+    description: Use version 2.0
+  "2.0":
+    sunset: not a date
+paths: {}
+`
+	specification := loadOpenAPI3Test(t, "pets", openAPI3Spec)
+
+	status := specification.VersionStatus("1.0")
+	if status == nil || !status.Deprecated || !status.Withdrawn() || !strings.Contains(status.Description, "Use version 2.0") {
+		t.Fatal(`Version status fail`)
+	}
+	if len(specification.Diagnostics) != 1 || specification.Diagnostics[0].Pointer != "/x-versions/2.0/sunset" {
+		t.Error(`Invalid sunset diagnostic fail`)
+	}
+	if specification.VersionStatus("3.0") != nil {
+		t.Error(`Missing version status fail`)
+	}
+}
+
+func TestLoadsDeprecations(t *testing.T) {
+
+	const openAPI3Spec = `
+openapi: 3.0.0
+info:
+  title: Pets
+  version: 1.0.0
+tags:
+  - name: Pets
+    x-sunset: 2000-01-31
+    x-replaced-by: /pets/reference/animals
+paths:
+  /pets:
+    get:
+      tags: [Pets]
+      operationId: listPets
+      deprecated: true
+      parameters:
+        - name: limit
+          in: query
+          deprecated: true
+          x-sunset: soon
+          schema:
+            type: integer
+      responses:
+        '200':
+          description: The pets
+          content:
+            application/json:
+              schema:
+                title: Pet
+                type: object
+                properties:
+                  name:
+                    type: string
+                    deprecated: true
+`
+	specification := loadOpenAPI3Test(t, "pets", openAPI3Spec)
+
+	api := specification.APIs[0]
+	if !api.Deprecated || !api.Withdrawn() || api.Replacement != "/pets/reference/animals" {
+		t.Fatal(`Tag deprecation fail`)
+	}
+	method := api.Methods[0]
+	if !method.Deprecated || !method.QueryParams[0].Deprecated {
+		t.Fatal(`Operation deprecation fail`)
+	}
+	if len(specification.Diagnostics) != 1 || specification.Diagnostics[0].Pointer != "/paths/~1pets/get/parameters/0/x-sunset" {
+		t.Error(`Invalid sunset diagnostic fail`)
+	}
+
+	report := specification.Deprecations()
+	if len(report.Deprecations) != 4 {
+		t.Fatalf(`Deprecations report fail %v`, report.Deprecations)
+	}
+	if d := report.Deprecations[3]; d.Element != "property" || !strings.HasSuffix(d.Name, ".name") {
+		t.Errorf(`Deprecated property fail %v`, d)
+	}
+}
+
+func TestLoadsSplitSpecification(t *testing.T) {
+
+	src := &fileSource{path: "../examples/specifications/petstore-split/openapi.yaml"}
+
+	specification := &APISpecification{}
+
+	err := specification.load(src)
+
+	if err != nil {
+		t.Fatal(`Failed to load spec` + err.Error())
+	}
+	if !specification.Bundled || len(specification.APIs) != 1 || len(specification.APIs[0].Methods) != 2 {
+		t.Fatal(`Split spec fail`)
+	}
+
+	for _, method := range specification.APIs[0].Methods {
+		switch method.ID {
+		case "list-pets":
+			if len(method.QueryParams) != 1 || method.QueryParams[0].Name != "limit" {
+				t.Error(`Parameter reference fail`)
+			}
+		case "show-pet-by-id":
+			pet := method.Responses[200].Resource
+			if pet == nil || pet.Properties["owner"] == nil || len(pet.Properties["owner"].Properties) != 1 {
+				t.Error(`Schema reference fail`)
+			}
+		}
+	}
+
+	data, err := src.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	document, _, err := bundle(src, data)
+	if err != nil {
+		t.Fatal(`Failed to bundle spec` + err.Error())
+	}
+	if !strings.Contains(string(document), `"$ref":"#/components/schemas/pet"`) {
+		t.Error(`Bundled schema fail`)
+	}
+}
+
+func TestConfinesReferences(t *testing.T) {
+
+	const split = "../examples/specifications/petstore-split"
+
+	path, _ := filepath.Abs(split + "/openapi.yaml")
+	dir, _ := filepath.Abs(split)
+	if err := (&APISpecification{}).load(&fileSource{path: path, dir: dir}); err != nil {
+		t.Error(`Reference within spec-dir fail: ` + err.Error())
+	}
+
+	dir, _ = filepath.Abs(split + "/paths")
+	err := (&APISpecification{}).load(&fileSource{path: path, dir: dir})
+	if err == nil || !strings.Contains(err.Error(), "outside of the spec-dir") {
+		t.Errorf(`Reference outside spec-dir fail: %v`, err)
+	}
+
+	local, _ := filepath.Abs(split + "/schemas/pet.yaml")
+	document := `
+openapi: 3.0.0
+info:
+  title: Remote
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      responses:
+        '200':
+          description: A pet
+          content:
+            application/json:
+              schema:
+                $ref: 'file://` + filepath.ToSlash(local) + `'
+`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(document))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/openapi.yaml")
+	src := &urlSource{location: u, remote: &remoteSpec{location: u.String()}}
+
+	err = (&APISpecification{}).load(src)
+	if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Errorf(`Local reference from remote spec fail: %v`, err)
+	}
+}
+
+func TestPreservesSchemaReferences(t *testing.T) {
+
+	const swagger2Spec = `
+swagger: "2.0"
+info:
+  title: Shop
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      summary: List pets
+      responses:
+        200:
+          description: The pets
+          schema:
+            type: array
+            items:
+              $ref: '#/definitions/Pet'
+definitions:
+  Pet:
+    type: object
+    properties:
+      name:
+        type: string
+      category:
+        $ref: '#/definitions/Category'
+  Category:
+    type: object
+    properties:
+      name:
+        type: string
+      parent:
+        $ref: '#/definitions/Category'
+`
+	const openAPI3Spec = `
+openapi: 3.0.0
+info:
+  title: Shop
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      summary: List pets
+      responses:
+        '200':
+          description: The pets
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: '#/components/schemas/Pet'
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        name:
+          type: string
+        category:
+          $ref: '#/components/schemas/Category'
+    Category:
+      type: object
+      properties:
+        name:
+          type: string
+        parent:
+          $ref: '#/components/schemas/Category'
+`
+	for _, document := range []string{swagger2Spec, openAPI3Spec} {
+		specification := &APISpecification{}
+
+		err := specification.loadData(&fileSource{path: "shop.yaml"}, []byte(document))
+		if err != nil {
+			t.Fatal(`Failed to load spec` + err.Error())
+		}
+
+		pet := specification.ResourceList["latest"]["pet"]
+		if pet == nil || pet.Component != "Pet" || pet.Properties["category"] == nil {
+			t.Fatal(`Resource ID fail`)
+		}
+		if link := pet.Properties["category"].Link(); link != "/shop/resources/category?v=latest" {
+			t.Error(`Resource link fail ` + link)
+		}
+
+		category := specification.ResourceList["latest"]["category"]
+		if category == nil || category.Methods["list-pets"] == nil || category.Properties["parent"] == nil {
+			t.Fatal(`Linked resource fail`)
+		}
+		if len(category.Properties["parent"].Properties) != 0 || category.Properties["parent"].Link() == "" {
+			t.Error(`Recursive resource fail`)
+		}
+	}
+}
+
+func TestExcludesComponentPropertiesFromTheirOperations(t *testing.T) {
+
+	const document = `
+openapi: 3.0.0
+info:
+  title: Shop
+  version: 1.0.0
+paths:
+  /pets:
+    post:
+      summary: Create a pet
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        '201':
+          description: Created
+  /pets/{id}:
+    put:
+      summary: Update a pet
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        '200':
+          description: Updated
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        name:
+          type: string
+        owner:
+          $ref: '#/components/schemas/Owner'
+    Owner:
+      type: object
+      properties:
+        id:
+          type: string
+          x-excludeFromOperations: [post]
+        name:
+          type: string
+`
+	specification := &APISpecification{}
+
+	err := specification.loadData(&fileSource{path: "shop.yaml"}, []byte(document))
+	if err != nil {
+		t.Fatal(`Failed to load spec` + err.Error())
+	}
+
+	posted := specification.components["latest/request/post/Owner"]
+	put := specification.components["latest/request/put/Owner"]
+	if posted == nil || put == nil {
+		t.Fatalf(`Component fail: %v`, specification.components)
+	}
+	if posted.Properties["id"] != nil || posted.Properties["name"] == nil {
+		t.Error(`Excluded property fail`)
+	}
+	if put.Properties["id"] == nil || put.Properties["name"] == nil {
+		t.Error(`Included property fail`)
+	}
+}
+
+func TestLoadsConstraints(t *testing.T) {
+
+	const swagger2Spec = `
+swagger: "2.0"
+info:
+  title: Shop
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      summary: List pets
+      parameters:
+        - name: limit
+          in: query
+          type: integer
+          minimum: 1
+          maximum: 100
+          default: 20
+        - name: tags
+          in: query
+          type: array
+          collectionFormat: csv
+          maxItems: 5
+          items:
+            type: string
+            pattern: '^[a-z]+$'
+      responses:
+        200:
+          description: The pets
+          schema:
+            $ref: '#/definitions/Pet'
+definitions:
+  Pet:
+    type: object
+    additionalProperties: false
+    properties:
+      name:
+        type: string
+        minLength: 1
+        maxLength: 50
+        x-nullable: true
+      weight:
+        type: number
+        minimum: 0
+        exclusiveMinimum: true
+        multipleOf: 0.5
+`
+	const openAPI3Spec = `
+openapi: 3.0.0
+info:
+  title: Shop
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      summary: List pets
+      parameters:
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            minimum: 1
+            maximum: 100
+            default: 20
+        - name: tags
+          in: query
+          schema:
+            type: array
+            maxItems: 5
+            items:
+              type: string
+              pattern: '^[a-z]+$'
+      responses:
+        '200':
+          description: The pets
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+components:
+  schemas:
+    Pet:
+      type: object
+      additionalProperties: false
+      properties:
+        name:
+          type: string
+          minLength: 1
+          maxLength: 50
+          nullable: true
+        weight:
+          type: number
+          minimum: 0
+          exclusiveMinimum: true
+          multipleOf: 0.5
+`
+	for _, document := range []string{swagger2Spec, openAPI3Spec} {
+		specification := &APISpecification{}
+
+		err := specification.loadData(&fileSource{path: "shop.yaml"}, []byte(document))
+		if err != nil {
+			t.Fatal(`Failed to load spec` + err.Error())
+		}
+
+		method := specification.APIs[0].Methods[0]
+		if len(method.QueryParams) != 2 {
+			t.Fatal(`Parameters fail`)
+		}
+		limit, tags := method.QueryParams[0], method.QueryParams[1]
+		if limit.Minimum != "1" || limit.Maximum != "100" || limit.Default != "20" {
+			t.Error(`Parameter constraints fail`)
+		}
+		if tags.MaxItems != "5" || tags.Pattern != "^[a-z]+$" {
+			t.Error(`Array parameter constraints fail`)
+		}
+
+		pet := specification.ResourceList["latest"]["pet"]
+		if pet == nil || pet.AdditionalProperties != "none" {
+			t.Fatal(`Resource constraints fail`)
+		}
+		if name := pet.Properties["name"]; name.MinLength != "1" || name.MaxLength != "50" || !name.Nullable {
+			t.Error(`String constraints fail`)
+		}
+		if weight := pet.Properties["weight"]; weight.Minimum != "0" || !weight.ExclusiveMinimum || weight.MultipleOf != "0.5" {
+			t.Error(`Number constraints fail`)
+		}
+	}
+}
+
+func TestGeneratesExamples(t *testing.T) {
+
+	const swagger2Spec = `
+swagger: "2.0"
+info:
+  title: Shop
+  version: 1.0.0
+paths:
+  /orders:
+    get:
+      summary: List orders
+      parameters:
+        - name: since
+          in: query
+          type: string
+          format: date-time
+        - name: limit
+          in: query
+          type: integer
+          minimum: 5
+          x-example: 10
+      responses:
+        200:
+          description: The order
+          schema:
+            $ref: '#/definitions/Order'
+          examples:
+            application/json:
+              id: abc
+definitions:
+  Order:
+    type: object
+    properties:
+      id:
+        type: string
+        format: uuid
+      status:
+        type: string
+        enum: [placed, paid]
+      count:
+        type: integer
+        default: 3
+      note:
+        type: string
+        example: Leave at door
+      tags:
+        type: array
+        items:
+          type: string
+          format: email
+`
+	const openAPI3Spec = `
+openapi: 3.0.0
+info:
+  title: Shop
+  version: 1.0.0
+paths:
+  /orders:
+    get:
+      summary: List orders
+      parameters:
+        - name: since
+          in: query
+          schema:
+            type: string
+            format: date-time
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            minimum: 5
+          example: 10
+      responses:
+        '200':
+          description: The order
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Order'
+              examples:
+                paid:
+                  summary: A paid order
+                  value:
+                    id: abc
+components:
+  schemas:
+    Order:
+      type: object
+      properties:
+        id:
+          type: string
+          format: uuid
+        status:
+          type: string
+          enum: [placed, paid]
+        count:
+          type: integer
+          default: 3
+        note:
+          type: string
+          example: Leave at door
+        tags:
+          type: array
+          items:
+            type: string
+            format: email
+`
+	for _, document := range []string{swagger2Spec, openAPI3Spec} {
+		specification := &APISpecification{}
+
+		err := specification.loadData(&fileSource{path: "shop.yaml"}, []byte(document))
+		if err != nil {
+			t.Fatal(`Failed to load spec` + err.Error())
+		}
+
+		method := specification.APIs[0].Methods[0]
+		if len(method.QueryParams) != 2 {
+			t.Fatal(`Parameters fail`)
+		}
+		if since := method.QueryParams[0]; since.Example != "2017-07-21T17:32:28Z" {
+			t.Errorf(`Format example fail: %s`, since.Example)
+		}
+		if limit := method.QueryParams[1]; limit.Example != "10" {
+			t.Errorf(`Explicit parameter example fail: %s`, limit.Example)
+		}
+
+		order := specification.ResourceList["latest"]["order"]
+		if order == nil {
+			t.Fatal(`Resource fail`)
+		}
+		var example map[string]interface{}
+		if err := json.Unmarshal([]byte(order.Schema), &example); err != nil {
+			t.Fatal(`Resource example fail: ` + err.Error())
+		}
+		expected := map[string]interface{}{
+			"id":     "3fa85f64-5717-4562-b3fc-2c963f66afa6",
+			"status": "placed",
+			"count":  float64(3),
+			"note":   "Leave at door",
+			"tags":   []interface{}{"user@example.com"},
+		}
+		if !reflect.DeepEqual(example, expected) {
+			t.Errorf(`Resource example fail: %s`, order.Schema)
+		}
+
+		response := method.Responses[200]
+		examples := response.Examples
+		if len(response.MediaTypes) > 0 {
+			examples = response.MediaTypes[0].Examples
+		}
+		if len(examples) != 1 || !strings.Contains(examples[0].Value, `"abc"`) {
+			t.Error(`Named examples fail`)
+		}
+	}
+}
+
+func TestGeneratesCodeSamples(t *testing.T) {
+
+	const openAPI3Spec = `
+openapi: 3.0.0
+info:
+  title: Shop
+  version: 1.0.0
+security:
+  - key: []
+paths:
+  /orders/{id}:
+    put:
+      summary: Update order
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+            minimum: 1
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+              properties:
+                note:
+                  type: string
+                  example: Leave at door
+      responses:
+        '204':
+          description: Updated
+      x-codeSamples:
+        - lang: Python
+          source: shop.update_order(1, note="Leave at door")
+        - lang: Ruby
+          label: Ruby client
+          source: shop.update_order(1)
+components:
+  securitySchemes:
+    key:
+      type: apiKey
+      in: header
+      name: X-API-Key
+`
+	specification := &APISpecification{}
+
+	err := specification.loadData(&fileSource{path: "shop.yaml"}, []byte(openAPI3Spec))
+	if err != nil {
+		t.Fatal(`Failed to load spec` + err.Error())
+	}
+
+	samples := specification.APIs[0].Methods[0].CodeSamples
+	var langs []string
+	for _, sample := range samples {
+		langs = append(langs, sample.Lang)
+	}
+	if strings.Join(langs, ",") != "curl,go,python,javascript,java,ruby" {
+		t.Fatalf(`Code sample languages fail: %s`, langs)
+	}
+
+	curl := samples[0].Source
+	for _, expected := range []string{"curl -X PUT 'http://localhost/orders/1'", "-H 'X-API-Key: API_KEY'", `"note": "Leave at door"`} {
+		if !strings.Contains(curl, expected) {
+			t.Errorf(`curl sample fail, expected %s in %s`, expected, curl)
+		}
+	}
+	if _, err := format.Source([]byte(samples[1].Source)); err != nil {
+		t.Errorf(`Go sample fail: %s`, err)
+	}
+	if samples[2].Source != `shop.update_order(1, note="Leave at door")` || samples[2].Label != "Python" {
+		t.Error(`Supplied code sample fail`)
+	}
+	if samples[5].Label != "Ruby client" {
+		t.Error(`Added code sample fail`)
+	}
+}
+
+func TestMatchesAndValidatesRequests(t *testing.T) {
+
+	const openAPI3Spec = `
+openapi: 3.0.0
+info:
+  title: Shop
+  version: 1.0.0
+servers:
+  - url: https://{env}.example.com/v1
+    variables:
+      env:
+        default: api
+paths:
+  /orders/mine:
+    get:
+      summary: My orders
+      responses:
+        '200':
+          description: Orders
+  /orders/{id}:
+    get:
+      summary: Get order
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+            minimum: 1
+        - name: fields
+          in: query
+          style: form
+          explode: false
+          schema:
+            type: array
+            maxItems: 2
+            items:
+              type: string
+              enum: [id, note]
+        - name: X-Request-Id
+          in: header
+          required: true
+          schema:
+            type: string
+            format: uuid
+      responses:
+        '200':
+          description: An order
+          headers:
+            X-Rate-Limit:
+              schema:
+                type: integer
+                example: 100
+`
+	specification := &APISpecification{}
+
+	err := specification.loadData(&fileSource{path: "shop.yaml"}, []byte(openAPI3Spec))
+	if err != nil {
+		t.Fatal(`Failed to load spec` + err.Error())
+	}
+
+	if u := specification.APIs[0].URL.String(); u != "https://api.example.com/v1" {
+		t.Errorf(`Server URL fail: %s`, u)
+	}
+
+	method, params := specification.FindMethod("GET", "/orders/mine")
+	if method == nil || method.Name != "My orders" || len(params) != 0 {
+		t.Fatal(`Literal path match fail`)
+	}
+	method, params = specification.FindMethod("GET", "/orders/12")
+	if method == nil || method.Name != "Get order" || params["id"] != "12" {
+		t.Fatal(`Templated path match fail`)
+	}
+	if m, _ := specification.FindMethod("DELETE", "/orders/12"); m != nil {
+		t.Error(`Method match fail`)
+	}
+	if allowed := specification.AllowedMethods("/orders/12"); !reflect.DeepEqual(allowed, []string{"GET"}) {
+		t.Errorf(`Allowed methods fail: %s`, allowed)
+	}
+	if method.Responses[200].Headers[0].Example != "100" {
+		t.Error(`Header example fail`)
+	}
+
+	req := httptest.NewRequest("GET", "/orders/12?fields=id,note", nil)
+	req.Header.Set("X-Request-Id", "3fa85f64-5717-4562-b3fc-2c963f66afa6")
+	if problems := method.ValidateRequest(req, params); len(problems) != 0 {
+		t.Errorf(`Valid request fail: %s`, problems)
+	}
+
+	req = httptest.NewRequest("GET", "/orders/0?fields=id,note,total", nil)
+	problems := method.ValidateRequest(req, map[string]string{"id": "0"})
+	expected := []string{
+		`path parameter "id": 0 is less than the minimum 1`,
+		`query parameter "fields": has 3 items, more than the maximum 2`,
+		`query parameter "fields": "total" is not one of id, note`,
+		`header parameter "X-Request-Id": is required`,
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf(`Invalid request fail: %q`, problems)
+	}
+}
+
+func TestValidatesBodies(t *testing.T) {
+
+	const swagger2Spec = `
+swagger: '2.0'
+info:
+  title: Shop
+  version: 1.0.0
+paths:
+  /orders:
+    post:
+      summary: Place order
+      consumes:
+        - application/json
+      parameters:
+        - name: order
+          in: body
+          required: true
+          schema:
+            $ref: '#/definitions/Order'
+      responses:
+        '201':
+          description: Placed
+          headers:
+            Location:
+              type: string
+              x-required: true
+          schema:
+            $ref: '#/definitions/Order'
+definitions:
+  Order:
+    type: object
+    required: [id, lines]
+    properties:
+      id:
+        type: integer
+        format: int64
+        readOnly: true
+      lines:
+        type: array
+        minItems: 1
+        items:
+          $ref: '#/definitions/Line'
+  Line:
+    type: object
+    required: [quantity]
+    additionalProperties: false
+    properties:
+      quantity:
+        type: integer
+        minimum: 1
+      sku:
+        type: string
+        pattern: '^[A-Z]+$'
+`
+	specification := &APISpecification{}
+
+	err := specification.loadData(&fileSource{path: "shop.yaml"}, []byte(swagger2Spec))
+	if err != nil {
+		t.Fatal(`Failed to load spec` + err.Error())
+	}
+	method, _ := specification.FindMethod("POST", "/orders")
+	if method == nil {
+		t.Fatal(`Method match fail`)
+	}
+
+	req := httptest.NewRequest("POST", "/orders", strings.NewReader(`{"lines": [{"quantity": 2, "sku": "ABC"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	if problems := method.ValidateRequest(req, nil); len(problems) != 0 {
+		t.Errorf(`Valid request body fail: %s`, problems)
+	}
+
+	req = httptest.NewRequest("POST", "/orders", strings.NewReader(`{"id": 1, "lines": [{"quantity": 0, "sku": "abc", "colour": "red"}, {"quantity": 1.5}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	problems := method.ValidateRequest(req, nil)
+	expected := []string{
+		`request body at /id: is read only, so is not to be given`,
+		`request body at /lines/0/colour: is not a documented property`,
+		`request body at /lines/0/quantity: 0 is less than the minimum 1`,
+		`request body at /lines/0/sku: "abc" does not match the pattern ^[A-Z]+$`,
+		`request body at /lines/1/quantity: is a number, rather than integer`,
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf(`Invalid request body fail: %q`, problems)
+	}
+	if body, _ := ioutil.ReadAll(req.Body); len(body) == 0 {
+		t.Error(`Request body not restored`)
+	}
+
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	if problems := method.ValidateResponse(201, header, []byte(`{"id": 1, "lines": [{"quantity": 1}]}`)); len(problems) != 0 {
+		t.Errorf(`Valid response fail: %s`, problems)
+	}
+	problems = method.ValidateResponse(201, header, []byte(`{"lines": []}`))
+	expected = []string{`response body at /id: is required`, `response body at /lines: has 0 items, fewer than the minimum 1`}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf(`Invalid response fail: %q`, problems)
+	}
+	if problems := method.ValidateResponse(500, header, nil); !reflect.DeepEqual(problems, []string{`response status 500 is not documented`}) {
+		t.Errorf(`Undocumented status fail: %q`, problems)
+	}
 }
@@ -0,0 +1,445 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-openapi/spec"
+)
+
+// Bodies are checked against the schemas that document them. The resources built from a
+// schema do not keep all that it says about its values, so the schema is kept as it was
+// written, decoded from JSON, which is the same for Swagger 2 and OpenAPI 3. Each $ref is to
+// a named schema of the specification, which are decoded in the same way.
+
+// bodySchema is the schema of a request or response body
+type bodySchema struct {
+	value interface{}
+	named map[string]interface{} // The named schemas of the specification, by $ref
+}
+
+// The depth of $refs followed before giving up, in case a schema refers only to itself
+const maxSchemaDepth = 64
+
+// -----------------------------------------------------------------------------
+
+// decodeSchema decodes a Swagger 2 or OpenAPI 3 schema, as it would be written in JSON.
+func decodeSchema(s interface{}) interface{} {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(b, &value); err != nil {
+		return nil
+	}
+	return value
+}
+
+// namedSchemas2 decodes the definitions of a Swagger 2 specification, keyed by the $ref that
+// refers to each.
+func namedSchemas2(definitions spec.Definitions) map[string]interface{} {
+	named := make(map[string]interface{}, len(definitions))
+	for name, definition := range definitions {
+		named["#"+jsonPointer("definitions", name)] = decodeSchema(definition)
+	}
+	return named
+}
+
+// namedSchemas3 decodes the component schemas of an OpenAPI 3 specification, keyed by the
+// $ref that refers to each.
+func namedSchemas3(schemas map[string]*openapi3.SchemaRef) map[string]interface{} {
+	named := make(map[string]interface{}, len(schemas))
+	for name, schema := range schemas {
+		if schema != nil && schema.Value != nil {
+			named["#"+jsonPointer("components", "schemas", name)] = decodeSchema(schema.Value)
+		}
+	}
+	return named
+}
+
+// bodySchema2 keeps the schema of a Swagger 2 body, which must be decoded before a resource is
+// built from it, as building the resource alters it.
+func (c *APISpecification) bodySchema2(s *spec.Schema) *bodySchema {
+	if s == nil {
+		return nil
+	}
+	return &bodySchema{value: decodeSchema(s), named: c.namedSchemas}
+}
+
+// bodySchema3 keeps the schema of an OpenAPI 3 body.
+func (c *APISpecification) bodySchema3(s *openapi3.SchemaRef) *bodySchema {
+	if s == nil || s.Value == nil {
+		return nil
+	}
+	return &bodySchema{value: decodeSchema(s), named: c.namedSchemas}
+}
+
+// -----------------------------------------------------------------------------
+
+// check checks a body, decoded from JSON, against the schema, describing each problem found
+// with the JSON pointer of the value at fault. A request must not give a readOnly property,
+// and a response a writeOnly one.
+func (b *bodySchema) check(body interface{}, isRequest bool) []string {
+	return b.checkValue(b.value, body, "", isRequest, 0)
+}
+
+func (b *bodySchema) checkValue(schema interface{}, value interface{}, pointer string, isRequest bool, depth int) []string {
+	s, ok := schema.(map[string]interface{})
+	if !ok || depth > maxSchemaDepth {
+		return nil
+	}
+	if ref, ok := s["$ref"].(string); ok {
+		return b.checkValue(b.named[ref], value, pointer, isRequest, depth+1)
+	}
+
+	problem := func(format string, args ...interface{}) []string {
+		return []string{atPointer(pointer, fmt.Sprintf(format, args...))}
+	}
+
+	if isRequest && s["readOnly"] == true {
+		return problem("is read only, so is not to be given")
+	}
+	if !isRequest && s["writeOnly"] == true {
+		return problem("is write only, so is not to be returned")
+	}
+
+	if value == nil {
+		if s["nullable"] == true || s["x-nullable"] == true || !hasType(s) || schemaTypes(s)["null"] {
+			return nil
+		}
+		return problem("is null")
+	}
+
+	var problems []string
+	for _, sub := range schemaList(s["allOf"]) {
+		problems = append(problems, b.checkValue(sub, value, pointer, isRequest, depth+1)...)
+	}
+	if oneOf := schemaList(s["oneOf"]); len(oneOf) > 0 {
+		if matched := b.countMatches(oneOf, value, pointer, isRequest, depth); matched != 1 {
+			problems = append(problems, problem("matches %d of the oneOf schemas, rather than one", matched)...)
+		}
+	}
+	if anyOf := schemaList(s["anyOf"]); len(anyOf) > 0 && b.countMatches(anyOf, value, pointer, isRequest, depth) == 0 {
+		problems = append(problems, problem("matches none of the anyOf schemas")...)
+	}
+	if not, ok := s["not"]; ok && len(b.checkValue(not, value, pointer, isRequest, depth+1)) == 0 {
+		problems = append(problems, problem("matches a schema that it must not")...)
+	}
+
+	if hasType(s) {
+		types := schemaTypes(s)
+		if t := jsonType(value); !types[t] && !(t == "integer" && types["number"]) {
+			names := make([]string, 0, len(types))
+			for name := range types {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return append(problems, problem("is %s %s, rather than %s", article(t), t, strings.Join(names, " or "))...)
+		}
+	}
+
+	if enum, ok := s["enum"].([]interface{}); ok && len(enum) > 0 && !enumHas(enum, value) {
+		problems = append(problems, problem("%s is not one of the enumerated values", jsonString(value))...)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		problems = append(problems, b.checkObject(s, v, pointer, isRequest, depth)...)
+	case []interface{}:
+		problems = append(problems, b.checkArray(s, v, pointer, isRequest, depth)...)
+	case float64:
+		problems = append(problems, checkSchemaNumber(s, v, pointer)...)
+	case string:
+		problems = append(problems, checkSchemaString(s, v, pointer)...)
+	}
+	return problems
+}
+
+// countMatches counts the schemas that a value matches.
+func (b *bodySchema) countMatches(schemas []interface{}, value interface{}, pointer string, isRequest bool, depth int) int {
+	matched := 0
+	for _, sub := range schemas {
+		if len(b.checkValue(sub, value, pointer, isRequest, depth+1)) == 0 {
+			matched++
+		}
+	}
+	return matched
+}
+
+func (b *bodySchema) checkObject(s map[string]interface{}, object map[string]interface{}, pointer string, isRequest bool, depth int) []string {
+	var problems []string
+	properties, _ := s["properties"].(map[string]interface{})
+
+	for _, name := range schemaStrings(s["required"]) {
+		if _, ok := object[name]; !ok {
+			// A readOnly property is only required of responses, and a writeOnly one of requests
+			if property := b.resolve(properties[name], depth); !(isRequest && property["readOnly"] == true) && !(!isRequest && property["writeOnly"] == true) {
+				problems = append(problems, atPointer(pointer+"/"+escapePointer(name), "is required"))
+			}
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		at := pointer + "/" + escapePointer(name)
+		if property, ok := properties[name]; ok {
+			problems = append(problems, b.checkValue(property, object[name], at, isRequest, depth+1)...)
+			continue
+		}
+		switch additional := s["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				problems = append(problems, atPointer(at, "is not a documented property"))
+			}
+		case map[string]interface{}:
+			problems = append(problems, b.checkValue(additional, object[name], at, isRequest, depth+1)...)
+		}
+	}
+	return problems
+}
+
+func (b *bodySchema) checkArray(s map[string]interface{}, array []interface{}, pointer string, isRequest bool, depth int) []string {
+	var problems []string
+	if min, ok := s["minItems"].(float64); ok && float64(len(array)) < min {
+		problems = append(problems, atPointer(pointer, fmt.Sprintf("has %d items, fewer than the minimum %v", len(array), min)))
+	}
+	if max, ok := s["maxItems"].(float64); ok && float64(len(array)) > max {
+		problems = append(problems, atPointer(pointer, fmt.Sprintf("has %d items, more than the maximum %v", len(array), max)))
+	}
+	if s["uniqueItems"] == true {
+		seen := make(map[string]bool)
+		for _, item := range array {
+			key := jsonString(item)
+			if seen[key] {
+				problems = append(problems, atPointer(pointer, fmt.Sprintf("has %s more than once, but its items are to be unique", key)))
+				break
+			}
+			seen[key] = true
+		}
+	}
+	if items, ok := s["items"]; ok {
+		for i, item := range array {
+			problems = append(problems, b.checkValue(items, item, fmt.Sprintf("%s/%d", pointer, i), isRequest, depth+1)...)
+		}
+	}
+	return problems
+}
+
+// resolve follows the $refs of a schema, returning nil if it is not a schema.
+func (b *bodySchema) resolve(schema interface{}, depth int) map[string]interface{} {
+	for ; depth <= maxSchemaDepth; depth++ {
+		s, ok := schema.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		ref, ok := s["$ref"].(string)
+		if !ok {
+			return s
+		}
+		schema = b.named[ref]
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+func checkSchemaNumber(s map[string]interface{}, n float64, pointer string) []string {
+	value := jsonString(n)
+	var problems []string
+
+	// Exclusive bounds are booleans in Swagger 2 and OpenAPI 3.0, and numbers in later drafts
+	if min, ok := s["minimum"].(float64); ok {
+		if s["exclusiveMinimum"] == true && n <= min {
+			problems = append(problems, atPointer(pointer, fmt.Sprintf("%s is not greater than the exclusive minimum %v", value, min)))
+		} else if n < min {
+			problems = append(problems, atPointer(pointer, fmt.Sprintf("%s is less than the minimum %v", value, min)))
+		}
+	}
+	if min, ok := s["exclusiveMinimum"].(float64); ok && n <= min {
+		problems = append(problems, atPointer(pointer, fmt.Sprintf("%s is not greater than the exclusive minimum %v", value, min)))
+	}
+	if max, ok := s["maximum"].(float64); ok {
+		if s["exclusiveMaximum"] == true && n >= max {
+			problems = append(problems, atPointer(pointer, fmt.Sprintf("%s is not less than the exclusive maximum %v", value, max)))
+		} else if n > max {
+			problems = append(problems, atPointer(pointer, fmt.Sprintf("%s is greater than the maximum %v", value, max)))
+		}
+	}
+	if max, ok := s["exclusiveMaximum"].(float64); ok && n >= max {
+		problems = append(problems, atPointer(pointer, fmt.Sprintf("%s is not less than the exclusive maximum %v", value, max)))
+	}
+	if multipleOf, ok := s["multipleOf"].(float64); ok && multipleOf > 0 {
+		if q := n / multipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+			problems = append(problems, atPointer(pointer, fmt.Sprintf("%s is not a multiple of %v", value, multipleOf)))
+		}
+	}
+	return problems
+}
+
+func checkSchemaString(s map[string]interface{}, value string, pointer string) []string {
+	var problems []string
+
+	length := utf8.RuneCountInString(value)
+	if min, ok := s["minLength"].(float64); ok && float64(length) < min {
+		problems = append(problems, atPointer(pointer, fmt.Sprintf("%q is shorter than the minimum length %v", value, min)))
+	}
+	if max, ok := s["maxLength"].(float64); ok && float64(length) > max {
+		problems = append(problems, atPointer(pointer, fmt.Sprintf("%q is longer than the maximum length %v", value, max)))
+	}
+	if pattern, ok := s["pattern"].(string); ok && pattern != "" {
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(value) {
+			problems = append(problems, atPointer(pointer, fmt.Sprintf("%q does not match the pattern %s", value, pattern)))
+		}
+	}
+	if format, ok := s["format"].(string); ok {
+		if message := formatProblem(value, format); message != "" {
+			problems = append(problems, atPointer(pointer, message))
+		}
+	}
+	return problems
+}
+
+// formatProblem checks a string against the formats that can be checked, returning "" if it
+// is valid, or what is wrong with it.
+func formatProblem(value string, format string) string {
+	switch format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return fmt.Sprintf("%q is not an RFC 3339 date-time", value)
+		}
+	case "date":
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return fmt.Sprintf("%q is not an RFC 3339 date", value)
+		}
+	case "uuid":
+		if !uuidPattern.MatchString(value) {
+			return fmt.Sprintf("%q is not a UUID", value)
+		}
+	}
+	return ""
+}
+
+// -----------------------------------------------------------------------------
+
+func hasType(s map[string]interface{}) bool {
+	_, ok := s["type"]
+	return ok
+}
+
+// schemaTypes gives the types that a schema allows, which Swagger 2 may give as a list
+func schemaTypes(s map[string]interface{}) map[string]bool {
+	types := make(map[string]bool)
+	switch t := s["type"].(type) {
+	case string:
+		types[t] = true
+	case []interface{}:
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				types[name] = true
+			}
+		}
+	}
+	return types
+}
+
+// jsonType gives the JSON schema type of a value decoded from JSON
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func article(t string) string {
+	if strings.IndexAny(t[:1], "aeiou") == 0 {
+		return "an"
+	}
+	return "a"
+}
+
+func schemaList(v interface{}) []interface{} {
+	list, _ := v.([]interface{})
+	return list
+}
+
+func schemaStrings(v interface{}) []string {
+	var strs []string
+	for _, s := range schemaList(v) {
+		if s, ok := s.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+func enumHas(enum []interface{}, value interface{}) bool {
+	v := jsonString(value)
+	for _, e := range enum {
+		if jsonString(e) == v {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// escapePointer escapes a property name as a JSON pointer token
+func escapePointer(name string) string {
+	return strings.Replace(strings.Replace(name, "~", "~0", -1), "/", "~1", -1)
+}
+
+// atPointer describes a problem with the value at a JSON pointer within a body
+func atPointer(pointer string, message string) string {
+	if pointer == "" {
+		return message
+	}
+	return "at " + pointer + ": " + message
+}
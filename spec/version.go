@@ -0,0 +1,482 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+package spec
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/UKHomeOffice/dapperdox/logger"
+	"github.com/shurcooL/github_flavored_markdown"
+)
+
+// LatestVersion is the version of methods and resources that do not declare an x-version
+const LatestVersion = "latest"
+
+// -----------------------------------------------------------------------------
+
+// SortVersions orders versions from oldest to newest, with "latest" always the newest.
+// Versions are compared as semantic versions, so 1.10 is newer than 1.9.
+func SortVersions(versions []string) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return CompareVersions(versions[i], versions[j]) < 0
+	})
+}
+
+// NewestFirst returns a copy of versions ordered from newest to oldest, with "latest" first.
+func NewestFirst(versions []string) []string {
+	sorted := make([]string, len(versions))
+	copy(sorted, versions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return CompareVersions(sorted[i], sorted[j]) > 0
+	})
+	return sorted
+}
+
+// -----------------------------------------------------------------------------
+
+// CompareVersions returns -1, 0 or 1 as version a is older than, the same as, or newer than
+// version b. Versions are compared as semantic versions, with an optional leading v, such as
+// v1, 1.2 or 2.0.0-beta.1. A pre-release is older than its release. Versions that are not
+// semantic versions are compared as strings, and are older than those that are. "latest" is
+// newer than every other version.
+func CompareVersions(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == LatestVersion:
+		return 1
+	case b == LatestVersion:
+		return -1
+	}
+
+	va, aok := parseVersion(a)
+	vb, bok := parseVersion(b)
+
+	switch {
+	case !aok && !bok:
+		return strings.Compare(a, b)
+	case !aok:
+		return -1
+	case !bok:
+		return 1
+	}
+
+	for i := 0; i < len(va.numbers) || i < len(vb.numbers); i++ {
+		var na, nb int
+		if i < len(va.numbers) {
+			na = va.numbers[i]
+		}
+		if i < len(vb.numbers) {
+			nb = vb.numbers[i]
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case va.prerelease == vb.prerelease:
+		return strings.Compare(a, b)
+	case va.prerelease == "":
+		return 1
+	case vb.prerelease == "":
+		return -1
+	}
+	return strings.Compare(va.prerelease, vb.prerelease)
+}
+
+type semanticVersion struct {
+	numbers    []int
+	prerelease string
+}
+
+func parseVersion(version string) (semanticVersion, bool) {
+	var v semanticVersion
+
+	version = strings.TrimPrefix(strings.TrimPrefix(version, "v"), "V")
+	if i := strings.IndexAny(version, "-+"); i != -1 {
+		if version[i] == '-' {
+			v.prerelease = version[i+1:]
+		}
+		version = version[:i]
+	}
+
+	for _, part := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.numbers = append(v.numbers, n)
+	}
+	return v, true
+}
+
+// -----------------------------------------------------------------------------
+
+// NearestVersion returns the version, of those available, to use in place of one that is not:
+// the newest version older than it, or failing that, the oldest version newer than it.
+func NearestVersion(version string, available []string) string {
+	var older, newer string
+
+	for _, v := range available {
+		if CompareVersions(v, version) < 0 {
+			if older == "" || CompareVersions(v, older) > 0 {
+				older = v
+			}
+		} else if newer == "" || CompareVersions(v, newer) < 0 {
+			newer = v
+		}
+	}
+
+	if older != "" {
+		return older
+	}
+	return newer
+}
+
+// -----------------------------------------------------------------------------
+
+// VersionStatus describes the deprecation of a version of a specification, as given by the
+// x-versions extension of the specification document
+type VersionStatus struct {
+	Deprecated  bool
+	Sunset      time.Time // When the version is, or was, withdrawn
+	Description string    // Markdown, such as the version to move to
+}
+
+// Withdrawn reports whether the sunset of the version has passed.
+func (s *VersionStatus) Withdrawn() bool {
+	return !s.Sunset.IsZero() && time.Now().After(s.Sunset)
+}
+
+// VersionStatus returns the deprecation of a version, or nil if the version is not deprecated
+// and has no sunset.
+func (c *APISpecification) VersionStatus(version string) *VersionStatus {
+	return c.VersionStatuses[version]
+}
+
+// getVersionStatuses reads the x-versions extension of a specification document, which maps
+// each version on to its deprecation:
+//
+//	x-versions:
+//	  "1.0":
+//	    deprecated: true
+//	    sunset: 2019-06-30
+//	    description: Use version 2.0
+func (c *APISpecification) getVersionStatuses(extensions map[string]interface{}) {
+	var versions map[string]struct {
+		Deprecated  bool   `json:"deprecated"`
+		Sunset      string `json:"sunset"`
+		Description string `json:"description"`
+	}
+	if !getExtension(extensions, "x-versions", &versions) {
+		return
+	}
+
+	for version, v := range versions {
+		status := &VersionStatus{
+			Deprecated:  v.Deprecated,
+			Description: string(github_flavored_markdown.Markdown([]byte(v.Description))),
+		}
+		if v.Sunset != "" {
+			sunset, err := parseDate(v.Sunset)
+			if err != nil {
+				c.warnf(jsonPointer("x-versions", version, "sunset"), "Invalid sunset date %s", v.Sunset)
+			}
+			status.Sunset = sunset
+		}
+		if c.VersionStatuses == nil {
+			c.VersionStatuses = make(map[string]*VersionStatus)
+		}
+		c.VersionStatuses[version] = status
+	}
+}
+
+// parseDate parses a date, or a date and time, as RFC 3339 gives them.
+func parseDate(date string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", date); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, date)
+}
+
+// -----------------------------------------------------------------------------
+
+// Versions returns every version of the specification, oldest first.
+func (c *APISpecification) Versions() []string {
+	versions := make([]string, 0, len(c.APIVersions))
+	for version := range c.APIVersions {
+		versions = append(versions, version)
+	}
+	SortVersions(versions)
+	return versions
+}
+
+// -----------------------------------------------------------------------------
+
+// addMethods adds methods to the API, recording each against its version.
+func (api *APIGroup) addMethods(methods []Method) {
+	if len(methods) == 0 {
+		return
+	}
+	if api.Versions == nil {
+		api.Versions = make(map[string][]Method)
+	}
+	for _, method := range methods {
+		api.Versions[method.Version] = append(api.Versions[method.Version], method)
+	}
+	api.Methods = append(api.Methods, methods...)
+}
+
+// setCurrentVersion makes the newest version of the API its current version, and sorts the
+// methods of every version.
+func (api *APIGroup) setCurrentVersion() {
+	if len(api.Versions) == 0 {
+		return
+	}
+
+	versions := make([]string, 0, len(api.Versions))
+	for version, methods := range api.Versions {
+		sort.Sort(SortMethods(methods))
+		versions = append(versions, version)
+	}
+	SortVersions(versions)
+
+	api.CurrentVersion = versions[len(versions)-1]
+	api.Methods = api.Versions[api.CurrentVersion]
+}
+
+// -----------------------------------------------------------------------------
+
+// buildAPIVersions groups the APIs by version, each holding the methods of just that version.
+func (c *APISpecification) buildAPIVersions() {
+	for _, api := range c.APIs {
+		for v := range api.Versions {
+			if c.APIVersions == nil {
+				c.APIVersions = make(map[string]APISet)
+			}
+			// Create copy of API and set Methods array to be correct for the version we are building
+			napi := api
+			napi.Methods = napi.Versions[v]
+			napi.Versions = nil
+			c.APIVersions[v] = append(c.APIVersions[v], napi) // Group APIs by version
+		}
+	}
+
+	if versions := c.Versions(); len(versions) > 0 && c.CurrentVersion == "" {
+		c.CurrentVersion = versions[len(versions)-1]
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// specVersion is a file holding one version of a specification
+type specVersion struct {
+	id       string
+	version  string
+	location string
+}
+
+// parseSpecVersions parses the id:version=filename spec-version configuration, grouping the
+// versions by specification ID, in the order each ID is first given.
+func parseSpecVersions(entries []string) ([]string, map[string][]specVersion) {
+	var ids []string
+	versions := make(map[string][]specVersion)
+
+	for _, entry := range entries {
+		slice := strings.SplitN(entry, "=", 2)
+		idVersion := strings.SplitN(slice[0], ":", 2)
+
+		if len(slice) != 2 || len(idVersion) != 2 || idVersion[0] == "" || idVersion[1] == "" {
+			logger.Errorf(nil, "Error: invalid spec-version %s - not an id:version=filename", entry)
+			continue
+		}
+
+		id := idVersion[0]
+		if _, ok := versions[id]; !ok {
+			ids = append(ids, id)
+		}
+		versions[id] = append(versions[id], specVersion{id: id, version: idVersion[1], location: slice[1]})
+	}
+	return ids, versions
+}
+
+// -----------------------------------------------------------------------------
+
+// loadSpecificationVersions loads each specification given as a set of files, one per
+// version, merging the versions into a single specification. It returns the specifications
+// that loaded, and the problems found loading all of them.
+func loadSpecificationVersions(specDir string, entries []string, currentVersions []string) ([]*APISpecification, []Diagnostic) {
+
+	var specifications []*APISpecification
+	var diagnostics []Diagnostic
+
+	current := make(map[string]string)
+	for _, entry := range currentVersions {
+		slice := strings.SplitN(entry, "=", 2)
+		if len(slice) != 2 {
+			logger.Errorf(nil, "Error: invalid spec-current-version %s - not an id=version pair", entry)
+			continue
+		}
+		current[slice[0]] = slice[1]
+	}
+
+	ids, versions := parseSpecVersions(entries)
+
+	for _, id := range ids {
+		loaded := make(map[string]*APISpecification)
+
+		for _, v := range versions[id] {
+			logger.Infof(nil, "Loading version %s of specification %s", v.version, id)
+
+			specification, err := loadSpecVersion(specDir, v)
+			if err != nil && !HasErrors(specification.Diagnostics) {
+				specification.errorf("", "%s", err)
+			}
+			diagnostics = append(diagnostics, specification.Diagnostics...)
+
+			if err != nil {
+				continue
+			}
+			loaded[v.version] = specification
+		}
+
+		if len(loaded) == 0 {
+			continue
+		}
+		specifications = append(specifications, mergeVersions(id, loaded, current[id]))
+	}
+
+	return specifications, diagnostics
+}
+
+// -----------------------------------------------------------------------------
+
+func loadSpecVersion(specDir string, v specVersion) (*APISpecification, error) {
+
+	location := v.location
+	if isLocalSpecUrl(location) && !strings.HasPrefix(location, "/") {
+		location = "/" + location
+	}
+
+	specification := &APISpecification{URL: location, version: v.version}
+
+	src, err := newSpecSource(specDir, location)
+	if err != nil {
+		return specification, err
+	}
+	if remote, ok := src.(*urlSource); ok {
+		return loadRemote(remote, location, v.version)
+	}
+	return specification, specification.load(src)
+}
+
+// -----------------------------------------------------------------------------
+
+// mergeVersions merges the versions of a specification, each loaded from its own file, into
+// a single specification. APIs are matched across the versions by ID. The current version
+// provides everything that is not versioned, such as the title and security schemes, and
+// defaults to the newest version.
+func mergeVersions(id string, versions map[string]*APISpecification, current string) *APISpecification {
+
+	names := make([]string, 0, len(versions))
+	for version := range versions {
+		names = append(names, version)
+	}
+	SortVersions(names)
+
+	if _, ok := versions[current]; !ok {
+		if current != "" {
+			logger.Errorf(nil, "Error: specification %s has no version %s to make current", id, current)
+		}
+		current = names[len(names)-1]
+	}
+
+	// Start from a copy of the current version, without any of its APIs or resources
+	merged := *versions[current]
+	merged.ID = id
+	merged.version = ""
+	merged.APIs = nil
+	merged.APIVersions = nil
+	merged.ResourceList = make(map[string]map[string]*Resource)
+	merged.Diagnostics = nil
+	merged.VersionStatuses = nil
+
+	apis := make(map[string]*APIGroup)
+	var order []string
+
+	for _, version := range names {
+		specification := versions[version]
+		specification.ID = id // Properties link to resources through the specification that built them
+
+		merged.Diagnostics = append(merged.Diagnostics, specification.Diagnostics...)
+
+		for v, status := range specification.VersionStatuses {
+			if merged.VersionStatuses == nil {
+				merged.VersionStatuses = make(map[string]*VersionStatus)
+			}
+			merged.VersionStatuses[v] = status
+		}
+
+		for v, resources := range specification.ResourceList {
+			merged.ResourceList[v] = resources
+		}
+
+		for _, api := range specification.APIs {
+			m, ok := apis[api.ID]
+			if !ok {
+				m = &APIGroup{}
+				*m = api
+				m.Versions = make(map[string][]Method)
+				m.Methods = nil
+				apis[api.ID] = m
+				order = append(order, api.ID)
+			}
+			if version == current {
+				// The current version describes the API
+				m.Name = api.Name
+				m.Description = api.Description
+				m.ExternalDocs = api.ExternalDocs
+			}
+			for v, methods := range api.Versions {
+				m.Versions[v] = append(m.Versions[v], methods...)
+			}
+		}
+	}
+
+	for _, apiID := range order {
+		api := apis[apiID]
+		api.Info = &merged.APIInfo
+		api.setCurrentVersion()
+		if methods, ok := api.Versions[current]; ok {
+			api.CurrentVersion = current
+			api.Methods = methods
+		}
+		merged.APIs = append(merged.APIs, *api)
+	}
+
+	merged.buildAPIVersions()
+
+	return &merged
+}
@@ -0,0 +1,161 @@
+/*
+Copyright (C) 2016-2017 dapperdox.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+*/
+package validate
+
+// This package implements the validate command, which loads the specifications, assets,
+// guides and templates exactly as the server does, but reports the problems it finds
+// rather than serving the documentation. It is intended for linting in CI pipelines.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/UKHomeOffice/dapperdox/config"
+	"github.com/UKHomeOffice/dapperdox/handlers/guides"
+	"github.com/UKHomeOffice/dapperdox/logger"
+	"github.com/UKHomeOffice/dapperdox/render"
+	"github.com/UKHomeOffice/dapperdox/render/asset"
+	"github.com/UKHomeOffice/dapperdox/spec"
+	"github.com/gorilla/pat"
+)
+
+// Problem is a single problem found by the validate command
+type Problem struct {
+	Check    string `json:"check"`             // specification, asset, guide or template
+	Source   string `json:"source"`            // The specification or file at fault
+	Pointer  string `json:"pointer,omitempty"` // JSON pointer into a specification
+	Severity string `json:"severity"`          // error or warning
+	Message  string `json:"message"`
+}
+
+// Report lists every problem found by the validate command
+type Report struct {
+	Valid    bool      `json:"valid"` // Whether no problem is an error
+	Problems []Problem `json:"problems"`
+}
+
+// ---------------------------------------------------------------------------
+// Run validates the configured specifications and assets, writes the report to w in the
+// configured output format, and returns the exit code for the command: zero if no errors
+// were found, and one otherwise. Warnings are reported, but do not fail validation.
+func Run(w io.Writer) int {
+
+	cfg, err := config.Get()
+	if err != nil {
+		logger.Errorf(nil, "error configuring app: %s", err)
+		return 1
+	}
+
+	report := Validate()
+
+	switch cfg.ValidateOutput {
+	case "json":
+		err = writeJSON(w, report)
+	default:
+		err = writeText(w, report)
+	}
+	if err != nil {
+		logger.Errorf(nil, "Error writing validation report: %s", err)
+		return 1
+	}
+
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
+
+// ---------------------------------------------------------------------------
+// Validate loads the specifications, compiles the assets, builds the guides navigation and
+// parses the templates, collecting the problems found by each step.
+func Validate() *Report {
+
+	report := &Report{Problems: make([]Problem, 0)}
+
+	spec.LoadStatusCodes()
+
+	if err := spec.LoadSpecifications(true); err != nil {
+		report.add(Problem{Check: "specification", Severity: string(spec.SeverityError), Message: err.Error()})
+	}
+	for _, d := range spec.Diagnostics {
+		report.add(Problem{Check: "specification", Source: d.Spec, Pointer: d.Pointer, Severity: string(d.Severity), Message: d.Message})
+	}
+
+	// The renderer panics on a template that does not parse, so the templates are checked,
+	// as the assets are compiled, without creating it.
+	templateErrors := render.Check()
+	for _, e := range asset.Errors() {
+		report.add(Problem{Check: "asset", Source: e.File, Severity: string(spec.SeverityError), Message: e.Message})
+	}
+	for _, e := range templateErrors {
+		report.add(Problem{Check: "template", Source: e.File, Severity: string(spec.SeverityError), Message: e.Message})
+	}
+
+	guides.Register(pat.New())
+	for _, e := range guides.Errors() {
+		report.add(Problem{Check: "guide", Source: e.Guide, Severity: string(spec.SeverityError), Message: e.Message})
+	}
+
+	report.Valid = !report.hasErrors()
+
+	return report
+}
+
+// ---------------------------------------------------------------------------
+func (r *Report) add(p Problem) {
+	r.Problems = append(r.Problems, p)
+}
+
+// hasErrors reports whether any problem is an error rather than a warning
+func (r *Report) hasErrors() bool {
+	for _, p := range r.Problems {
+		if p.Severity == string(spec.SeverityError) {
+			return true
+		}
+	}
+	return false
+}
+
+// ---------------------------------------------------------------------------
+func writeJSON(w io.Writer, report *Report) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// ---------------------------------------------------------------------------
+func writeText(w io.Writer, report *Report) error {
+	for _, p := range report.Problems {
+		source := p.Source
+		if p.Pointer != "" {
+			source += "#" + p.Pointer
+		}
+		if _, err := fmt.Fprintf(w, "%-7s %-13s %s: %s\n", p.Severity, p.Check, source, p.Message); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d problem(s) found\n", len(report.Problems))
+	return err
+}
+
+// ---------------------------------------------------------------------------
+// end
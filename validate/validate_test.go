@@ -0,0 +1,144 @@
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/UKHomeOffice/dapperdox/config"
+	"github.com/UKHomeOffice/dapperdox/render/asset"
+	"github.com/UKHomeOffice/dapperdox/spec"
+)
+
+// petsSpec has an operation with an invalid sunset date, which is a warning
+const petsSpec = `
+openapi: 3.0.0
+info:
+  title: Pets
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      summary: List pets
+      x-sunset: someday
+      responses:
+        '200':
+          description: The pets
+`
+
+// run validates the specification, with the templates given by name in an assets-dir,
+// returning the exit code and the report written.
+func run(t *testing.T, document string, templates map[string]string, output string) (int, string) {
+
+	dir, err := ioutil.TempDir("", "validate")
+	if err != nil {
+		t.Fatal(`Failed to create spec-dir` + err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "pets.yaml"), []byte(document), 0644); err != nil {
+		t.Fatal(`Failed to create spec` + err.Error())
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "assets", "templates"), 0755); err != nil {
+		t.Fatal(`Failed to create assets-dir` + err.Error())
+	}
+	for name, content := range templates {
+		if err := ioutil.WriteFile(filepath.Join(dir, "assets", "templates", name), []byte(content), 0644); err != nil {
+			t.Fatal(`Failed to create template` + err.Error())
+		}
+	}
+
+	config.Get() // Fails the first time under test, on the test flags, but is then configured
+	cfg, _ := config.Get()
+	cfg.SpecDir, cfg.SpecFilename = dir, []string{"/pets.yaml"}
+	cfg.AssetsDir, cfg.DefaultAssetsDir = filepath.Join(dir, "assets"), "../assets"
+	cfg.ValidateOutput = output
+
+	spec.APISuite = nil
+	asset.Reset()
+
+	var out bytes.Buffer
+	code := Run(&out)
+	return code, out.String()
+}
+
+func TestRunPassesWithWarnings(t *testing.T) {
+
+	code, out := run(t, petsSpec, nil, "text")
+
+	if code != 0 {
+		t.Errorf(`Exit code fail: %d %s`, code, out)
+	}
+	if !strings.Contains(out, "warning specification /pets.yaml#/paths/~1pets/get/x-sunset: Invalid sunset date someday") ||
+		!strings.HasSuffix(out, "1 problem(s) found\n") {
+		t.Errorf(`Output fail: %s`, out)
+	}
+}
+
+func TestRunFailsWithErrors(t *testing.T) {
+
+	code, out := run(t, strings.Replace(petsSpec, "title: Pets", "title: ''", 1), nil, "text")
+
+	if code != 1 {
+		t.Errorf(`Exit code fail: %d %s`, code, out)
+	}
+	if !strings.Contains(out, "error   specification /pets.yaml#/info/title:") {
+		t.Errorf(`Output fail: %s`, out)
+	}
+}
+
+func TestRunReportsTemplatesThatDoNotParse(t *testing.T) {
+
+	templates := map[string]string{
+		"broken.tmpl":  `{{ if .Title }}`,
+		"unknown.tmpl": `{{ nonsense .Title }}`,
+		"working.tmpl": `{{ template "layout" . }}{{ lc .Title | safehtml }}`,
+	}
+	code, out := run(t, petsSpec, templates, "json")
+
+	if code != 1 {
+		t.Errorf(`Exit code fail: %d %s`, code, out)
+	}
+
+	var report Report
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatal(`Failed to parse report` + err.Error())
+	}
+	if report.Valid {
+		t.Error(`Valid fail`)
+	}
+
+	sources := make(map[string]bool)
+	for _, p := range report.Problems {
+		if p.Check == "template" {
+			if p.Severity != "error" || p.Message == "" {
+				t.Errorf(`Template problem fail: %v`, p)
+			}
+			sources[p.Source] = true
+		}
+	}
+	if len(sources) != 2 || !sources["assets/templates/broken.tmpl"] || !sources["assets/templates/unknown.tmpl"] {
+		t.Errorf(`Template problems fail: %v`, report.Problems)
+	}
+}
+
+func TestRunWritesJSON(t *testing.T) {
+
+	code, out := run(t, petsSpec, nil, "json")
+
+	var report Report
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatal(`Failed to parse report` + err.Error())
+	}
+	if code != 0 || !report.Valid || len(report.Problems) != 1 {
+		t.Fatalf(`Report fail: %d %s`, code, out)
+	}
+	p := report.Problems[0]
+	if p.Check != "specification" || p.Source != "/pets.yaml" || p.Pointer != "/paths/~1pets/get/x-sunset" || p.Severity != "warning" {
+		t.Errorf(`Problem fail: %v`, p)
+	}
+}